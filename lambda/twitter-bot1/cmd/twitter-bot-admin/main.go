@@ -0,0 +1,165 @@
+// Command twitter-bot-admin runs administrative tasks against a deployed bot.
+//
+//	twitter-bot-admin forget -account 4337869213 -sender 3805104374 [-dry-run] [-notify]
+//	twitter-bot-admin dead-letters
+//
+// Table names, the region and twitter credentials are read with the config
+// package from the same environment variables, CONFIG_FILE or
+// CONFIG_SSM_PATH the lambdas use. Like the lambdas, the bot account's
+// tokens come from the accounts table, OAUTH_TOKEN and OAUTH_SECRET are the
+// fallback for accounts not in it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/outbox"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+const usage = `usage: twitter-bot-admin <command> [flags]
+
+commands:
+  forget        delete a sender's pictures, analyses and conversation
+  dead-letters  list deferred replies that were given up on
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.FromEnv("twitter-bot-admin")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "twitter-bot-admin: %v\n", err)
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "forget":
+		err = forgetCmd(cfg, os.Args[2:])
+	case "dead-letters":
+		err = deadLettersCmd(cfg, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "twitter-bot-admin %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func forgetCmd(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("forget", flag.ExitOnError)
+	forUserID := fs.String("account", "", "twitter user id of the bot account the sender talked to")
+	senderID := fs.String("sender", "", "twitter user id of the sender to forget")
+	dryRun := fs.Bool("dry-run", false, "only list what would be deleted")
+	notify := fs.Bool("notify", false, "confirm the deletion to the sender by DM")
+	region := fs.String("region", cfg.Region, "aws region of the bot's tables and bucket")
+	fs.Parse(args)
+
+	if *forUserID == "" || *senderID == "" {
+		return fmt.Errorf("-account and -sender are required")
+	}
+	ctx := context.Background()
+	if err := cfg.Require(config.KeyPictureIndexTable, config.KeyPHashTable, config.KeyConversationTable); err != nil {
+		return err
+	}
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region: aws.String(*region),
+	}))
+	dynamodbSvc := dynamodb.New(sess)
+
+	f := forget.New(
+		s3.New(sess),
+		pictureindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PictureIndex),
+		phashindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PerceptualHash),
+		conversation.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Conversation),
+	)
+	f.DryRun = *dryRun
+
+	result, err := f.Forget(ctx, *forUserID, *senderID)
+	if err != nil {
+		return err
+	}
+	for _, obj := range result.Objects {
+		fmt.Println(obj)
+	}
+	for _, obj := range result.Shared {
+		fmt.Printf("%s (kept, sent by other senders too)\n", obj)
+	}
+	if *dryRun {
+		fmt.Printf("would delete %d objects and the conversation of %s\n", len(result.Objects), *senderID)
+		return nil
+	}
+	fmt.Printf("deleted %d objects and the conversation of %s\n", len(result.Objects), *senderID)
+
+	if !*notify {
+		return nil
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret); err != nil {
+		return err
+	}
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
+	}
+	client, _, err := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits).Get(ctx, *forUserID)
+	if err != nil {
+		return err
+	}
+	sent, err := twitter.SendDirectMessage(ctx, client, twitter.NewDirectMessageRequest(*senderID,
+		fmt.Sprintf("Your %d stored pictures and analyses and our conversation have been deleted.", len(result.Objects))))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("notified %s in message %s\n", *senderID, sent.ID)
+	return nil
+}
+
+func deadLettersCmd(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	region := fs.String("region", cfg.Region, "aws region of the bot's tables")
+	fs.Parse(args)
+
+	if err := cfg.Require(config.KeyOutboxTable); err != nil {
+		return err
+	}
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region: aws.String(*region),
+	}))
+	o := outbox.New(outbox.NewDynamoDBStore(dynamodb.New(sess), cfg.Tables.Outbox), outbox.DefaultPolicy)
+
+	dead, err := o.DeadLetters(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, m := range dead {
+		fmt.Printf("%s\tto %s\t%d attempts\t%s\n", m.ID, m.SenderID, m.Attempts, m.LastError)
+	}
+	return nil
+}
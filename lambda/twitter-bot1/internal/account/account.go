@@ -0,0 +1,99 @@
+// Package account keeps the bot accounts one deployment serves. Webhook
+// events name the subscribed account in for_user_id, its access token and
+// configuration are looked up in a Registry.
+package account
+
+import (
+	"context"
+	"errors"
+)
+
+// Analyses an account can enable
+const (
+	// AnalysisFaces face detection of received pictures
+	AnalysisFaces = "faces"
+	// AnalysisLabels the show labels quick reply action
+	AnalysisLabels = "labels"
+	// AnalysisBlur the blur faces quick reply action
+	AnalysisBlur = "blur"
+)
+
+// ErrUnknownAccount no account is registered for the user id
+var ErrUnknownAccount = errors.New("unknown account")
+
+type (
+	// Account one subscribed bot account
+	Account struct {
+		UserID      string `json:"user_id"`
+		OAuthToken  string `json:"oauth_token"`
+		OAuthSecret string `json:"oauth_secret"`
+		// Analyses enabled analyses, empty enables all
+		Analyses []string `json:"analyses,omitempty"`
+		// Templates reply templates replacing the built-in ones, by name
+		Templates map[string]string `json:"templates,omitempty"`
+	}
+	// Registry looks up accounts by for_user_id
+	Registry interface {
+		// Get returns the account of userID, ErrUnknownAccount when there is
+		// none.
+		Get(ctx context.Context, userID string) (Account, error)
+		// Delete removes the account of userID, removing an unknown
+		// account is not an error.
+		Delete(ctx context.Context, userID string) error
+	}
+)
+
+// Enabled is true when analysis is enabled for the account.
+func (a Account) Enabled(analysis string) bool {
+	if len(a.Analyses) == 0 {
+		return true
+	}
+	for _, v := range a.Analyses {
+		if v == analysis {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackRegistry answers unknown users with a fallback account
+type fallbackRegistry struct {
+	registry Registry
+	fallback Account
+}
+
+// WithFallback returns a registry answering users unknown to registry with
+// fallback, a nil registry answers every user with it. When fallback.UserID
+// is set only that user gets it. It keeps single account deployments working
+// with only OAUTH_TOKEN and OAUTH_SECRET set.
+func WithFallback(registry Registry, fallback Account) Registry {
+	return &fallbackRegistry{
+		registry: registry,
+		fallback: fallback,
+	}
+}
+
+// Get implements Registry.
+func (f *fallbackRegistry) Get(ctx context.Context, userID string) (Account, error) {
+	if f.registry != nil {
+		a, err := f.registry.Get(ctx, userID)
+		if err != ErrUnknownAccount {
+			return a, err
+		}
+	}
+	if f.fallback.UserID != "" && f.fallback.UserID != userID {
+		return Account{}, ErrUnknownAccount
+	}
+	a := f.fallback
+	a.UserID = userID
+	return a, nil
+}
+
+// Delete implements Registry. The fallback is configuration, it can not be
+// removed.
+func (f *fallbackRegistry) Delete(ctx context.Context, userID string) error {
+	if f.registry == nil {
+		return nil
+	}
+	return f.registry.Delete(ctx, userID)
+}
@@ -0,0 +1,128 @@
+package account
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+)
+
+// fakeDynamoDB knows the account bot1
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+func (f *fakeDynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if aws.StringValue(input.Key["user_id"].S) != "bot1" {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"user_id":     {S: aws.String("bot1")},
+		"oauth_token": {S: aws.String("token1")},
+	}}, nil
+}
+
+func TestWithFallback(t *testing.T) {
+	registry := WithFallback(NewMemoryRegistry(Account{UserID: "bot1", OAuthToken: "token1"}), Account{OAuthToken: "default"})
+
+	tt := []struct {
+		name   string
+		userID string
+		token  string
+	}{
+		{name: "registered", userID: "bot1", token: "token1"},
+		{name: "fallback", userID: "bot2", token: "default"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := registry.Get(context.Background(), tc.userID)
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+			if a.OAuthToken != tc.token || a.UserID != tc.userID {
+				t.Fatalf("got: %+v, wanted token %v for %v", a, tc.token, tc.userID)
+			}
+		})
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	tt := []struct {
+		name     string
+		table    string
+		fallback Account
+		userID   string
+		token    string
+		err      error
+	}{
+		{name: "noTable", fallback: Account{OAuthToken: "default"}, userID: "bot2", token: "default"},
+		{name: "registered", table: "accounts", fallback: Account{OAuthToken: "default"}, userID: "bot1", token: "token1"},
+		{name: "unknown", table: "accounts", fallback: Account{OAuthToken: "default"}, userID: "bot2", err: ErrUnknownAccount},
+		{name: "defaultAccount", table: "accounts", fallback: Account{UserID: "bot2", OAuthToken: "default"}, userID: "bot2", token: "default"},
+		{name: "notDefaultAccount", table: "accounts", fallback: Account{UserID: "bot2", OAuthToken: "default"}, userID: "bot3", err: ErrUnknownAccount},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := NewRegistry(&fakeDynamoDB{}, tc.table, tc.fallback)
+			a, err := registry.Get(context.Background(), tc.userID)
+			if err != tc.err {
+				t.Fatalf("got: %v, wanted: %v", err, tc.err)
+			}
+			if a.OAuthToken != tc.token {
+				t.Fatalf("got: %+v, wanted token %v", a, tc.token)
+			}
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tt := []struct {
+		name     string
+		analyses []string
+		analysis string
+		enabled  bool
+	}{
+		{name: "allByDefault", analysis: AnalysisLabels, enabled: true},
+		{name: "listed", analyses: []string{AnalysisFaces, AnalysisLabels}, analysis: AnalysisLabels, enabled: true},
+		{name: "notListed", analyses: []string{AnalysisFaces}, analysis: AnalysisBlur, enabled: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := (Account{Analyses: tc.analyses}).Enabled(tc.analysis); got != tc.enabled {
+				t.Fatalf("got: %v, wanted: %v", got, tc.enabled)
+			}
+		})
+	}
+}
+
+func TestClients(t *testing.T) {
+	registry := NewMemoryRegistry(Account{UserID: "bot1", OAuthToken: "token1"})
+	clients := NewClients(registry, "key", "secret", ratelimit.NewMemoryStore())
+	ctx := context.Background()
+
+	c1, _, err := clients.Get(ctx, "bot1")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	c2, _, _ := clients.Get(ctx, "bot1")
+	if c1 != c2 {
+		t.Fatalf("got a new client, wanted the same client while the token is unchanged")
+	}
+
+	registry.Put(Account{UserID: "bot1", OAuthToken: "token2"})
+	c3, _, _ := clients.Get(ctx, "bot1")
+	if c3 == c1 {
+		t.Fatalf("got the old client, wanted a new client for the new token")
+	}
+
+	if _, _, err := clients.Get(ctx, "bot2"); err != ErrUnknownAccount {
+		t.Fatalf("got: %v, wanted: %v", err, ErrUnknownAccount)
+	}
+}
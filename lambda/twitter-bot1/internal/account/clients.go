@@ -0,0 +1,86 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// ClientSource hands out the twitter client of a bot account, lambda handlers
+// take one so that tests can do without the registry and real tokens
+type ClientSource interface {
+	Get(ctx context.Context, userID string) (*http.Client, Account, error)
+}
+
+// Clients hands out twitter clients signing with each account's access
+// token. Clients are kept for as long as the account's token is unchanged.
+type Clients struct {
+	registry       Registry
+	consumerKey    string
+	consumerSecret string
+	limits         ratelimit.Store
+
+	// Observe is set as the ratelimit.Transport Observe of every client
+	Observe func(ratelimit.Limit)
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// NewClients returns Clients for the app's consumer key and secret. Rate
+// limits of every account are kept in limits, scoped by user id.
+func NewClients(registry Registry, consumerKey string, consumerSecret string, limits ratelimit.Store) *Clients {
+	return &Clients{
+		registry:       registry,
+		consumerKey:    consumerKey,
+		consumerSecret: consumerSecret,
+		limits:         limits,
+		clients:        make(map[string]*http.Client),
+	}
+}
+
+// NewRegistry returns the registry of a lambda. Without a table every user
+// gets the fallback. With one only the accounts in it are known, and
+// fallback.UserID when it is set.
+func NewRegistry(dynamodbSvc dynamodbiface.DynamoDBAPI, table string, fallback Account) Registry {
+	if table == "" {
+		return WithFallback(nil, fallback)
+	}
+	registry := NewDynamoDBRegistry(dynamodbSvc, table)
+	if fallback.UserID == "" {
+		return registry
+	}
+	return WithFallback(registry, fallback)
+}
+
+// Get returns the account of userID and a client acting as it.
+func (c *Clients) Get(ctx context.Context, userID string) (*http.Client, Account, error) {
+	a, err := c.registry.Get(ctx, userID)
+	if err != nil {
+		return nil, Account{}, err
+	}
+
+	key := userID + "/" + a.OAuthToken
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[key]; ok {
+		return client, a, nil
+	}
+
+	client, err := twitter.NewHTTPClient(c.consumerKey, c.consumerSecret, a.OAuthToken, a.OAuthSecret)
+	if err != nil {
+		return nil, Account{}, err
+	}
+	transport := ratelimit.NewTransport(client.Transport, c.limits)
+	transport.Observe = c.Observe
+	transport.Scope = userID
+	client.Transport = trace.NewTransport(transport)
+
+	c.clients[key] = client
+	return client, a, nil
+}
@@ -0,0 +1,62 @@
+package account
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBRegistry keeps one item per account in a table with the string
+// partition key user_id.
+type DynamoDBRegistry struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBRegistry returns a registry using table.
+func NewDynamoDBRegistry(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBRegistry {
+	return &DynamoDBRegistry{
+		client: client,
+		table:  table,
+	}
+}
+
+// Get implements Registry.
+func (d *DynamoDBRegistry) Get(ctx context.Context, userID string) (Account, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"user_id": {S: aws.String(userID)},
+		},
+	})
+	if err != nil {
+		return Account{}, fmt.Errorf("get account: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return Account{}, ErrUnknownAccount
+	}
+
+	var a Account
+	if err := dynamodbattribute.UnmarshalMap(out.Item, &a); err != nil {
+		return Account{}, fmt.Errorf("unmarshal account: %v", err)
+	}
+	return a, nil
+}
+
+// Delete implements Registry.
+func (d *DynamoDBRegistry) Delete(ctx context.Context, userID string) error {
+	_, err := d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"user_id": {S: aws.String(userID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("delete account: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package account
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRegistry keeps accounts in memory. It is used for tests and when the
+// bot is self-hosted without DynamoDB.
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	accounts map[string]Account
+}
+
+// NewMemoryRegistry returns a registry of accounts.
+func NewMemoryRegistry(accounts ...Account) *MemoryRegistry {
+	m := &MemoryRegistry{
+		accounts: make(map[string]Account),
+	}
+	for _, a := range accounts {
+		m.accounts[a.UserID] = a
+	}
+	return m
+}
+
+// Get implements Registry.
+func (m *MemoryRegistry) Get(ctx context.Context, userID string) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[userID]
+	if !ok {
+		return Account{}, ErrUnknownAccount
+	}
+	return a, nil
+}
+
+// Delete implements Registry.
+func (m *MemoryRegistry) Delete(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	delete(m.accounts, userID)
+	m.mu.Unlock()
+	return nil
+}
+
+// Put adds or replaces an account.
+func (m *MemoryRegistry) Put(a Account) {
+	m.mu.Lock()
+	m.accounts[a.UserID] = a
+	m.mu.Unlock()
+}
@@ -0,0 +1,98 @@
+// Package analysiscache keeps analysis results by the checksum of the picture
+// analysed and the type of analysis, one of the retention Analysis constants.
+// A picture sent again, by the same or another sender, reuses the stored
+// result instead of being sent to Rekognition.
+package analysiscache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+)
+
+// Cache stores analysis results
+type Cache interface {
+	// Get returns the result of analysis for the picture with checksum, ok
+	// is false when there is none.
+	Get(ctx context.Context, checksum string, analysis string) ([]byte, bool, error)
+	// Put stores the result of analysis for the picture with checksum.
+	Put(ctx context.Context, checksum string, analysis string, result []byte) error
+}
+
+// Key returns the key of the result of analysis for the picture with
+// checksum.
+func Key(checksum string, analysis string) string {
+	return fmt.Sprintf("analyses/%s/%s.json", checksum, analysis)
+}
+
+// S3Cache stores results in the picture bucket, encrypted like the pictures.
+// Results are tagged with the analysis retention class and expire with it.
+type S3Cache struct {
+	pictures *picturestore.Store
+	bucket   string
+}
+
+// NewS3Cache returns a cache storing results in bucket.
+func NewS3Cache(pictures *picturestore.Store, bucket string) *S3Cache {
+	return &S3Cache{
+		pictures: pictures,
+		bucket:   bucket,
+	}
+}
+
+// Get implements Cache.
+func (c *S3Cache) Get(ctx context.Context, checksum string, analysis string) ([]byte, bool, error) {
+	result, err := c.pictures.Get(ctx, c.bucket, Key(checksum, analysis))
+	if err == picturestore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+// Put implements Cache.
+func (c *S3Cache) Put(ctx context.Context, checksum string, analysis string, result []byte) error {
+	return c.pictures.Put(ctx, picturestore.PutInput{
+		Bucket:      c.bucket,
+		Key:         Key(checksum, analysis),
+		Body:        result,
+		ContentType: "application/json",
+		Tagging: retention.Tags{
+			MediaType:      "application/json",
+			AnalysisType:   analysis,
+			RetentionClass: retention.ClassAnalysis,
+		}.Encode(),
+	})
+}
+
+// MemoryCache keeps results in memory
+type MemoryCache struct {
+	mu      sync.Mutex
+	results map[string][]byte
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{results: make(map[string][]byte)}
+}
+
+// Get implements Cache.
+func (m *MemoryCache) Get(ctx context.Context, checksum string, analysis string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result, ok := m.results[Key(checksum, analysis)]
+	return result, ok, nil
+}
+
+// Put implements Cache.
+func (m *MemoryCache) Put(ctx context.Context, checksum string, analysis string, result []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[Key(checksum, analysis)] = result
+	return nil
+}
@@ -0,0 +1,77 @@
+package analysiscache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+)
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]*s3.PutObjectInput
+	bodies  map[string][]byte
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	body, _ := ioutil.ReadAll(input.Body)
+	f.objects[aws.StringValue(input.Key)] = input
+	f.bodies[aws.StringValue(input.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	body, ok := f.bodies[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func TestCache(t *testing.T) {
+	s3Svc := &fakeS3{objects: make(map[string]*s3.PutObjectInput), bodies: make(map[string][]byte)}
+	pictures, err := picturestore.New(picturestore.Config{}, s3Svc, nil)
+	if err != nil {
+		t.Fatalf("picturestore.New failed with error: %v", err)
+	}
+
+	tt := []struct {
+		name  string
+		cache Cache
+	}{
+		{name: "s3", cache: NewS3Cache(pictures, "pictures")},
+		{name: "memory", cache: NewMemoryCache()},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, ok, err := tc.cache.Get(ctx, "3a", retention.AnalysisFaces); ok || err != nil {
+				t.Fatalf("got: %v %v, wanted: a miss", ok, err)
+			}
+			if err := tc.cache.Put(ctx, "3a", retention.AnalysisFaces, []byte(`[]`)); err != nil {
+				t.Fatalf("Put failed with error: %v", err)
+			}
+			result, ok, err := tc.cache.Get(ctx, "3a", retention.AnalysisFaces)
+			if !ok || err != nil || string(result) != `[]` {
+				t.Fatalf("got: %q %v %v, wanted: the stored result", result, ok, err)
+			}
+			if _, ok, _ := tc.cache.Get(ctx, "3a", retention.AnalysisLabels); ok {
+				t.Fatalf("got: a hit for another analysis, wanted: a miss")
+			}
+		})
+	}
+
+	stored := s3Svc.objects["analyses/3a/faces.json"]
+	if stored == nil || aws.StringValue(stored.Tagging) != "analysis-type=faces&media-type=application%2Fjson&retention-class=analysis" {
+		t.Fatalf("got: %v, wanted: the result tagged with the analysis retention class", stored)
+	}
+}
@@ -0,0 +1,100 @@
+// Package blur pixelates regions of a picture, it is used to hide the faces
+// rekognition found before a picture is sent back.
+package blur
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// blocks number of blocks across a pixelated region
+const blocks = 8
+
+// Box region to pixelate as ratios of the picture's width and height
+type Box struct {
+	Left   float64
+	Top    float64
+	Width  float64
+	Height float64
+}
+
+// Regions decodes a jpeg or png picture, pixelates boxes and encodes the
+// result in the same format.
+func Regions(picture []byte, boxes []Box) ([]byte, error) {
+	src, format, err := image.Decode(bytes.NewReader(picture))
+	if err != nil {
+		return nil, fmt.Errorf("decode picture: %v", err)
+	}
+
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	for _, b := range boxes {
+		pixelate(img, b.rect(img.Bounds()))
+	}
+
+	var out bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&out, img)
+	default:
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode %s picture: %v", format, err)
+	}
+	return out.Bytes(), nil
+}
+
+// rect returns b in pixels, clipped to bounds.
+func (b Box) rect(bounds image.Rectangle) image.Rectangle {
+	w := float64(bounds.Dx())
+	h := float64(bounds.Dy())
+	r := image.Rect(
+		bounds.Min.X+int(b.Left*w),
+		bounds.Min.Y+int(b.Top*h),
+		bounds.Min.X+int((b.Left+b.Width)*w+0.5),
+		bounds.Min.Y+int((b.Top+b.Height)*h+0.5),
+	)
+	return r.Intersect(bounds)
+}
+
+// pixelate replaces r with blocks x blocks squares of their average color.
+func pixelate(img *image.RGBA, r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	size := r.Dx() / blocks
+	if r.Dy()/blocks > size {
+		size = r.Dy() / blocks
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y += size {
+		for x := r.Min.X; x < r.Max.X; x += size {
+			block := image.Rect(x, y, x+size, y+size).Intersect(r)
+			draw.Draw(img, block, &image.Uniform{C: average(img, block)}, image.ZP, draw.Src)
+		}
+	}
+}
+
+func average(img *image.RGBA, r image.Rectangle) color.RGBA {
+	var sr, sg, sb, sa, n uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			sr += uint64(c.R)
+			sg += uint64(c.G)
+			sb += uint64(c.B)
+			sa += uint64(c.A)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(sr / n), G: uint8(sg / n), B: uint8(sb / n), A: uint8(sa / n)}
+}
@@ -0,0 +1,62 @@
+package blur
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func checkerboard(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+func TestRegions(t *testing.T) {
+	out, err := Regions(checkerboard(64), []Box{{Left: 0, Top: 0, Width: 0.5, Height: 0.5}})
+	if err != nil {
+		t.Fatalf("Regions failed with error: %v", err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode failed with error: %v", err)
+	}
+	if format != "png" {
+		t.Fatalf("got format: %v, wanted: png", format)
+	}
+
+	tt := []struct {
+		name    string
+		a, b    image.Point
+		blurred bool
+	}{
+		{name: "insideBox", a: image.Pt(0, 0), b: image.Pt(1, 0), blurred: true},
+		{name: "outsideBox", a: image.Pt(40, 40), b: image.Pt(41, 40), blurred: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			same := img.At(tc.a.X, tc.a.Y) == img.At(tc.b.X, tc.b.Y)
+			if same != tc.blurred {
+				t.Fatalf("got neighbours equal: %v, wanted: %v", same, tc.blurred)
+			}
+		})
+	}
+}
+
+func TestRegionsBadPicture(t *testing.T) {
+	if _, err := Regions([]byte("not a picture"), nil); err == nil {
+		t.Fatalf("got no error for a bad picture")
+	}
+}
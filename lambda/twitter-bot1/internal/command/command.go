@@ -0,0 +1,78 @@
+// Package command parses the commands users can send the bot as direct
+// messages.
+package command
+
+import (
+	"strings"
+)
+
+// Command names
+const (
+	Set      = "set"
+	Settings = "settings"
+	Help     = "help"
+	Forget   = "forget"
+
+	// Actions on the sender's last picture, offered as quick replies. The
+	// name is used as the quick reply option's metadata.
+	ShowLabels  = "show-labels"
+	BlurFaces   = "blur-faces"
+	DeletePhoto = "delete-photo"
+)
+
+// Command a parsed direct message command
+type Command struct {
+	Name string
+	Args []string
+}
+
+// Parse returns the command in text. ok is false when text is not a command
+// and should be treated as an ordinary message.
+func Parse(text string) (cmd Command, ok bool) {
+	fields := strings.Fields(strings.ToLower(strings.TrimSpace(text)))
+	if len(fields) == 0 {
+		return Command{}, false
+	}
+
+	switch fields[0] {
+	case Set:
+		if len(fields) != 3 {
+			return Command{Name: Set}, true
+		}
+		return Command{Name: Set, Args: fields[1:]}, true
+	case Settings, Help:
+		if len(fields) == 1 {
+			return Command{Name: fields[0]}, true
+		}
+	case Forget:
+		if len(fields) == 2 && fields[1] == "me" {
+			return Command{Name: Forget}, true
+		}
+	case "show":
+		if len(fields) == 2 && fields[1] == Settings {
+			return Command{Name: Settings}, true
+		}
+		if len(fields) == 2 && fields[1] == "labels" {
+			return Command{Name: ShowLabels}, true
+		}
+	case "blur":
+		if len(fields) == 2 && fields[1] == "faces" {
+			return Command{Name: BlurFaces}, true
+		}
+	case "delete":
+		if len(fields) == 3 && fields[1] == "my" && (fields[2] == "photo" || fields[2] == "picture") {
+			return Command{Name: DeletePhoto}, true
+		}
+	}
+	return Command{}, false
+}
+
+// FromQuickReply returns the action of a quick reply option's metadata. ok is
+// false for metadata the bot did not send.
+func FromQuickReply(metadata string) (cmd Command, ok bool) {
+	switch metadata {
+	case ShowLabels, BlurFaces, DeletePhoto:
+		return Command{Name: metadata}, true
+	}
+	return Command{}, false
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name string
+		text string
+		cmd  Command
+		ok   bool
+	}{
+		{name: "setLanguage", text: "set language sv", cmd: Command{Name: Set, Args: []string{"language", "sv"}}, ok: true},
+		{name: "setMixedCase", text: "  Set Details MINIMAL ", cmd: Command{Name: Set, Args: []string{"details", "minimal"}}, ok: true},
+		{name: "setIncomplete", text: "set retention", cmd: Command{Name: Set}, ok: true},
+		{name: "settings", text: "settings", cmd: Command{Name: Settings}, ok: true},
+		{name: "showSettings", text: "show settings", cmd: Command{Name: Settings}, ok: true},
+		{name: "help", text: "help", cmd: Command{Name: Help}, ok: true},
+		{name: "forgetMe", text: "Forget me", cmd: Command{Name: Forget}, ok: true},
+		{name: "showLabels", text: "Show labels", cmd: Command{Name: ShowLabels}, ok: true},
+		{name: "blurFaces", text: "blur faces", cmd: Command{Name: BlurFaces}, ok: true},
+		{name: "deleteMyPhoto", text: "Delete my photo", cmd: Command{Name: DeletePhoto}, ok: true},
+		{name: "forgetSomething", text: "forget it", ok: false},
+		{name: "sentence", text: "help me with the second face", ok: false},
+		{name: "empty", text: "", ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, ok := Parse(tc.text)
+			if ok != tc.ok || !reflect.DeepEqual(cmd, tc.cmd) {
+				t.Fatalf("got: %+v %v, wanted: %+v %v", cmd, ok, tc.cmd, tc.ok)
+			}
+		})
+	}
+}
+
+func TestFromQuickReply(t *testing.T) {
+	tt := []struct {
+		name     string
+		metadata string
+		cmd      Command
+		ok       bool
+	}{
+		{name: "blurFaces", metadata: "blur-faces", cmd: Command{Name: BlurFaces}, ok: true},
+		{name: "unknown", metadata: "settings", ok: false},
+		{name: "empty", metadata: "", ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, ok := FromQuickReply(tc.metadata)
+			if ok != tc.ok || !reflect.DeepEqual(cmd, tc.cmd) {
+				t.Fatalf("got: %+v %v, wanted: %+v %v", cmd, ok, tc.cmd, tc.ok)
+			}
+		})
+	}
+}
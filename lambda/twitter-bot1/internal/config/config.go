@@ -0,0 +1,384 @@
+// Package config loads the settings of the lambdas and the self-hosted bot.
+// Values are looked up by their environment variable name in the process
+// environment, then in a local file and then in SSM Parameter Store. Values
+// are validated when loaded, what a lambda requires is checked by its main.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/eventsink"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+)
+
+// maxImageBytes largest picture rekognition accepts as image bytes
+const maxImageBytes = 5 << 20
+
+// Keys of the configuration values
+const (
+	KeyFunctionName       = "AWS_LAMBDA_FUNCTION_NAME"
+	KeyRegion             = "REGION"
+	KeyRekognitionRegion  = "REKOGNITION_REGION"
+	KeyConsumerKey        = "CONSUMER_KEY"
+	KeyConsumerSecret     = "CONSUMER_SECRET_KEY"
+	KeyOAuthToken         = "OAUTH_TOKEN"
+	KeyOAuthSecret        = "OAUTH_SECRET"
+	KeyDefaultAccountID   = "DEFAULT_ACCOUNT_ID"
+	KeyBearerToken        = "BEARER_TOKEN"
+	KeyAccountActivityEnv = "ACCOUNT_ACTIVITY_ENV"
+	KeyPictureBucket      = "PICTURE_BUCKET"
+	KeyPictureEncryption  = "PICTURE_ENCRYPTION"
+	KeyPictureKMSKeyID    = "PICTURE_KMS_KEY_ID"
+	KeyPHashBlocklist     = "PHASH_BLOCKLIST"
+	KeyAccountsTable      = "ACCOUNTS_TABLE"
+	KeyConversationTable  = "CONVERSATION_TABLE"
+	KeyPictureIndexTable  = "PICTURE_INDEX_TABLE"
+	KeyPHashTable         = "PHASH_TABLE"
+	KeyRateLimitTable     = "RATE_LIMIT_TABLE"
+	KeyOutboxTable        = "OUTBOX_TABLE"
+	KeyWelcomeTable       = "WELCOME_TABLE"
+	KeyAuditTable         = "AUDIT_TABLE"
+	KeyEventSink          = "EVENT_SINK"
+	KeyStateMachineARN    = "STATE_MACHINE_ARN"
+	KeyQueueURL           = "QUEUE_URL"
+	KeyEventSource        = "EVENT_SOURCE"
+	KeyListenAddr         = "LISTEN_ADDR"
+	KeyActivityRoutes     = "ACTIVITY_ROUTES"
+	KeyReplyOverflow      = "REPLY_OVERFLOW"
+	KeyWelcomeTemplate    = "WELCOME_TEMPLATE"
+	KeyRetentionPolicy    = "RETENTION_POLICY"
+	KeyRetentionDryRun    = "RETENTION_DRY_RUN"
+	KeyOutboxBatchSize    = "OUTBOX_BATCH_SIZE"
+	KeyMaxPictureBytes    = "MAX_PICTURE_BYTES"
+	KeyMaxLabels          = "MAX_LABELS"
+	KeyMinConfidence      = "MIN_LABEL_CONFIDENCE"
+	KeyPHashMaxDistance   = "PHASH_MAX_DISTANCE"
+	KeyLogLevel           = "LOG_LEVEL"
+	KeyLogHashSalt        = "LOG_HASH_SALT"
+	KeyMetrics            = "METRICS"
+	KeyTraceExporter      = "TRACE_EXPORTER"
+	KeyXRayDaemonAddress  = "AWS_XRAY_DAEMON_ADDRESS"
+)
+
+// Where else than the environment values are looked up
+const (
+	// KeyFile path of a KEY=value file, e.g. for the self-hosted bot
+	KeyFile = "CONFIG_FILE"
+	// KeySSMPath SSM Parameter Store path, e.g. /twitter-bot1, holding a
+	// parameter per key such as /twitter-bot1/CONSUMER_SECRET_KEY
+	KeySSMPath = "CONFIG_SSM_PATH"
+)
+
+type (
+	// Twitter the app's and the default account's credentials
+	Twitter struct {
+		ConsumerKey    string
+		ConsumerSecret string
+		OAuthToken     string
+		OAuthSecret    string
+		// DefaultAccountID user id OAuthToken belongs to, with an accounts
+		// table only this user falls back to it
+		DefaultAccountID string
+		// BearerToken app-only token used to unsubscribe revoked users
+		BearerToken        string
+		AccountActivityEnv string
+	}
+	// Tables DynamoDB table names, an empty name keeps that data in memory
+	Tables struct {
+		Accounts     string
+		Conversation string
+		PictureIndex string
+		// PerceptualHash index of the perceptual hashes of the pictures
+		PerceptualHash string
+		RateLimit      string
+		Outbox         string
+		Welcome        string
+		Audit          string
+	}
+	// Pictures where and how pictures are stored
+	Pictures struct {
+		Bucket string
+		picturestore.Config
+		// Blocklist perceptual hashes of pictures that are refused
+		Blocklist phash.Blocklist
+	}
+	// Thresholds limits tuning the analyses and batches
+	Thresholds struct {
+		OutboxBatchSize int
+		// MaxPictureBytes largest picture downloaded, at most the 5 MB
+		// rekognition accepts
+		MaxPictureBytes int
+		MaxLabels       int
+		// MinConfidence in percent of the labels shown
+		MinConfidence int
+		// PHashMaxDistance bits perceptual hashes of the same picture may
+		// differ in, at most phashindex.Bands-1, beyond that the index
+		// misses near-duplicates
+		PHashMaxDistance int
+	}
+	// Features toggles and settings of optional behaviour
+	Features struct {
+		ListenAddr      string
+		ActivityRoutes  string
+		ReplyOverflow   string
+		WelcomeTemplate string
+		RetentionPolicy string
+		RetentionDryRun bool
+		LogLevel        string
+		// LogHashSalt salt of the sender hashes in logs
+		LogHashSalt       string
+		Metrics           bool
+		TraceExporter     string
+		XRayDaemonAddress string
+	}
+	// Config everything the lambdas are configured with
+	Config struct {
+		// Lambda name of the function, the name given to Load outside lambda
+		Lambda string
+		// Region of the tables, bucket and queues
+		Region string
+		// RekognitionRegion Rekognition is not offered in every region
+		RekognitionRegion string
+		Twitter           Twitter
+		Tables            Tables
+		Pictures          Pictures
+		EventSink         eventsink.Config
+		Thresholds        Thresholds
+		Features          Features
+
+		// values non-empty values by key, for Require
+		values map[string]string
+	}
+)
+
+// Source looks up configuration values by key
+type Source interface {
+	Lookup(key string) (string, bool)
+}
+
+// Env the process environment
+type Env struct{}
+
+// Lookup implements Source.
+func (Env) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// Map values by key, as read from a file or SSM
+type Map map[string]string
+
+// Lookup implements Source.
+func (m Map) Lookup(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// FromEnv loads the configuration of lambda name from the environment, the
+// CONFIG_FILE and the CONFIG_SSM_PATH, in that order of precedence.
+func FromEnv(name string) (Config, error) {
+	sources := []Source{Env{}}
+	if path := os.Getenv(KeyFile); path != "" {
+		m, err := ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		sources = append(sources, m)
+	}
+	if path := os.Getenv(KeySSMPath); path != "" {
+		region := os.Getenv(KeyRegion)
+		if region == "" {
+			region = endpoints.EuNorth1RegionID
+		}
+		m, err := ReadSSM(ssm.New(session.New(&aws.Config{Region: aws.String(region)})), path)
+		if err != nil {
+			return Config{}, err
+		}
+		sources = append(sources, m)
+	}
+	return Load(name, sources)
+}
+
+// Load reads the configuration from sources, a value is taken from the
+// first source having it set, an empty value falls through to the next
+// source. Every invalid value is reported in the one error.
+func Load(name string, sources []Source) (Config, error) {
+	l := &loader{sources: sources, values: make(map[string]string)}
+
+	c := Config{
+		Lambda:            l.string(KeyFunctionName, name),
+		Region:            l.string(KeyRegion, endpoints.EuNorth1RegionID),
+		RekognitionRegion: l.string(KeyRekognitionRegion, endpoints.EuWest1RegionID),
+		Twitter: Twitter{
+			ConsumerKey:        l.string(KeyConsumerKey, ""),
+			ConsumerSecret:     l.string(KeyConsumerSecret, ""),
+			OAuthToken:         l.string(KeyOAuthToken, ""),
+			OAuthSecret:        l.string(KeyOAuthSecret, ""),
+			DefaultAccountID:   l.string(KeyDefaultAccountID, ""),
+			BearerToken:        l.string(KeyBearerToken, ""),
+			AccountActivityEnv: l.string(KeyAccountActivityEnv, ""),
+		},
+		Tables: Tables{
+			Accounts:       l.string(KeyAccountsTable, ""),
+			Conversation:   l.string(KeyConversationTable, ""),
+			PictureIndex:   l.string(KeyPictureIndexTable, ""),
+			PerceptualHash: l.string(KeyPHashTable, ""),
+			RateLimit:      l.string(KeyRateLimitTable, ""),
+			Outbox:         l.string(KeyOutboxTable, ""),
+			Welcome:        l.string(KeyWelcomeTable, ""),
+			Audit:          l.string(KeyAuditTable, ""),
+		},
+		Pictures: Pictures{
+			Bucket: l.string(KeyPictureBucket, ""),
+			Config: picturestore.Config{
+				Encryption: l.oneOf(KeyPictureEncryption, "", picturestore.EncryptionNone, picturestore.EncryptionSSEKMS, picturestore.EncryptionEnvelope),
+				KMSKeyID:   l.string(KeyPictureKMSKeyID, ""),
+			},
+			Blocklist: l.blocklist(KeyPHashBlocklist),
+		},
+		EventSink: eventsink.Config{
+			Kind:            l.oneOf(KeyEventSink, "", eventsink.KindStepFunctions, eventsink.KindSQS, eventsink.KindEventBridge, eventsink.KindLocal),
+			StateMachineARN: l.string(KeyStateMachineARN, ""),
+			QueueURL:        l.string(KeyQueueURL, ""),
+			EventSource:     l.string(KeyEventSource, ""),
+		},
+		Thresholds: Thresholds{
+			OutboxBatchSize:  l.positive(KeyOutboxBatchSize, 50),
+			MaxPictureBytes:  l.positive(KeyMaxPictureBytes, maxImageBytes),
+			MaxLabels:        l.positive(KeyMaxLabels, 10),
+			MinConfidence:    l.positive(KeyMinConfidence, 70),
+			PHashMaxDistance: l.positive(KeyPHashMaxDistance, 3),
+		},
+		Features: Features{
+			ListenAddr:        l.string(KeyListenAddr, ""),
+			ActivityRoutes:    l.string(KeyActivityRoutes, ""),
+			ReplyOverflow:     l.oneOf(KeyReplyOverflow, "split", "split", "truncate"),
+			WelcomeTemplate:   l.string(KeyWelcomeTemplate, ""),
+			RetentionPolicy:   l.string(KeyRetentionPolicy, ""),
+			RetentionDryRun:   l.bool(KeyRetentionDryRun, false),
+			LogLevel:          l.oneOf(KeyLogLevel, "info", "debug", "info", "warn", "error"),
+			LogHashSalt:       l.string(KeyLogHashSalt, ""),
+			Metrics:           l.oneOf(KeyMetrics, "on", "on", "off") == "on",
+			TraceExporter:     l.oneOf(KeyTraceExporter, "off", "off", "stdout", "xray"),
+			XRayDaemonAddress: l.string(KeyXRayDaemonAddress, ""),
+		},
+	}
+	if c.Thresholds.MinConfidence > 100 {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s %d is not a percentage", KeyMinConfidence, c.Thresholds.MinConfidence))
+	}
+	if c.Thresholds.MaxPictureBytes > maxImageBytes {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s %d is more than %d", KeyMaxPictureBytes, c.Thresholds.MaxPictureBytes, maxImageBytes))
+	}
+	if max := phashindex.Bands - 1; c.Thresholds.PHashMaxDistance > max {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s %d is more than %d", KeyPHashMaxDistance, c.Thresholds.PHashMaxDistance, max))
+	}
+	if len(l.invalid) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration: %s", strings.Join(l.invalid, "; "))
+	}
+
+	c.values = l.values
+	return c, nil
+}
+
+// Require returns an error naming every key of keys that is not set.
+func (c Config) Require(keys ...string) error {
+	missing := make([]string, 0)
+	for _, key := range keys {
+		if c.values[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("invalid configuration: missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type loader struct {
+	sources []Source
+	values  map[string]string
+	invalid []string
+}
+
+// lookup returns the first non-empty value of key. A variable declared
+// empty, as sam.yaml does for optional parameters, does not shadow the file
+// or SSM.
+func (l *loader) lookup(key string) (string, bool) {
+	for _, s := range l.sources {
+		if v, ok := s.Lookup(key); ok && v != "" {
+			l.values[key] = v
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (l *loader) string(key string, def string) string {
+	if v, _ := l.lookup(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// oneOf returns the value of key, one of allowed. An empty def makes the
+// key optional.
+func (l *loader) oneOf(key string, def string, allowed ...string) string {
+	v := l.string(key, def)
+	if v == "" {
+		return v
+	}
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	l.invalid = append(l.invalid, fmt.Sprintf("%s %q is not one of %s", key, v, strings.Join(allowed, ", ")))
+	return def
+}
+
+func (l *loader) positive(key string, def int) int {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s %q is not a positive number", key, v))
+		return def
+	}
+	return n
+}
+
+func (l *loader) blocklist(key string) phash.Blocklist {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return nil
+	}
+	list, err := phash.ParseBlocklist(v)
+	if err != nil {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s: %v", key, err))
+		return nil
+	}
+	return list
+}
+
+func (l *loader) bool(key string, def bool) bool {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.invalid = append(l.invalid, fmt.Sprintf("%s %q is not true or false", key, v))
+		return def
+	}
+	return b
+}
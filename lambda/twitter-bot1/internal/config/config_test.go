@@ -0,0 +1,162 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+func TestLoad(t *testing.T) {
+	tt := []struct {
+		name     string
+		sources  []Source
+		required []string
+		check    func(c Config) bool
+		err      string
+	}{
+		{
+			name:    "defaults",
+			sources: []Source{Map{}},
+			check: func(c Config) bool {
+				return c.Lambda == "twitter-reply" && c.Region == "eu-north-1" && c.RekognitionRegion == "eu-west-1" &&
+					c.Thresholds.OutboxBatchSize == 50 && c.Thresholds.MaxPictureBytes == 5<<20 && c.Thresholds.PHashMaxDistance == 3 &&
+					c.Features.ReplyOverflow == "split" && c.Features.Metrics && c.Features.TraceExporter == "off"
+			},
+		},
+		{
+			name: "firstSourceWins",
+			sources: []Source{
+				Map{KeyConsumerKey: "from-env", KeyFunctionName: "twitter-reply-prod"},
+				Map{KeyConsumerKey: "from-file", KeyPictureBucket: "pictures"},
+			},
+			required: []string{KeyConsumerKey, KeyPictureBucket},
+			check: func(c Config) bool {
+				return c.Twitter.ConsumerKey == "from-env" && c.Pictures.Bucket == "pictures" && c.Lambda == "twitter-reply-prod"
+			},
+		},
+		{
+			name: "emptyFallsThrough",
+			sources: []Source{
+				Map{KeyConsumerSecret: "", KeyLogHashSalt: ""},
+				Map{KeyConsumerSecret: "from-ssm", KeyLogHashSalt: "salt"},
+			},
+			required: []string{KeyConsumerSecret},
+			check: func(c Config) bool {
+				return c.Twitter.ConsumerSecret == "from-ssm" && c.Features.LogHashSalt == "salt"
+			},
+		},
+		{
+			name: "typedValues",
+			sources: []Source{Map{
+				KeyRetentionDryRun:   "true",
+				KeyMinConfidence:     "85",
+				KeyMetrics:           "off",
+				KeyPictureEncryption: "envelope",
+				KeyEventSink:         "sqs",
+				KeyPHashBlocklist:    "00000000000000ff,0f0f0f0f0f0f0f0f",
+			}},
+			check: func(c Config) bool {
+				return c.Features.RetentionDryRun && c.Thresholds.MinConfidence == 85 && !c.Features.Metrics &&
+					c.Pictures.Encryption == "envelope" && c.EventSink.Kind == "sqs" && len(c.Pictures.Blocklist) == 2
+			},
+		},
+		{
+			name:     "missing",
+			sources:  []Source{Map{KeyConsumerKey: ""}},
+			required: []string{KeyConsumerKey, KeyPictureBucket},
+			err:      "invalid configuration: missing CONSUMER_KEY, PICTURE_BUCKET",
+		},
+		{
+			name: "invalid",
+			sources: []Source{Map{
+				KeyOutboxBatchSize:  "ten",
+				KeyReplyOverflow:    "wrap",
+				KeyMinConfidence:    "120",
+				KeyPHashBlocklist:   "00ff",
+				KeyPHashMaxDistance: "8",
+				KeyMaxPictureBytes:  "8388608",
+			}},
+			required: []string{KeyOAuthToken},
+			err:      `invalid configuration: PHASH_BLOCKLIST: perceptual hash "00ff" is not 16 hex digits; OUTBOX_BATCH_SIZE "ten" is not a positive number; REPLY_OVERFLOW "wrap" is not one of split, truncate; MIN_LABEL_CONFIDENCE 120 is not a percentage; MAX_PICTURE_BYTES 8388608 is more than 5242880; PHASH_MAX_DISTANCE 8 is more than 3`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Load("twitter-reply", tc.sources)
+			if err == nil {
+				err = c.Require(tc.required...)
+			}
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got: %v, wanted: %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got: %v, wanted: no error", err)
+			}
+			if !tc.check(c) {
+				t.Fatalf("got: %+v, wanted: %s to hold", c, tc.name)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# self-hosted bot\nCONSUMER_KEY=abc\n\nWELCOME_TEMPLATE=\"Hi {{.ScreenName}}!\"\nLISTEN_ADDR = :8080\n")
+	f.Close()
+
+	got, err := ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("got: %v, wanted: no error", err)
+	}
+	want := Map{
+		KeyConsumerKey:     "abc",
+		KeyWelcomeTemplate: "Hi {{.ScreenName}}!",
+		KeyListenAddr:      ":8080",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got: %v, wanted: %v", got, want)
+	}
+}
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	pages [][]*ssm.Parameter
+}
+
+func (f *fakeSSM) GetParametersByPathPages(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+	for i, p := range f.pages {
+		if !fn(&ssm.GetParametersByPathOutput{Parameters: p}, i == len(f.pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestReadSSM(t *testing.T) {
+	svc := &fakeSSM{pages: [][]*ssm.Parameter{
+		{{Name: aws.String("/twitter-bot1/CONSUMER_SECRET_KEY"), Value: aws.String("s3cr3t")}},
+		{{Name: aws.String("/twitter-bot1/PICTURE_BUCKET"), Value: aws.String("pictures")}},
+	}}
+
+	got, err := ReadSSM(svc, "/twitter-bot1")
+	if err != nil {
+		t.Fatalf("got: %v, wanted: no error", err)
+	}
+	want := Map{KeyConsumerSecret: "s3cr3t", KeyPictureBucket: "pictures"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got: %v, wanted: %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// ReadFile reads a file of KEY=value lines. Blank lines and lines starting
+// with # are skipped, values may be quoted.
+func ReadFile(name string) (Map, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %v", err)
+	}
+	defer f.Close()
+
+	m := make(Map)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("config file %s line %d: want KEY=value", name, n)
+		}
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		m[strings.TrimSpace(line[:i])] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read config file: %v", err)
+	}
+	return m, nil
+}
+
+// ReadSSM reads the parameters directly under path, decrypting SecureStrings.
+// The key of a parameter is the last element of its name.
+func ReadSSM(ssmSvc ssmiface.SSMAPI, ssmPath string) (Map, error) {
+	m := make(Map)
+	err := ssmSvc.GetParametersByPathPages(&ssm.GetParametersByPathInput{
+		Path:           aws.String(ssmPath),
+		WithDecryption: aws.Bool(true),
+	}, func(out *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, p := range out.Parameters {
+			m[path.Base(aws.StringValue(p.Name))] = aws.StringValue(p.Value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read config from ssm %s: %v", ssmPath, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,202 @@
+// Package conversation keeps per sender state between direct messages so the
+// bot can answer follow-up questions about earlier pictures. A sender has a
+// separate conversation with each bot account.
+package conversation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// MaxMessages number of recent messages kept per sender
+const MaxMessages = 20
+
+// TTL how long a conversation is kept after the last message
+const TTL = 30 * 24 * time.Hour
+
+// maxSaveAttempts puts tried by Save before giving up on conflicts
+const maxSaveAttempts = 3
+
+// ErrConflict returned by Store.Put when the state was changed since it was
+// read
+var ErrConflict = errors.New("conversation changed since it was read")
+
+type (
+	// Message a direct message to or from the bot
+	Message struct {
+		ID              string `json:"id,omitempty"`
+		CreateTimestamp int64  `json:"create_timestamp"`
+		Text            string `json:"text,omitempty"`
+		MediaID         string `json:"media_id,omitempty"`
+		FromBot         bool   `json:"from_bot,omitempty"`
+		// InReplyTo id of the message a bot message answers
+		InReplyTo string `json:"in_reply_to,omitempty"`
+	}
+	// Face one face of an analysed picture
+	Face struct {
+		AgeLow  int64  `json:"age_low"`
+		AgeHigh int64  `json:"age_high"`
+		Gender  string `json:"gender"`
+		Emotion string `json:"emotion"`
+		Box     *Box   `json:"box,omitempty"`
+	}
+	// Box where a face is in the picture, as ratios of the picture's width
+	// and height like rekognition's BoundingBox
+	Box struct {
+		Left   float64 `json:"left"`
+		Top    float64 `json:"top"`
+		Width  float64 `json:"width"`
+		Height float64 `json:"height"`
+	}
+	// Analysis result of the last analysed picture
+	Analysis struct {
+		MediaID  string `json:"media_id"`
+		S3bucket string `json:"s3_bucket,omitempty"`
+		S3path   string `json:"s3_path,omitempty"`
+		// Checksum hex SHA-256 of the picture, the key of its cached analyses
+		Checksum string `json:"sha256,omitempty"`
+		// SimilarTo checksum of a near-duplicate picture analysed before
+		SimilarTo       string `json:"similar_to,omitempty"`
+		CreateTimestamp int64  `json:"create_timestamp"`
+		Faces           []Face `json:"faces"`
+	}
+	// Pending a multi-step interaction waiting for the sender's answer
+	Pending struct {
+		Action    string            `json:"action"`
+		Data      map[string]string `json:"data,omitempty"`
+		ExpiresAt int64             `json:"expires_at"`
+	}
+	// State everything a bot account remembers about one sender
+	State struct {
+		ForUserID    string      `json:"for_user_id"`
+		SenderID     string      `json:"sender_id"`
+		Messages     []Message   `json:"messages"`
+		LastAnalysis *Analysis   `json:"last_analysis,omitempty"`
+		Preferences  Preferences `json:"preferences"`
+		Pending      *Pending    `json:"pending,omitempty"`
+		UpdatedAt    int64       `json:"updated_at"`
+		ExpiresAt    int64       `json:"expires_at"`
+		// Version counts the puts, a put of a state read at an older
+		// version fails with ErrConflict
+		Version int64 `json:"version"`
+	}
+)
+
+// Store persists State per bot account and sender
+type Store interface {
+	// Get returns the state of senderID's conversation with the account
+	// forUserID, a new empty State when the sender is unknown.
+	Get(ctx context.Context, forUserID string, senderID string) (State, error)
+	// Put saves state, replacing what was stored for state.ForUserID and
+	// state.SenderID. It returns ErrConflict when the stored state is no
+	// longer the version state was read at.
+	Put(ctx context.Context, state State) error
+	// Delete forgets everything the account forUserID knows about senderID.
+	Delete(ctx context.Context, forUserID string, senderID string) error
+	// Senders returns the senders the account forUserID has a conversation
+	// or preferences of.
+	Senders(ctx context.Context, forUserID string) ([]string, error)
+}
+
+// Save puts state, which was read as base. When the conversation was
+// changed by someone else in between, the changes from base to state are
+// applied to the stored state and that is put instead: the messages of both
+// are kept, other fields changed from base are taken from state.
+func Save(ctx context.Context, store Store, base, state State) error {
+	for attempt := 1; ; attempt++ {
+		err := store.Put(ctx, state)
+		if err != ErrConflict || attempt == maxSaveAttempts {
+			return err
+		}
+		latest, err := store.Get(ctx, state.ForUserID, state.SenderID)
+		if err != nil {
+			return err
+		}
+		state, base = rebase(latest, base, state), latest.Copy()
+	}
+}
+
+// rebase returns latest with the changes from base to state.
+func rebase(latest, base, state State) State {
+	merged := latest.Copy()
+	for _, m := range state.Messages {
+		if !base.hasMessage(m) && !merged.hasMessage(m) {
+			merged.AddMessage(m)
+		}
+	}
+	if !reflect.DeepEqual(state.LastAnalysis, base.LastAnalysis) {
+		merged.LastAnalysis = state.LastAnalysis
+	}
+	if state.Preferences != base.Preferences {
+		merged.Preferences = state.Preferences
+	}
+	if !reflect.DeepEqual(state.Pending, base.Pending) {
+		merged.Pending = state.Pending
+	}
+	return merged
+}
+
+// Copy returns a copy of s that shares nothing changed through s's methods
+// or by the reply actions.
+func (s State) Copy() State {
+	c := s
+	c.Messages = append([]Message(nil), s.Messages...)
+	if s.LastAnalysis != nil {
+		a := *s.LastAnalysis
+		a.Faces = append([]Face(nil), a.Faces...)
+		c.LastAnalysis = &a
+	}
+	if s.Pending != nil {
+		p := *s.Pending
+		p.Data = make(map[string]string, len(s.Pending.Data))
+		for k, v := range s.Pending.Data {
+			p.Data[k] = v
+		}
+		c.Pending = &p
+	}
+	return c
+}
+
+func (s *State) hasMessage(m Message) bool {
+	for _, v := range s.Messages {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMessage appends m keeping at most MaxMessages of the most recent messages.
+func (s *State) AddMessage(m Message) {
+	s.Messages = append(s.Messages, m)
+	if len(s.Messages) > MaxMessages {
+		s.Messages = append([]Message(nil), s.Messages[len(s.Messages)-MaxMessages:]...)
+	}
+}
+
+// RepliesTo returns the ids of the bot's messages answering message id.
+func (s *State) RepliesTo(id string) []string {
+	var ids []string
+	for _, m := range s.Messages {
+		if m.FromBot && m.InReplyTo == id && m.ID != "" {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+// PendingAction returns the pending interaction unless it has expired at now.
+func (s *State) PendingAction(now time.Time) *Pending {
+	if s.Pending == nil || now.Unix() >= s.Pending.ExpiresAt {
+		return nil
+	}
+	return s.Pending
+}
+
+// touch sets the update and expiry times before the state is stored.
+func (s *State) touch(now time.Time) {
+	s.UpdatedAt = now.Unix()
+	s.ExpiresAt = now.Add(TTL).Unix()
+}
@@ -0,0 +1,235 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBStore keeps one item per sender of each bot account in a table with
+// the string partition key for_user_id and the string sort key sender_id.
+// expires_at can be enabled as the table's TTL
+// attribute to let DynamoDB remove abandoned conversations. Preferences are
+// kept in a second item without expires_at, they outlive the conversation.
+type DynamoDBStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBStore returns a store using table.
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client: client,
+		table:  table,
+	}
+}
+
+// Get implements Store.
+func (d *DynamoDBStore) Get(ctx context.Context, forUserID string, senderID string) (State, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            senderKey(forUserID, senderID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return State{}, fmt.Errorf("get conversation: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return d.withPreferences(ctx, State{ForUserID: forUserID, SenderID: senderID})
+	}
+
+	var state State
+	if err := dynamodbattribute.UnmarshalMap(out.Item, &state); err != nil {
+		return State{}, fmt.Errorf("unmarshal conversation: %v", err)
+	}
+	if state.ExpiresAt != 0 && time.Now().Unix() >= state.ExpiresAt {
+		// the item is still there until the TTL removes it, its version
+		// is kept for the next put
+		state = State{ForUserID: forUserID, SenderID: senderID, Version: state.Version}
+	}
+	return d.withPreferences(ctx, state)
+}
+
+// withPreferences sets the preferences stored for state's sender. States
+// stored before preferences had their own item keep theirs.
+func (d *DynamoDBStore) withPreferences(ctx context.Context, state State) (State, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            senderKey(state.ForUserID, preferencesID(state.SenderID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return State{}, fmt.Errorf("get preferences: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return state, nil
+	}
+
+	var item preferencesItem
+	if err := dynamodbattribute.UnmarshalMap(out.Item, &item); err != nil {
+		return State{}, fmt.Errorf("unmarshal preferences: %v", err)
+	}
+	state.Preferences = item.Preferences
+	return state, nil
+}
+
+// Put implements Store.
+func (d *DynamoDBStore) Put(ctx context.Context, state State) error {
+	state.touch(time.Now())
+	read := state.Version
+	state.Version++
+	item, err := dynamodbattribute.MarshalMap(state)
+	if err != nil {
+		return fmt.Errorf("marshal conversation: %v", err)
+	}
+	delete(item, "preferences")
+
+	// items stored before versions were counted have no version
+	put := &dynamodb.Put{
+		TableName:           aws.String(d.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(version)"),
+	}
+	if read > 0 {
+		put.ConditionExpression = aws.String("version = :version")
+		put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":version": {N: aws.String(strconv.FormatInt(read, 10))},
+		}
+	}
+
+	preferences := &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String(d.table),
+			Key:       senderKey(state.ForUserID, preferencesID(state.SenderID)),
+		},
+	}
+	if state.Preferences != (Preferences{}) {
+		prefsItem, err := dynamodbattribute.MarshalMap(preferencesItem{
+			ForUserID:   state.ForUserID,
+			SenderID:    preferencesID(state.SenderID),
+			Preferences: state.Preferences,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal preferences: %v", err)
+		}
+		preferences = &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String(d.table),
+				Item:      prefsItem,
+			},
+		}
+	}
+
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: put},
+			preferences,
+		},
+	})
+	if isConflict(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("put conversation: %v", err)
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (d *DynamoDBStore) Delete(ctx context.Context, forUserID string, senderID string) error {
+	for _, id := range []string{senderID, preferencesID(senderID)} {
+		_, err := d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(d.table),
+			Key:       senderKey(forUserID, id),
+		})
+		if err != nil {
+			return fmt.Errorf("delete conversation: %v", err)
+		}
+	}
+	return nil
+}
+
+// Senders implements Store.
+func (d *DynamoDBStore) Senders(ctx context.Context, forUserID string) ([]string, error) {
+	seen := make(map[string]bool)
+	senders := make([]string, 0)
+	var unmarshalErr error
+	err := d.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		KeyConditionExpression: aws.String("for_user_id = :account"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":account": {S: aws.String(forUserID)},
+		},
+		ProjectionExpression: aws.String("sender_id"),
+		ConsistentRead:       aws.Bool(true),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var key struct {
+				SenderID string `json:"sender_id"`
+			}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &key); unmarshalErr != nil {
+				return false
+			}
+			senderID := strings.TrimPrefix(key.SenderID, preferencesID(""))
+			if !seen[senderID] {
+				seen[senderID] = true
+				senders = append(senders, senderID)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query conversations: %v", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("unmarshal conversation: %v", unmarshalErr)
+	}
+	return senders, nil
+}
+
+// isConflict reports whether err is the version condition failing or
+// another transaction writing the conversation at the same time.
+func isConflict(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case dynamodb.ErrCodeTransactionConflictException:
+		return true
+	case dynamodb.ErrCodeTransactionCanceledException:
+		// the SDK does not decode the cancellation reasons, they are
+		// listed in the message
+		return strings.Contains(aerr.Message(), "ConditionalCheckFailed") ||
+			strings.Contains(aerr.Message(), "TransactionConflict")
+	}
+	return false
+}
+
+// preferencesItem the item keeping a sender's preferences
+type preferencesItem struct {
+	ForUserID   string      `json:"for_user_id"`
+	SenderID    string      `json:"sender_id"`
+	Preferences Preferences `json:"preferences"`
+}
+
+// preferencesID the sender_id of the item keeping senderID's preferences,
+// twitter user ids are numeric so it does not collide with a sender's
+func preferencesID(senderID string) string {
+	return "preferences#" + senderID
+}
+
+func senderKey(forUserID string, senderID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"for_user_id": {S: aws.String(forUserID)},
+		"sender_id":   {S: aws.String(senderID)},
+	}
+}
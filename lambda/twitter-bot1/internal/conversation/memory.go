@@ -0,0 +1,110 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps conversations in memory. It is used for tests and when
+// the bot is self-hosted without DynamoDB.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[memoryKey][]byte
+	// preferences do not expire with the state
+	preferences map[memoryKey]Preferences
+}
+
+type memoryKey struct {
+	forUserID string
+	senderID  string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states:      make(map[memoryKey][]byte),
+		preferences: make(map[memoryKey]Preferences),
+	}
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(ctx context.Context, forUserID string, senderID string) (State, error) {
+	key := memoryKey{forUserID, senderID}
+	m.mu.Lock()
+	b, ok := m.states[key]
+	preferences := m.preferences[key]
+	m.mu.Unlock()
+	if !ok {
+		return State{ForUserID: forUserID, SenderID: senderID, Preferences: preferences}, nil
+	}
+
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return State{}, err
+	}
+	if state.ExpiresAt != 0 && time.Now().Unix() >= state.ExpiresAt {
+		state = State{ForUserID: forUserID, SenderID: senderID, Version: state.Version}
+	}
+	state.Preferences = preferences
+	return state, nil
+}
+
+// Put implements Store. The state is stored as a copy, later changes by the
+// caller are not visible to other callers.
+func (m *MemoryStore) Put(ctx context.Context, state State) error {
+	state.touch(time.Now())
+	state.Version++
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	key := memoryKey{state.ForUserID, state.SenderID}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stored State
+	if b, ok := m.states[key]; ok {
+		if err := json.Unmarshal(b, &stored); err != nil {
+			return err
+		}
+	}
+	if stored.Version != state.Version-1 {
+		return ErrConflict
+	}
+	m.states[key] = b
+	m.preferences[key] = state.Preferences
+	return nil
+}
+
+// Senders implements Store. Senders are sorted.
+func (m *MemoryStore) Senders(ctx context.Context, forUserID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[string]bool)
+	for key := range m.states {
+		seen[key.senderID] = seen[key.senderID] || key.forUserID == forUserID
+	}
+	for key := range m.preferences {
+		seen[key.senderID] = seen[key.senderID] || key.forUserID == forUserID
+	}
+	senders := make([]string, 0)
+	for senderID, ok := range seen {
+		if ok {
+			senders = append(senders, senderID)
+		}
+	}
+	sort.Strings(senders)
+	return senders, nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(ctx context.Context, forUserID string, senderID string) error {
+	key := memoryKey{forUserID, senderID}
+	m.mu.Lock()
+	delete(m.states, key)
+	delete(m.preferences, key)
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,126 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	state, err := store.Get(ctx, "4337869213", "alice")
+	if err != nil {
+		t.Fatalf("Get failed with error: %v", err)
+	}
+	if state.SenderID != "alice" || len(state.Messages) != 0 {
+		t.Fatalf("got: %+v, wanted empty state for alice", state)
+	}
+
+	state.AddMessage(Message{ID: "1", Text: "hello"})
+	state.LastAnalysis = &Analysis{MediaID: "m1", Faces: []Face{{Gender: "Female"}, {Gender: "Male"}}}
+	if err := store.Put(ctx, state); err != nil {
+		t.Fatalf("Put failed with error: %v", err)
+	}
+	state.LastAnalysis.Faces[1].Gender = "changed after put"
+
+	got, err := store.Get(ctx, "4337869213", "alice")
+	if err != nil {
+		t.Fatalf("Get failed with error: %v", err)
+	}
+	if len(got.Messages) != 1 || got.LastAnalysis == nil || got.LastAnalysis.Faces[1].Gender != "Male" {
+		t.Fatalf("got: %+v, wanted stored message and analysis", got)
+	}
+	if other, _ := store.Get(ctx, "783214", "alice"); other.LastAnalysis != nil {
+		t.Fatalf("got: %+v for another account, wanted empty state", other)
+	}
+
+	if err := store.Delete(ctx, "4337869213", "alice"); err != nil {
+		t.Fatalf("Delete failed with error: %v", err)
+	}
+	got, _ = store.Get(ctx, "4337869213", "alice")
+	if got.LastAnalysis != nil {
+		t.Fatalf("got: %+v after delete, wanted empty state", got)
+	}
+}
+
+func TestAddMessageKeepsMostRecent(t *testing.T) {
+	var state State
+	for i := 0; i < MaxMessages+5; i++ {
+		state.AddMessage(Message{ID: fmt.Sprintf("%d", i)})
+	}
+	if len(state.Messages) != MaxMessages {
+		t.Fatalf("got: %v messages, wanted: %v", len(state.Messages), MaxMessages)
+	}
+	if state.Messages[0].ID != "5" {
+		t.Fatalf("got oldest message: %v, wanted: 5", state.Messages[0].ID)
+	}
+}
+
+func TestPendingAction(t *testing.T) {
+	now := time.Now()
+	state := State{Pending: &Pending{Action: "confirm", ExpiresAt: now.Add(time.Minute).Unix()}}
+	if state.PendingAction(now) == nil {
+		t.Fatalf("got no pending action, wanted confirm")
+	}
+	if state.PendingAction(now.Add(2*time.Minute)) != nil {
+		t.Fatalf("got pending action after expiry, wanted none")
+	}
+}
+
+func TestPreferencesOutliveState(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	state := State{ForUserID: "4337869213", SenderID: "alice", Preferences: Preferences{Retention: RetentionOff}}
+	state.AddMessage(Message{ID: "1", Text: "set retention off"})
+	if err := store.Put(ctx, state); err != nil {
+		t.Fatalf("Put failed with error: %v", err)
+	}
+
+	// the conversation expires
+	expired := state
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	b, _ := json.Marshal(expired)
+	store.states[memoryKey{"4337869213", "alice"}] = b
+
+	got, err := store.Get(ctx, "4337869213", "alice")
+	if err != nil {
+		t.Fatalf("Get failed with error: %v", err)
+	}
+	if len(got.Messages) != 0 || got.Preferences.Retention != RetentionOff {
+		t.Fatalf("got: %+v, wanted no messages and retention off", got)
+	}
+}
+
+func TestSaveConflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Put(ctx, State{ForUserID: "4337869213", SenderID: "alice", Preferences: Preferences{Language: "sv"}})
+
+	// a reply reads the conversation
+	base, _ := store.Get(ctx, "4337869213", "alice")
+	state := base.Copy()
+	state.AddMessage(Message{ID: "2", Text: "picture", CreateTimestamp: 2})
+	state.LastAnalysis = &Analysis{MediaID: "m2"}
+
+	// the outbox remembers a message sent in between
+	other, _ := store.Get(ctx, "4337869213", "alice")
+	other.AddMessage(Message{ID: "1", FromBot: true, CreateTimestamp: 1})
+	if err := store.Put(ctx, other); err != nil {
+		t.Fatalf("Put failed with error: %v", err)
+	}
+
+	if err := store.Put(ctx, state); err != ErrConflict {
+		t.Fatalf("got: %v, wanted: %v", err, ErrConflict)
+	}
+	if err := Save(ctx, store, base, state); err != nil {
+		t.Fatalf("Save failed with error: %v", err)
+	}
+	got, _ := store.Get(ctx, "4337869213", "alice")
+	if len(got.Messages) != 2 || got.LastAnalysis == nil || got.LastAnalysis.MediaID != "m2" || got.Preferences.Language != "sv" {
+		t.Fatalf("got: %+v, wanted both messages, the new analysis and the preferences", got)
+	}
+}
@@ -0,0 +1,90 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Preference names and values
+const (
+	PreferenceLanguage  = "language"
+	PreferenceDetails   = "details"
+	PreferenceRetention = "retention"
+
+	DetailsFull    = "full"
+	DetailsMinimal = "minimal"
+
+	RetentionOn  = "on"
+	RetentionOff = "off"
+
+	DefaultLanguage = "en"
+)
+
+// Languages the bot can reply in
+var Languages = []string{"en", "sv", "de"}
+
+// Preferences set by the sender with "set <name> <value>" commands. Empty
+// fields mean the default is used.
+type Preferences struct {
+	// Language of the replies
+	Language string `json:"language,omitempty"`
+	// Details full replies include age and gender, minimal only the emotion
+	Details string `json:"details,omitempty"`
+	// Retention off deletes pictures as soon as they are analysed
+	Retention string `json:"retention,omitempty"`
+}
+
+// WithDefaults returns p with unset preferences replaced by their defaults.
+func (p Preferences) WithDefaults() Preferences {
+	if p.Language == "" {
+		p.Language = DefaultLanguage
+	}
+	if p.Details == "" {
+		p.Details = DetailsFull
+	}
+	if p.Retention == "" {
+		p.Retention = RetentionOn
+	}
+	return p
+}
+
+// RetainPictures reports whether pictures and analyses may be kept after the
+// reply is sent.
+func (p Preferences) RetainPictures() bool {
+	return p.WithDefaults().Retention == RetentionOn
+}
+
+// Set validates value and sets the preference name to it.
+func (p *Preferences) Set(name string, value string) error {
+	name = strings.ToLower(name)
+	value = strings.ToLower(value)
+	switch name {
+	case PreferenceLanguage:
+		if !oneOf(value, Languages...) {
+			return fmt.Errorf("language must be one of %s", strings.Join(Languages, ", "))
+		}
+		p.Language = value
+	case PreferenceDetails:
+		if !oneOf(value, DetailsFull, DetailsMinimal) {
+			return fmt.Errorf("details must be %s or %s", DetailsFull, DetailsMinimal)
+		}
+		p.Details = value
+	case PreferenceRetention:
+		if !oneOf(value, RetentionOn, RetentionOff) {
+			return fmt.Errorf("retention must be %s or %s", RetentionOn, RetentionOff)
+		}
+		p.Retention = value
+	default:
+		return fmt.Errorf("unknown setting %q, use %s, %s or %s", name, PreferenceLanguage, PreferenceDetails, PreferenceRetention)
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package conversation
+
+import (
+	"testing"
+)
+
+func TestPreferencesSet(t *testing.T) {
+	tt := []struct {
+		name    string
+		pref    string
+		value   string
+		wantErr bool
+		want    Preferences
+	}{
+		{name: "language", pref: "language", value: "SV", want: Preferences{Language: "sv"}},
+		{name: "unsupportedLanguage", pref: "language", value: "fr", wantErr: true},
+		{name: "details", pref: "details", value: "minimal", want: Preferences{Details: DetailsMinimal}},
+		{name: "retention", pref: "retention", value: "off", want: Preferences{Retention: RetentionOff}},
+		{name: "unknown", pref: "colour", value: "blue", wantErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var p Preferences
+			err := p.Set(tc.pref, tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.wantErr)
+			}
+			if p != tc.want {
+				t.Fatalf("got: %+v, wanted: %+v", p, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetainPicturesDefault(t *testing.T) {
+	if !(Preferences{}).RetainPictures() {
+		t.Fatalf("got retention off by default, wanted on")
+	}
+	if (Preferences{Retention: RetentionOff}).RetainPictures() {
+		t.Fatalf("got retention on, wanted off")
+	}
+}
@@ -0,0 +1,29 @@
+package eventsink
+
+import (
+	"context"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// Channel hands events to an in-process consumer reading from a channel.
+type Channel struct {
+	events chan<- webhook.Event
+}
+
+// NewChannel returns a sink sending to events.
+func NewChannel(events chan<- webhook.Event) *Channel {
+	return &Channel{
+		events: events,
+	}
+}
+
+// Publish blocks until the consumer accepts event or ctx is done.
+func (c *Channel) Publish(ctx context.Context, event webhook.Event) error {
+	select {
+	case c.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+const (
+	// DefaultEventSource source of the events put on the bus
+	DefaultEventSource = "twitter-bot1.webhook"
+	// EventDetailType detail-type of the events put on the bus
+	EventDetailType = "Twitter Direct Message Event"
+	// maxPutEventsEntries entries PutEvents takes in one call
+	maxPutEventsEntries = 10
+)
+
+// EventBridge puts events on the default event bus. Rules on the bus decide
+// where they are delivered.
+type EventBridge struct {
+	client cloudwatcheventsiface.CloudWatchEventsAPI
+	source string
+}
+
+// NewEventBridge returns a sink putting events with source, DefaultEventSource
+// is used when source is empty.
+func NewEventBridge(client cloudwatcheventsiface.CloudWatchEventsAPI, source string) *EventBridge {
+	if source == "" {
+		source = DefaultEventSource
+	}
+	return &EventBridge{
+		client: client,
+		source: source,
+	}
+}
+
+// Publish puts one entry per sender so rules can match on a single sender,
+// in calls of at most ten entries.
+func (e *EventBridge) Publish(ctx context.Context, event webhook.Event) error {
+	entries := make([]*cloudwatchevents.PutEventsRequestEntry, 0)
+	for _, ev := range splitBySender(event) {
+		detail, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("marshal event: %v", err)
+		}
+		entries = append(entries, &cloudwatchevents.PutEventsRequestEntry{
+			Detail:     aws.String(string(detail)),
+			DetailType: aws.String(EventDetailType),
+			Source:     aws.String(e.source),
+		})
+	}
+
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > maxPutEventsEntries {
+			n = maxPutEventsEntries
+		}
+		if err := e.put(ctx, entries[:n]); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// put puts entries in one call, failed entries fail the call.
+func (e *EventBridge) put(ctx context.Context, entries []*cloudwatchevents.PutEventsRequestEntry) error {
+	out, err := e.client.PutEventsWithContext(ctx, &cloudwatchevents.PutEventsInput{
+		Entries: entries,
+	})
+	if err != nil {
+		return fmt.Errorf("put events: %v", err)
+	}
+	if aws.Int64Value(out.FailedEntryCount) > 0 {
+		for _, entry := range out.Entries {
+			if entry.ErrorCode != nil {
+				return fmt.Errorf("put events: %d entries failed, first with %s: %s",
+					aws.Int64Value(out.FailedEntryCount), aws.StringValue(entry.ErrorCode), aws.StringValue(entry.ErrorMessage))
+			}
+		}
+		return fmt.Errorf("put events: %d entries failed", aws.Int64Value(out.FailedEntryCount))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package eventsink contains the webhook.EventSink implementations intake can
+// publish normalized events to, and New which picks one from configuration.
+package eventsink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// Kinds of sinks New can build
+const (
+	KindStepFunctions = "stepfunctions"
+	KindSQS           = "sqs"
+	KindEventBridge   = "eventbridge"
+	KindLocal         = "local"
+)
+
+// Config selects the sink and carries the settings the sink needs.
+type Config struct {
+	// Kind one of the Kind constants. When empty the kind is inferred from
+	// which of StateMachineARN and QueueURL is set, falling back to local.
+	Kind            string
+	StateMachineARN string
+	QueueURL        string
+	EventSource     string
+}
+
+// New builds the sink described by cfg. AWS sinks use sess, local is returned
+// as is for KindLocal so the caller decides how events are consumed in-process.
+func New(cfg Config, sess client.ConfigProvider, local webhook.EventSink) (webhook.EventSink, error) {
+	kind := cfg.Kind
+	if kind == "" {
+		switch {
+		case cfg.StateMachineARN != "":
+			kind = KindStepFunctions
+		case cfg.QueueURL != "":
+			kind = KindSQS
+		default:
+			kind = KindLocal
+		}
+	}
+
+	switch kind {
+	case KindStepFunctions:
+		if cfg.StateMachineARN == "" {
+			return nil, fmt.Errorf("event sink %s requires STATE_MACHINE_ARN", kind)
+		}
+		return NewStepFunctions(sfn.New(sess), cfg.StateMachineARN), nil
+	case KindSQS:
+		if cfg.QueueURL == "" {
+			return nil, fmt.Errorf("event sink %s requires QUEUE_URL", kind)
+		}
+		return NewSQS(sqs.New(sess), cfg.QueueURL), nil
+	case KindEventBridge:
+		return NewEventBridge(cloudwatchevents.New(sess), cfg.EventSource), nil
+	case KindLocal:
+		if local == nil {
+			return nil, fmt.Errorf("event sink %s has no local consumer", kind)
+		}
+		return local, nil
+	}
+	return nil, fmt.Errorf("unknown event sink %q", kind)
+}
+
+// Func adapts an ordinary function to a webhook.EventSink.
+type Func func(ctx context.Context, event webhook.Event) error
+
+// Publish calls f(ctx, event).
+func (f Func) Publish(ctx context.Context, event webhook.Event) error {
+	return f(ctx, event)
+}
+
+// deduplicationID names the direct messages of event, the same for every
+// delivery of them. Twitter redelivers a webhook as a new request with a new
+// request id, only the DM event ids stay the same. A single message is named
+// by its id, several by a hash of their ids, both fit the 80 characters of an
+// execution name and the 128 of an SQS deduplication id.
+func deduplicationID(event webhook.Event) string {
+	if len(event.DirectMessageEvents) == 0 {
+		return ""
+	}
+	if len(event.DirectMessageEvents) == 1 {
+		return event.ForUserID + "-" + event.DirectMessageEvents[0].ID
+	}
+	ids := make([]string, 0, len(event.DirectMessageEvents))
+	for _, dm := range event.DirectMessageEvents {
+		ids = append(ids, dm.ID)
+	}
+	sum := sha256.Sum256([]byte(event.ForUserID + ":" + strings.Join(ids, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitBySender returns one event per sender, keeping the order of the
+// direct messages within each sender.
+func splitBySender(event webhook.Event) []webhook.Event {
+	index := make(map[string]int)
+	out := make([]webhook.Event, 0, 1)
+	for _, dm := range event.DirectMessageEvents {
+		i, ok := index[dm.SenderID]
+		if !ok {
+			i = len(out)
+			index[dm.SenderID] = i
+			out = append(out, webhook.Event{
+				RequestID: event.RequestID,
+				ForUserID: event.ForUserID,
+				Trace:     event.Trace,
+			})
+		}
+		out[i].DirectMessageEvents = append(out[i].DirectMessageEvents, dm)
+		if dm.MediaURL != "" {
+			out[i].PictureExists = true
+		}
+	}
+	if len(out) > 1 {
+		for i := range out {
+			out[i].RequestID = fmt.Sprintf("%s-%d", event.RequestID, i)
+		}
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	sent []*sqs.SendMessageInput
+}
+
+func (f *fakeSQS) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, input)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type fakeSFN struct {
+	sfniface.SFNAPI
+	names map[string]bool
+}
+
+func (f *fakeSFN) StartExecutionWithContext(ctx aws.Context, input *sfn.StartExecutionInput, opts ...request.Option) (*sfn.StartExecutionOutput, error) {
+	name := aws.StringValue(input.Name)
+	if f.names[name] {
+		return nil, awserr.New(sfn.ErrCodeExecutionAlreadyExists, "execution already exists", nil)
+	}
+	f.names[name] = true
+	return &sfn.StartExecutionOutput{}, nil
+}
+
+type fakeEventBridge struct {
+	cloudwatcheventsiface.CloudWatchEventsAPI
+	calls  []int
+	failed int64
+}
+
+func (f *fakeEventBridge) PutEventsWithContext(ctx aws.Context, input *cloudwatchevents.PutEventsInput, opts ...request.Option) (*cloudwatchevents.PutEventsOutput, error) {
+	if len(input.Entries) > 10 {
+		return nil, awserr.New("ValidationException", "too many entries", nil)
+	}
+	f.calls = append(f.calls, len(input.Entries))
+	out := &cloudwatchevents.PutEventsOutput{FailedEntryCount: aws.Int64(f.failed)}
+	for i := range input.Entries {
+		entry := &cloudwatchevents.PutEventsResultEntry{EventId: aws.String(fmt.Sprint(i))}
+		if int64(i) < f.failed {
+			entry = &cloudwatchevents.PutEventsResultEntry{ErrorCode: aws.String("InternalFailure")}
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return out, nil
+}
+
+func testEvent() webhook.Event {
+	return webhook.Event{
+		RequestID: "req",
+		ForUserID: "4337869213",
+		Trace:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		DirectMessageEvents: []webhook.DirectMessageEvent{
+			{ID: "1", SenderID: "alice"},
+			{ID: "2", SenderID: "bob", MediaURL: "https://ton.twitter.com/a.jpg"},
+			{ID: "3", SenderID: "alice"},
+		},
+	}
+}
+
+func TestSQSFifoGroupsBySender(t *testing.T) {
+	tt := []struct {
+		name     string
+		queueURL string
+		groups   []string
+		dedupIDs []string
+	}{
+		{
+			name:     "fifoQueue",
+			queueURL: "https://sqs.eu-north-1.amazonaws.com/1/events.fifo",
+			groups:   []string{"alice", "bob"},
+			// alice's two messages by hash, bob's one by id
+			dedupIDs: []string{"2b6d000fd5adb6fd09573ed36d347a92365d13a03f8720f472c30268feedad53", "4337869213-2"},
+		},
+		{
+			name:     "standardQueue",
+			queueURL: "https://sqs.eu-north-1.amazonaws.com/1/events",
+			groups:   []string{"", ""},
+			dedupIDs: []string{"", ""},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeSQS{}
+			if err := NewSQS(client, tc.queueURL).Publish(context.Background(), testEvent()); err != nil {
+				t.Fatalf("Publish failed with error: %v", err)
+			}
+			if len(client.sent) != len(tc.groups) {
+				t.Fatalf("got: %v messages, wanted: %v", len(client.sent), len(tc.groups))
+			}
+			for i, m := range client.sent {
+				if got := aws.StringValue(m.MessageGroupId); got != tc.groups[i] {
+					t.Fatalf("message %d got group: %v, wanted: %v", i, got, tc.groups[i])
+				}
+				if got := aws.StringValue(m.MessageDeduplicationId); got != tc.dedupIDs[i] {
+					t.Fatalf("message %d got deduplication id: %v, wanted: %v", i, got, tc.dedupIDs[i])
+				}
+				var event webhook.Event
+				if err := json.Unmarshal([]byte(aws.StringValue(m.MessageBody)), &event); err != nil || event.Trace != testEvent().Trace {
+					t.Fatalf("message %d got trace: %q, wanted the delivery's", i, event.Trace)
+				}
+			}
+		})
+	}
+}
+
+func TestStepFunctionsRedelivery(t *testing.T) {
+	client := &fakeSFN{names: make(map[string]bool)}
+	sink := NewStepFunctions(client, "arn:aws:states:eu-north-1:1:stateMachine:x")
+
+	// twitter redelivers with a new request, the direct messages are the same
+	redelivered := testEvent()
+	redelivered.RequestID = "req-retry"
+	other := testEvent()
+	other.DirectMessageEvents = other.DirectMessageEvents[:1]
+
+	for _, event := range []webhook.Event{testEvent(), redelivered, other} {
+		if err := sink.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish failed with error: %v", err)
+		}
+	}
+	if len(client.names) != 2 {
+		t.Fatalf("got: %v executions, wanted: 2", client.names)
+	}
+}
+
+func TestEventBridgeChunks(t *testing.T) {
+	event := webhook.Event{RequestID: "req", ForUserID: "4337869213"}
+	for i := 0; i < 12; i++ {
+		event.DirectMessageEvents = append(event.DirectMessageEvents, webhook.DirectMessageEvent{
+			ID:       fmt.Sprint(i),
+			SenderID: fmt.Sprintf("sender%d", i),
+		})
+	}
+
+	tt := []struct {
+		name   string
+		failed int64
+		calls  []int
+		err    bool
+	}{
+		{name: "chunked", calls: []int{10, 2}},
+		{name: "failedEntries", failed: 1, calls: []int{10}, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeEventBridge{failed: tc.failed}
+			err := NewEventBridge(client, "").Publish(context.Background(), event)
+			if (err != nil) != tc.err {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.err)
+			}
+			if fmt.Sprint(client.calls) != fmt.Sprint(tc.calls) {
+				t.Fatalf("got: %v, wanted: %v", client.calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestSplitBySender(t *testing.T) {
+	events := splitBySender(testEvent())
+	if len(events) != 2 {
+		t.Fatalf("got: %v events, wanted: 2", len(events))
+	}
+	if len(events[0].DirectMessageEvents) != 2 || events[0].PictureExists {
+		t.Fatalf("got: %+v, wanted alice's two messages without picture", events[0])
+	}
+	if !events[1].PictureExists {
+		t.Fatalf("got picture-exists false for bob, wanted true")
+	}
+}
+
+func TestNew(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-north-1")}))
+	local := Func(func(ctx context.Context, event webhook.Event) error { return nil })
+
+	tt := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "inferStepFunctions", cfg: Config{StateMachineARN: "arn:aws:states:eu-north-1:1:stateMachine:x"}},
+		{name: "inferSQS", cfg: Config{QueueURL: "https://sqs.eu-north-1.amazonaws.com/1/q"}},
+		{name: "inferLocal", cfg: Config{}},
+		{name: "eventBridge", cfg: Config{Kind: KindEventBridge}},
+		{name: "sqsWithoutQueue", cfg: Config{Kind: KindSQS}, wantErr: true},
+		{name: "unknownKind", cfg: Config{Kind: "kafka"}, wantErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := New(tc.cfg, sess, local)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got sink: %T, wanted error", sink)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New failed with error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// SQS sends events to a queue. For a FIFO queue every sender gets its own
+// message group, so one sender's messages are processed in order while
+// different senders are processed in parallel. The sender's DM event ids are
+// used as deduplication id to drop webhook redeliveries within the queue's
+// five minute deduplication interval.
+type SQS struct {
+	client   sqsiface.SQSAPI
+	queueURL string
+	fifo     bool
+}
+
+// NewSQS returns a sink sending to queueURL. Queues whose name ends in .fifo
+// are treated as FIFO queues.
+func NewSQS(client sqsiface.SQSAPI, queueURL string) *SQS {
+	return &SQS{
+		client:   client,
+		queueURL: queueURL,
+		fifo:     strings.HasSuffix(queueURL, ".fifo"),
+	}
+}
+
+// Publish sends one message per sender in event.
+func (s *SQS) Publish(ctx context.Context, event webhook.Event) error {
+	for _, ev := range splitBySender(event) {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("marshal event: %v", err)
+		}
+
+		input := &sqs.SendMessageInput{
+			MessageBody: aws.String(string(body)),
+			QueueUrl:    aws.String(s.queueURL),
+		}
+		if s.fifo {
+			input.MessageGroupId = aws.String(ev.DirectMessageEvents[0].SenderID)
+			if id := deduplicationID(ev); id != "" {
+				input.MessageDeduplicationId = aws.String(id)
+			}
+		}
+
+		_, err = s.client.SendMessageWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("send message: %v", err)
+		}
+	}
+	return nil
+}
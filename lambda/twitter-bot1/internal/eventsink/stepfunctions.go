@@ -0,0 +1,55 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// StepFunctions starts one state machine execution per event. The execution
+// is named after the event's direct messages so a redelivered webhook does
+// not run the pipeline twice, execution names are unique for 90 days.
+type StepFunctions struct {
+	client          sfniface.SFNAPI
+	stateMachineARN string
+}
+
+// NewStepFunctions returns a sink starting executions of stateMachineARN.
+func NewStepFunctions(client sfniface.SFNAPI, stateMachineARN string) *StepFunctions {
+	return &StepFunctions{
+		client:          client,
+		stateMachineARN: stateMachineARN,
+	}
+}
+
+// Publish starts an execution with event as input. An execution of the same
+// direct messages already started is not an error.
+func (s *StepFunctions) Publish(ctx context.Context, event webhook.Event) error {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %v", err)
+	}
+
+	startInput := &sfn.StartExecutionInput{
+		Input:           aws.String(string(input)),
+		StateMachineArn: aws.String(s.stateMachineARN),
+	}
+	if name := deduplicationID(event); name != "" {
+		startInput.Name = aws.String(name)
+	}
+
+	_, err = s.client.StartExecutionWithContext(ctx, startInput)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sfn.ErrCodeExecutionAlreadyExists {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("start execution: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package forget deletes everything a bot account stored about a sender:
+// pictures and analyses in s3, their perceptual hashes, the picture index and
+// the conversation.
+// Pictures and analyses are stored by content, an object another sender, or
+// the same sender of another account, is indexed for is kept and only the
+// sender's index entry is removed.
+package forget
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+)
+
+// deleteObjectsLimit max number of keys in one DeleteObjects call
+const deleteObjectsLimit = 1000
+
+// Result what was deleted, or with DryRun what would have been deleted
+type Result struct {
+	ForUserID string
+	SenderID  string
+	Objects   []pictureindex.Object
+	// Shared objects kept for other senders
+	Shared []pictureindex.Object
+}
+
+// Forgetter deletes a sender's data
+type Forgetter struct {
+	s3            s3iface.S3API
+	index         pictureindex.Index
+	hashes        phashindex.Index
+	conversations conversation.Store
+	// DryRun only lists the objects, nothing is deleted
+	DryRun bool
+}
+
+// New returns a Forgetter. conversations is only used by Forget.
+func New(s3Svc s3iface.S3API, index pictureindex.Index, hashes phashindex.Index, conversations conversation.Store) *Forgetter {
+	return &Forgetter{
+		s3:            s3Svc,
+		index:         index,
+		hashes:        hashes,
+		conversations: conversations,
+	}
+}
+
+// Forget deletes all objects indexed for senderID of the account forUserID
+// and no other owner, then the index entries and last the conversation. The
+// index is only cleared once every object is gone, so a failed run can be
+// repeated.
+func (f *Forgetter) Forget(ctx context.Context, forUserID string, senderID string) (Result, error) {
+	owner := pictureindex.Owner{ForUserID: forUserID, SenderID: senderID}
+	objects, err := f.index.List(ctx, owner)
+	if err != nil {
+		return Result{}, err
+	}
+	own, shared, err := f.split(ctx, owner, objects)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		ForUserID: forUserID,
+		SenderID:  senderID,
+		Objects:   own,
+		Shared:    shared,
+	}
+	if f.DryRun {
+		return result, nil
+	}
+
+	if err := f.deleteObjects(ctx, own); err != nil {
+		return result, err
+	}
+	if err := f.unhash(ctx, own); err != nil {
+		return result, err
+	}
+	if err := f.index.Delete(ctx, owner); err != nil {
+		return result, err
+	}
+	if err := f.conversations.Delete(ctx, forUserID, senderID); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ForgetAccount forgets every sender the account forUserID has indexed
+// objects, a conversation or preferences of. The result lists the objects of
+// all senders, SenderID is empty. A failed run can be repeated, senders
+// already forgotten are no longer listed.
+func (f *Forgetter) ForgetAccount(ctx context.Context, forUserID string) (Result, error) {
+	result := Result{
+		ForUserID: forUserID,
+		Objects:   make([]pictureindex.Object, 0),
+		Shared:    make([]pictureindex.Object, 0),
+	}
+	indexed, err := f.index.Senders(ctx, forUserID)
+	if err != nil {
+		return result, err
+	}
+	talked, err := f.conversations.Senders(ctx, forUserID)
+	if err != nil {
+		return result, err
+	}
+
+	seen := make(map[string]bool)
+	for _, senderID := range append(indexed, talked...) {
+		if seen[senderID] {
+			continue
+		}
+		seen[senderID] = true
+		r, err := f.Forget(ctx, forUserID, senderID)
+		result.Objects = append(result.Objects, r.Objects...)
+		result.Shared = append(result.Shared, r.Shared...)
+		if err != nil {
+			return result, fmt.Errorf("forget sender %s: %v", senderID, err)
+		}
+	}
+	return result, nil
+}
+
+// ForgetObjects deletes some of senderID's objects and their index entries,
+// the rest of what the account forUserID stored about the sender is kept.
+// Objects other owners are indexed for are not deleted.
+func (f *Forgetter) ForgetObjects(ctx context.Context, forUserID string, senderID string, objects []pictureindex.Object) error {
+	if f.DryRun {
+		return nil
+	}
+	owner := pictureindex.Owner{ForUserID: forUserID, SenderID: senderID}
+	own, _, err := f.split(ctx, owner, objects)
+	if err != nil {
+		return err
+	}
+	if err := f.deleteObjects(ctx, own); err != nil {
+		return err
+	}
+	if err := f.unhash(ctx, own); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := f.index.Remove(ctx, owner, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split returns the objects only owner is indexed for and the ones shared
+// with other owners.
+func (f *Forgetter) split(ctx context.Context, owner pictureindex.Owner, objects []pictureindex.Object) ([]pictureindex.Object, []pictureindex.Object, error) {
+	own := make([]pictureindex.Object, 0, len(objects))
+	shared := make([]pictureindex.Object, 0)
+	for _, obj := range objects {
+		owners, err := f.index.Owners(ctx, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		isShared := false
+		for _, o := range owners {
+			if o != owner {
+				isShared = true
+				break
+			}
+		}
+		if isShared {
+			shared = append(shared, obj)
+		} else {
+			own = append(own, obj)
+		}
+	}
+	return own, shared, nil
+}
+
+// unhash removes the perceptual hashes of the deleted pictures.
+func (f *Forgetter) unhash(ctx context.Context, objects []pictureindex.Object) error {
+	for _, obj := range objects {
+		checksum, ok := picturestore.Checksum(obj.Key)
+		if !ok {
+			continue
+		}
+		if err := f.hashes.Remove(ctx, checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Forgetter) deleteObjects(ctx context.Context, objects []pictureindex.Object) error {
+	byBucket := make(map[string][]*s3.ObjectIdentifier)
+	for _, obj := range objects {
+		byBucket[obj.Bucket] = append(byBucket[obj.Bucket], &s3.ObjectIdentifier{Key: aws.String(obj.Key)})
+	}
+
+	for bucket, ids := range byBucket {
+		for start := 0; start < len(ids); start += deleteObjectsLimit {
+			end := start + deleteObjectsLimit
+			if end > len(ids) {
+				end = len(ids)
+			}
+			out, err := f.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3.Delete{
+					Objects: ids[start:end],
+					Quiet:   aws.Bool(true),
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("delete objects in %s: %v", bucket, err)
+			}
+			if len(out.Errors) > 0 {
+				e := out.Errors[0]
+				return fmt.Errorf("delete objects in %s: %d failed, first %s: %s",
+					bucket, len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+			}
+		}
+	}
+	return nil
+}
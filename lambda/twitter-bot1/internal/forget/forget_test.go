@@ -0,0 +1,86 @@
+package forget
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+)
+
+type fakeS3 struct {
+	s3iface.S3API
+	deleted []string
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	for _, id := range input.Delete.Objects {
+		f.deleted = append(f.deleted, aws.StringValue(input.Bucket)+"/"+aws.StringValue(id.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestForget(t *testing.T) {
+	ctx := context.Background()
+	s3Svc := &fakeS3{}
+	index := pictureindex.NewMemoryIndex()
+	conversations := conversation.NewMemoryStore()
+
+	alice := pictureindex.Owner{ForUserID: "4337869213", SenderID: "alice"}
+	bob := pictureindex.Owner{ForUserID: "4337869213", SenderID: "bob"}
+	// alice also talks to another bot account
+	aliceElsewhere := pictureindex.Owner{ForUserID: "783214", SenderID: "alice"}
+	index.Add(ctx, alice, pictureindex.Object{Bucket: "pictures", Key: "sha256/1b.jpg"})
+	index.Add(ctx, alice, pictureindex.Object{Bucket: "pictures", Key: "2019/07/01/1.jpg.json"})
+	index.Add(ctx, alice, pictureindex.Object{Bucket: "pictures", Key: "sha256/3a.jpg"})
+	index.Add(ctx, bob, pictureindex.Object{Bucket: "pictures", Key: "2019/07/01/2.jpg"})
+	index.Add(ctx, bob, pictureindex.Object{Bucket: "pictures", Key: "sha256/3a.jpg"})
+	index.Add(ctx, aliceElsewhere, pictureindex.Object{Bucket: "pictures", Key: "2019/07/02/4.jpg"})
+	conversations.Put(ctx, conversation.State{ForUserID: "4337869213", SenderID: "alice", LastAnalysis: &conversation.Analysis{MediaID: "1"}})
+
+	hashes := phashindex.NewMemoryIndex()
+	hashes.Add(ctx, phashindex.Entry{Hash: 0x0123456789abcdef, Checksum: "1b"})
+	hashes.Add(ctx, phashindex.Entry{Hash: 0xfedcba9876543210, Checksum: "3a"})
+
+	f := New(s3Svc, index, hashes, conversations)
+
+	f.DryRun = true
+	result, err := f.Forget(ctx, "4337869213", "alice")
+	if err != nil {
+		t.Fatalf("Forget failed with error: %v", err)
+	}
+	if len(result.Objects) != 2 || len(result.Shared) != 1 || len(s3Svc.deleted) != 0 {
+		t.Fatalf("dry run got: %v objects %v shared and %v deleted, wanted: 2 1 and 0", len(result.Objects), len(result.Shared), len(s3Svc.deleted))
+	}
+
+	f.DryRun = false
+	if _, err := f.Forget(ctx, "4337869213", "alice"); err != nil {
+		t.Fatalf("Forget failed with error: %v", err)
+	}
+	if len(s3Svc.deleted) != 2 {
+		t.Fatalf("got deleted: %v, wanted alice's two objects", s3Svc.deleted)
+	}
+	if objects, _ := index.List(ctx, alice); len(objects) != 0 {
+		t.Fatalf("got: %v indexed objects for alice, wanted none", objects)
+	}
+	if objects, _ := index.List(ctx, bob); len(objects) != 2 {
+		t.Fatalf("got: %v indexed objects for bob, wanted both, the shared one kept", objects)
+	}
+	if objects, _ := index.List(ctx, aliceElsewhere); len(objects) != 1 {
+		t.Fatalf("got: %v indexed objects for alice of the other account, wanted it kept", objects)
+	}
+	if matches, _ := hashes.Nearest(ctx, 0x0123456789abcdef, 0); len(matches) != 0 {
+		t.Fatalf("got: %v, wanted the hash of alice's picture removed", matches)
+	}
+	if matches, _ := hashes.Nearest(ctx, 0xfedcba9876543210, 0); len(matches) != 1 {
+		t.Fatalf("got: %v, wanted the hash of the shared picture kept", matches)
+	}
+	if state, _ := conversations.Get(ctx, "4337869213", "alice"); state.LastAnalysis != nil {
+		t.Fatalf("got: %+v, wanted alice's conversation deleted", state)
+	}
+}
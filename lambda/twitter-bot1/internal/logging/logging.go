@@ -0,0 +1,263 @@
+// Package logging writes structured JSON log lines. Every line has the level,
+// the lambda and the fields added with With, such as the request id that
+// follows a webhook delivery through the state machine, so one user's request
+// can be traced across all functions. Message text and secrets are redacted.
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Field names shared by the lambdas
+const (
+	FieldRequestID  = "request_id"
+	FieldDMEventID  = "dm_event_id"
+	FieldSenderHash = "sender_hash"
+	FieldForUserID  = "for_user_id"
+)
+
+// Redacted replaces redacted values
+const Redacted = "[redacted]"
+
+var levels = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+// redactedKeys fields never written, direct message text and credentials
+var redactedKeys = map[string]bool{
+	"text":            true,
+	"message_text":    true,
+	"payload":         true,
+	"authorization":   true,
+	"consumer_key":    true,
+	"consumer_secret": true,
+	"oauth_token":     true,
+	"oauth_secret":    true,
+	"bearer_token":    true,
+}
+
+type (
+	field struct {
+		key   string
+		value interface{}
+	}
+	// output the writer shared by a logger and the loggers derived from it
+	output struct {
+		mu      sync.Mutex
+		w       io.Writer
+		secrets []string
+	}
+)
+
+// Logger writes JSON lines
+type Logger struct {
+	out    *output
+	lambda string
+	level  int
+	fields []field
+	now    func() time.Time
+}
+
+// New returns a Logger writing lines of lambda at level and above to w.
+func New(w io.Writer, lambda string, level string) *Logger {
+	l, ok := levels[level]
+	if !ok {
+		l = levels[LevelInfo]
+	}
+	return &Logger{
+		out:    &output{w: w},
+		lambda: lambda,
+		level:  l,
+		now:    time.Now,
+	}
+}
+
+// FromEnv returns a Logger writing to stdout, named after the lambda function
+// and logging at LOG_LEVEL, info when it is not set. name is used outside
+// lambda.
+func FromEnv(name string) *Logger {
+	if fn := os.Getenv("AWS_LAMBDA_FUNCTION_NAME"); fn != "" {
+		name = fn
+	}
+	return New(os.Stdout, name, os.Getenv("LOG_LEVEL"))
+}
+
+// Redact masks secrets wherever they appear in lines written by l and the
+// loggers derived from it, e.g. in an error echoing a request.
+func (l *Logger) Redact(secrets ...string) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	for _, s := range secrets {
+		if s != "" {
+			l.out.secrets = append(l.out.secrets, s)
+		}
+	}
+}
+
+// With returns a logger adding the key value pairs kv to every line.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	c := *l
+	c.fields = append(append([]field(nil), l.fields...), pairs(kv)...)
+	return &c
+}
+
+// WithRequest returns a logger adding the request id, the API Gateway request
+// id that also names the state machine execution.
+func (l *Logger) WithRequest(requestID string) *Logger {
+	return l.With(FieldRequestID, requestID)
+}
+
+// WithDM returns a logger adding the direct message event id and a hash of
+// the sender, never the sender's id itself.
+func (l *Logger) WithDM(eventID string, senderID string) *Logger {
+	return l.With(FieldDMEventID, eventID, FieldSenderHash, SenderHash(senderID))
+}
+
+// Debug writes msg at debug level.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+// Info writes msg at info level.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+// Warn writes msg at warn level.
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+// Error writes msg at error level.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+func (l *Logger) log(level string, msg string, kv []interface{}) {
+	if levels[level] < l.level {
+		return
+	}
+
+	line := map[string]interface{}{
+		"time":   l.now().UTC().Format(time.RFC3339Nano),
+		"level":  level,
+		"lambda": l.lambda,
+		"msg":    msg,
+	}
+	for _, f := range append(append([]field(nil), l.fields...), pairs(kv)...) {
+		line[f.key] = value(f.key, f.value)
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"level":  LevelError,
+			"lambda": l.lambda,
+			"msg":    fmt.Sprintf("marshal log line: %v", err),
+		})
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	s := string(b)
+	for _, secret := range l.out.secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+	fmt.Fprintln(l.out.w, s)
+}
+
+// pairs turns alternating keys and values into fields, a missing last value
+// is logged as null.
+func pairs(kv []interface{}) []field {
+	fields := make([]field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		f := field{key: fmt.Sprint(kv[i])}
+		if i+1 < len(kv) {
+			f.value = kv[i+1]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// value returns what is logged for key, errors as their message and
+// redacted keys masked.
+func value(key string, v interface{}) interface{} {
+	if isRedacted(key) {
+		return Redacted
+	}
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+func isRedacted(key string) bool {
+	k := strings.ToLower(key)
+	return redactedKeys[k] || strings.HasSuffix(k, "_secret") || strings.HasSuffix(k, "_token")
+}
+
+// hashSalt salt of SenderHash, set once at start
+var hashSalt string
+
+// SetHashSalt sets the salt of SenderHash, so a hash can not be reversed by
+// hashing known user ids. It is set before the first line is logged.
+func SetHashSalt(salt string) {
+	hashSalt = salt
+}
+
+// SenderHash returns a short hash of senderID that correlates a sender's
+// lines without logging who they are.
+func SenderHash(senderID string) string {
+	if senderID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(hashSalt + senderID))
+	return hex.EncodeToString(sum[:8])
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultLogger *Logger
+)
+
+// FromContext returns the logger of ctx, a logger from FromEnv when it has
+// none.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	defaultOnce.Do(func() {
+		defaultLogger = FromEnv("twitter-bot1")
+	})
+	return defaultLogger
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	tt := []struct {
+		name  string
+		level string
+		log   func(l *Logger)
+		want  map[string]interface{}
+	}{
+		{
+			name: "correlation",
+			log: func(l *Logger) {
+				l.WithRequest("req-1").WithDM("954491830116155396", "3805104374").Info("reply sent", "status", "sent")
+			},
+			want: map[string]interface{}{
+				"level":       "info",
+				"lambda":      "twitter-reply",
+				"msg":         "reply sent",
+				"request_id":  "req-1",
+				"dm_event_id": "954491830116155396",
+				"sender_hash": SenderHash("3805104374"),
+				"status":      "sent",
+			},
+		},
+		{
+			name: "redactedKeys",
+			log: func(l *Logger) {
+				l.Error("send failed", "text", "my secret message", "oauth_secret", "abc", "error", fmt.Errorf("boom"))
+			},
+			want: map[string]interface{}{
+				"text":         Redacted,
+				"oauth_secret": Redacted,
+				"error":        "boom",
+			},
+		},
+		{
+			name: "redactedValues",
+			log: func(l *Logger) {
+				l.Redact("s3cr3t")
+				l.Warn("request failed", "error", fmt.Errorf("signature with s3cr3t rejected"))
+			},
+			want: map[string]interface{}{
+				"error": "signature with [redacted] rejected",
+			},
+		},
+		{
+			name:  "belowLevel",
+			level: LevelWarn,
+			log: func(l *Logger) {
+				l.Info("not written")
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			tc.log(New(&b, "twitter-reply", tc.level))
+
+			if tc.want == nil {
+				if b.Len() != 0 {
+					t.Fatalf("got: %q, wanted nothing", b.String())
+				}
+				return
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+				t.Fatalf("got: %q, wanted a JSON line: %v", b.String(), err)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Fatalf("got %s: %v, wanted: %v", k, got[k], v)
+				}
+			}
+			if strings.Contains(b.String(), "3805104374") {
+				t.Fatalf("got: %q, wanted no sender id", b.String())
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "twitter-bot1", "").WithRequest("req-1")
+
+	FromContext(NewContext(context.Background(), l)).Info("hello")
+
+	if !strings.Contains(b.String(), `"request_id":"req-1"`) {
+		t.Fatalf("got: %q, wanted the context's logger", b.String())
+	}
+}
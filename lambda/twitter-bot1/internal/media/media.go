@@ -0,0 +1,198 @@
+// Package media downloads the pictures attached to direct messages. A download
+// is checked before anything is stored: the http status, the declared type and
+// size and the magic bytes at the start of the body. The body is streamed, it
+// is never read into memory by this package.
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Types of pictures accepted, the ones Rekognition can analyse
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+)
+
+// Kinds of Error
+const (
+	// ErrorTransport the request failed or the body could not be read
+	ErrorTransport = "transport"
+	// ErrorStatus the response status is not 2xx
+	ErrorStatus = "status"
+	// ErrorTooLarge the picture is larger than the limit
+	ErrorTooLarge = "too-large"
+	// ErrorType the response is not a picture of an accepted type
+	ErrorType = "type"
+)
+
+// sniffLen bytes read to detect the type
+const sniffLen = 8
+
+var signatures = []struct {
+	mediaType string
+	magic     []byte
+}{
+	{mediaType: TypeJPEG, magic: []byte("\xff\xd8\xff")},
+	{mediaType: TypePNG, magic: []byte("\x89PNG\r\n\x1a\n")},
+}
+
+var extensions = map[string]string{
+	TypeJPEG: ".jpg",
+	TypePNG:  ".png",
+}
+
+// Error a download that failed or was refused
+type Error struct {
+	Kind string
+	Msg  string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("download picture: %s", e.Msg)
+}
+
+// Detect returns the type of the picture b starts with.
+func Detect(b []byte) (string, bool) {
+	for _, s := range signatures {
+		if bytes.HasPrefix(b, s.magic) {
+			return s.mediaType, true
+		}
+	}
+	return "", false
+}
+
+// Extension returns the file name extension of mediaType, e.g. .jpg.
+func Extension(mediaType string) string {
+	return extensions[mediaType]
+}
+
+// Download a picture being read, Read returns its body
+type Download struct {
+	// Type detected from the magic bytes
+	Type string
+	// Size from Content-Length, -1 when the server did not declare it
+	Size int64
+
+	body   io.ReadCloser
+	r      io.Reader
+	limit  int64
+	read   int64
+	digest hash.Hash
+	err    *Error
+}
+
+// Get starts downloading url. The response must have a 2xx status, a declared
+// Content-Type must be an image and a declared Content-Length must not be
+// larger than limit. The first bytes are read to detect the type. The caller
+// must Close the Download.
+func Get(ctx context.Context, client *http.Client, url string, limit int64) (*Download, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &Error{Kind: ErrorTransport, Msg: err.Error()}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, &Error{Kind: ErrorTransport, Msg: err.Error()}
+	}
+
+	d, err := newDownload(resp, limit)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func newDownload(resp *http.Response, limit int64) (*Download, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{Kind: ErrorStatus, Msg: fmt.Sprintf("status %d", resp.StatusCode)}
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || !strings.HasPrefix(mediaType, "image/") {
+			return nil, &Error{Kind: ErrorType, Msg: fmt.Sprintf("content type %q", ct)}
+		}
+	}
+	if resp.ContentLength > limit {
+		return nil, &Error{Kind: ErrorTooLarge, Msg: fmt.Sprintf("%d bytes, limit %d", resp.ContentLength, limit)}
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, &Error{Kind: ErrorTransport, Msg: err.Error()}
+	}
+	head = head[:n]
+	mediaType, ok := Detect(head)
+	if !ok {
+		return nil, &Error{Kind: ErrorType, Msg: fmt.Sprintf("unknown magic bytes %x", head)}
+	}
+
+	return &Download{
+		Type:   mediaType,
+		Size:   resp.ContentLength,
+		body:   resp.Body,
+		r:      io.MultiReader(bytes.NewReader(head), resp.Body),
+		limit:  limit,
+		digest: sha256.New(),
+	}, nil
+}
+
+// Read implements io.Reader. Reading past the limit fails with an Error of
+// kind ErrorTooLarge, whatever the declared size.
+func (d *Download) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if int64(len(p)) > d.limit-d.read+1 {
+		p = p[:d.limit-d.read+1]
+	}
+	n, err := d.r.Read(p)
+	d.read += int64(n)
+	if d.read > d.limit {
+		d.err = &Error{Kind: ErrorTooLarge, Msg: fmt.Sprintf("more than %d bytes", d.limit)}
+		return 0, d.err
+	}
+	d.digest.Write(p[:n])
+	if err != nil && err != io.EOF {
+		d.err = &Error{Kind: ErrorTransport, Msg: err.Error()}
+		return n, d.err
+	}
+	return n, err
+}
+
+// Err returns the Error Read failed with, for readers such as uploads that
+// wrap the errors of the body. It is nil while reading succeeds.
+func (d *Download) Err() error {
+	if d.err == nil {
+		return nil
+	}
+	return d.err
+}
+
+// Close closes the response body.
+func (d *Download) Close() error {
+	return d.body.Close()
+}
+
+// BytesRead returns the number of bytes read.
+func (d *Download) BytesRead() int64 {
+	return d.read
+}
+
+// Checksum returns the hex encoded SHA-256 of the bytes read, the checksum of
+// the picture once Read has returned io.EOF.
+func (d *Download) Checksum() string {
+	return hex.EncodeToString(d.digest.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	jpeg := "\xff\xd8\xff\xe0\x00\x10JFIF picture data"
+	png := "\x89PNG\r\n\x1a\n picture data"
+
+	tt := []struct {
+		name        string
+		status      int
+		contentType string
+		// chunked leaves out Content-Length
+		chunked   bool
+		body      string
+		limit     int64
+		mediaType string
+		kind      string
+	}{
+		{name: "jpeg", status: 200, contentType: "image/jpeg", body: jpeg, limit: 1024, mediaType: TypeJPEG},
+		{name: "png", status: 200, contentType: "image/png", body: png, limit: 1024, mediaType: TypePNG},
+		{name: "noContentType", status: 200, body: jpeg, limit: 1024, mediaType: TypeJPEG},
+		{name: "errorPage", status: 404, contentType: "text/html", body: "<html>not found</html>", limit: 1024, kind: ErrorStatus},
+		{name: "htmlWithOK", status: 200, contentType: "text/html; charset=utf-8", body: "<html></html>", limit: 1024, kind: ErrorType},
+		{name: "gif", status: 200, contentType: "image/gif", body: "GIF89a picture data", limit: 1024, kind: ErrorType},
+		{name: "declaredTooLarge", status: 200, contentType: "image/jpeg", body: jpeg, limit: 10, kind: ErrorTooLarge},
+		{name: "streamedTooLarge", status: 200, contentType: "image/jpeg", chunked: true, body: jpeg, limit: 10, kind: ErrorTooLarge},
+		{name: "exactlyTheLimit", status: 200, contentType: "image/jpeg", chunked: true, body: jpeg, limit: int64(len(jpeg)), mediaType: TypeJPEG},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if !tc.chunked {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tc.body)))
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+				w.(http.Flusher).Flush()
+			}))
+			defer ts.Close()
+
+			d, err := Get(context.Background(), ts.Client(), ts.URL, tc.limit)
+			var body []byte
+			if err == nil {
+				defer d.Close()
+				body, err = ioutil.ReadAll(d)
+			}
+			if tc.kind != "" {
+				if e, ok := err.(*Error); !ok || e.Kind != tc.kind {
+					t.Fatalf("got: %v, wanted: a %v error", err, tc.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got: %v, wanted: no error", err)
+			}
+
+			sum := sha256.Sum256([]byte(tc.body))
+			if d.Type != tc.mediaType || string(body) != tc.body || d.Checksum() != hex.EncodeToString(sum[:]) {
+				t.Fatalf("got: %v %q %v, wanted: %v %q and its checksum", d.Type, body, d.Checksum(), tc.mediaType, tc.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package metrics records pipeline health metrics. In lambda they are printed
+// as CloudWatch embedded metric format (EMF) lines, CloudWatch Logs extracts
+// the metrics without any API calls from the function.
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Namespace CloudWatch namespace of the bot's metrics
+const Namespace = "TwitterBot"
+
+// Units of the recorded metrics
+const (
+	UnitCount        = "Count"
+	UnitBytes        = "Bytes"
+	UnitMilliseconds = "Milliseconds"
+)
+
+// Names of the recorded metrics
+const (
+	EventsReceived       = "EventsReceived"
+	EventsRejected       = "EventsRejected"
+	DroppedActivity      = "DroppedActivity"
+	PictureBytes         = "PictureBytes"
+	PictureLatency       = "PictureDownloadLatency"
+	PicturesRejected     = "PicturesRejected"
+	PicturesDeduplicated = "PicturesDeduplicated"
+	PicturesFlagged      = "PicturesFlagged"
+	NearDuplicates       = "NearDuplicates"
+	AnalysisCacheHits    = "AnalysisCacheHits"
+	AnalysisCacheMisses  = "AnalysisCacheMisses"
+	FacesDetected        = "FacesDetected"
+	RekognitionLatency   = "RekognitionLatency"
+	RekognitionErrors    = "RekognitionErrors"
+	DirectMessagesSent   = "DirectMessagesSent"
+	DirectMessagesFailed = "DirectMessagesFailed"
+	RateLimitRemaining   = "RateLimitRemaining"
+)
+
+// Metric one value of a metric
+type Metric struct {
+	Name       string
+	Unit       string
+	Value      float64
+	Dimensions map[string]string
+}
+
+// Recorder records metrics
+type Recorder interface {
+	Record(m Metric)
+}
+
+// Count records n of name, dims are dimension name and value pairs.
+func Count(r Recorder, name string, n int, dims ...string) {
+	r.Record(Metric{Name: name, Unit: UnitCount, Value: float64(n), Dimensions: dimensions(dims)})
+}
+
+// Bytes records a size of n bytes.
+func Bytes(r Recorder, name string, n int64, dims ...string) {
+	r.Record(Metric{Name: name, Unit: UnitBytes, Value: float64(n), Dimensions: dimensions(dims)})
+}
+
+// Since records the time since start in milliseconds.
+func Since(r Recorder, name string, start time.Time, dims ...string) {
+	ms := float64(time.Since(start)) / float64(time.Millisecond)
+	r.Record(Metric{Name: name, Unit: UnitMilliseconds, Value: ms, Dimensions: dimensions(dims)})
+}
+
+// dimensions makes a map of name and value pairs, a trailing name without
+// value is ignored.
+func dimensions(dims []string) map[string]string {
+	if len(dims) < 2 {
+		return nil
+	}
+	m := make(map[string]string, len(dims)/2)
+	for i := 0; i+1 < len(dims); i += 2 {
+		m[dims[i]] = dims[i+1]
+	}
+	return m
+}
+
+// New returns the recorder of a lambda, an EMF recorder on stdout when
+// enabled.
+func New(enabled bool) Recorder {
+	if !enabled {
+		return Nop{}
+	}
+	return NewEMF(os.Stdout)
+}
+
+// Nop discards every metric
+type Nop struct{}
+
+// Record implements Recorder.
+func (Nop) Record(Metric) {}
+
+// EMF writes every metric as a CloudWatch embedded metric format line
+type EMF struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewEMF returns an EMF recorder writing to w.
+func NewEMF(w io.Writer) *EMF {
+	return &EMF{w: w, now: time.Now}
+}
+
+// Record implements Recorder.
+func (e *EMF) Record(m Metric) {
+	keys := make([]string, 0, len(m.Dimensions))
+	for k := range m.Dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": e.now().UnixNano() / int64(time.Millisecond),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  Namespace,
+				"Dimensions": [][]string{keys},
+				"Metrics": []map[string]string{
+					{"Name": m.Name, "Unit": m.Unit},
+				},
+			}},
+		},
+		m.Name: m.Value,
+	}
+	for k, v := range m.Dimensions {
+		line[k] = v
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintln(e.w, string(b))
+}
+
+// Memory keeps every metric in memory, for tests
+type Memory struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// NewMemory returns an empty Memory recorder.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Record implements Recorder.
+func (mr *Memory) Record(m Metric) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.metrics = append(mr.metrics, m)
+}
+
+// Metrics returns the recorded metrics in order.
+func (mr *Memory) Metrics() []Metric {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return append([]Metric(nil), mr.metrics...)
+}
+
+// Sum adds up the values recorded of name having all of dims.
+func (mr *Memory) Sum(name string, dims ...string) float64 {
+	want := dimensions(dims)
+	var sum float64
+	for _, m := range mr.Metrics() {
+		if m.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range want {
+			if m.Dimensions[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			sum += m.Value
+		}
+	}
+	return sum
+}
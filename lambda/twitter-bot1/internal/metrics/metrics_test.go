@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEMF(t *testing.T) {
+	tt := []struct {
+		name   string
+		record func(r Recorder)
+		want   map[string]interface{}
+		dims   []interface{}
+	}{
+		{
+			name: "count",
+			record: func(r Recorder) {
+				Count(r, RekognitionErrors, 1, "Code", "ThrottlingException")
+			},
+			want: map[string]interface{}{
+				RekognitionErrors: 1.0,
+				"Code":            "ThrottlingException",
+			},
+			dims: []interface{}{"Code"},
+		},
+		{
+			name: "sortedDimensions",
+			record: func(r Recorder) {
+				Bytes(r, PictureBytes, 2048, "Source", "dm", "Account", "42")
+			},
+			want: map[string]interface{}{
+				PictureBytes: 2048.0,
+				"Account":    "42",
+				"Source":     "dm",
+			},
+			dims: []interface{}{"Account", "Source"},
+		},
+		{
+			name: "noDimensions",
+			record: func(r Recorder) {
+				Count(r, EventsReceived, 1, "Dangling")
+			},
+			want: map[string]interface{}{
+				EventsReceived: 1.0,
+			},
+			dims: []interface{}{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			r := NewEMF(&buf)
+			r.now = func() time.Time { return time.Unix(1561000000, 0) }
+			tc.record(r)
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("got: %v, wanted: a json line", err)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Fatalf("got: %v=%v, wanted: %v=%v", k, got[k], k, v)
+				}
+			}
+			aws := got["_aws"].(map[string]interface{})
+			if aws["Timestamp"] != 1561000000000.0 {
+				t.Fatalf("got: %v, wanted: %v", aws["Timestamp"], 1561000000000.0)
+			}
+			directive := aws["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+			dims := directive["Dimensions"].([]interface{})[0].([]interface{})
+			if !reflect.DeepEqual(dims, tc.dims) || directive["Namespace"] != Namespace {
+				t.Fatalf("got: %v %v, wanted: %v %v", directive["Namespace"], dims, Namespace, tc.dims)
+			}
+		})
+	}
+}
+
+func TestMemorySum(t *testing.T) {
+	r := NewMemory()
+	Count(r, DirectMessagesSent, 2, "Source", "reply")
+	Count(r, DirectMessagesSent, 1, "Source", "welcome")
+	Count(r, DirectMessagesFailed, 1, "Source", "reply")
+
+	tt := []struct {
+		name   string
+		metric string
+		dims   []string
+		want   float64
+	}{
+		{name: "all", metric: DirectMessagesSent, want: 3},
+		{name: "dimension", metric: DirectMessagesSent, dims: []string{"Source", "reply"}, want: 2},
+		{name: "none", metric: DirectMessagesSent, dims: []string{"Source", "outbox"}, want: 0},
+		{name: "otherMetric", metric: DirectMessagesFailed, want: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := r.Sum(tc.metric, tc.dims...); got != tc.want {
+				t.Fatalf("got: %v, wanted: %v", got, tc.want)
+			}
+		})
+	}
+}
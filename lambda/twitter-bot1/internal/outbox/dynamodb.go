@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+)
+
+// StatusIndex global secondary index with the partition key status and the
+// number sort key next_attempt
+const StatusIndex = "status-next_attempt"
+
+// DynamoDBStore keeps one item per message in a table with the string
+// partition key id and the StatusIndex. expires_at is the table's TTL attribute,
+// only sent messages have it.
+type DynamoDBStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBStore returns a store using table.
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client: client,
+		table:  table,
+	}
+}
+
+// Put implements Store.
+func (d *DynamoDBStore) Put(ctx context.Context, m Message) error {
+	item, err := dynamodbattribute.MarshalMap(m)
+	if err != nil {
+		return fmt.Errorf("marshal outbox message: %v", err)
+	}
+	_, err = d.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("put outbox message: %v", err)
+	}
+	return nil
+}
+
+// Due implements Store.
+func (d *DynamoDBStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	return d.query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		IndexName:              aws.String(StatusIndex),
+		KeyConditionExpression: aws.String("#status = :status AND next_attempt <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(StatusPending)},
+			":now":    {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+		Limit: aws.Int64(int64(limit)),
+	}, limit)
+}
+
+// Claim implements Store.
+func (d *DynamoDBStore) Claim(ctx context.Context, id string, nextAttempt, until int64) (bool, error) {
+	_, err := d.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		UpdateExpression:    aws.String("SET next_attempt = :until"),
+		ConditionExpression: aws.String("#status = :status AND next_attempt = :next"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(StatusPending)},
+			":next":   {N: aws.String(strconv.FormatInt(nextAttempt, 10))},
+			":until":  {N: aws.String(strconv.FormatInt(until, 10))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim outbox message: %v", err)
+	}
+	return true, nil
+}
+
+// Dead implements Store.
+func (d *DynamoDBStore) Dead(ctx context.Context) ([]Message, error) {
+	return d.query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		IndexName:              aws.String(StatusIndex),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(StatusDead)},
+		},
+	}, 0)
+}
+
+// Delete implements Store.
+func (d *DynamoDBStore) Delete(ctx context.Context, id string) error {
+	_, err := d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("delete outbox message: %v", err)
+	}
+	return nil
+}
+
+// query returns the messages of input, at most limit when it is above 0.
+func (d *DynamoDBStore) query(ctx context.Context, input *dynamodb.QueryInput, limit int) ([]Message, error) {
+	messages := make([]Message, 0)
+	err := d.client.QueryPagesWithContext(ctx, input, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range out.Items {
+			var m Message
+			if err := dynamodbattribute.UnmarshalMap(item, &m); err != nil {
+				logging.FromContext(ctx).Error("failed to unmarshal outbox message", "error", err)
+				continue
+			}
+			messages = append(messages, m)
+		}
+		return limit <= 0 || len(messages) < limit
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query outbox: %v", err)
+	}
+	return messages, nil
+}
@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps messages in memory. It is used for tests and when the
+// bot is self-hosted without DynamoDB.
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages map[string]Message
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		messages: make(map[string]Message),
+	}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[m.ID] = m
+	return nil
+}
+
+// Due implements Store.
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	due := s.list(func(m Message) bool {
+		return m.Status == StatusPending && m.NextAttempt <= now.Unix()
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(ctx context.Context, id string, nextAttempt, until int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok || m.Status != StatusPending || m.NextAttempt != nextAttempt {
+		return false, nil
+	}
+	m.NextAttempt = until
+	s.messages[id] = m
+	return true, nil
+}
+
+// Dead implements Store.
+func (s *MemoryStore) Dead(ctx context.Context) ([]Message, error) {
+	return s.list(func(m Message) bool {
+		return m.Status == StatusDead
+	}), nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, id)
+	return nil
+}
+
+func (s *MemoryStore) list(match func(Message) bool) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]Message, 0)
+	for _, m := range s.messages {
+		if match(m) {
+			messages = append(messages, m)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].NextAttempt < messages[j].NextAttempt
+	})
+	return messages
+}
@@ -0,0 +1,215 @@
+// Package outbox keeps direct messages that could not be sent, e.g. because
+// twitter answered 429 or 5xx, and sends them again later with exponential
+// backoff. Messages that keep failing end up as dead letters.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// Message statuses
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+	// StatusSent a sent message that could not be deleted
+	StatusSent = "sent"
+)
+
+type (
+	// Message a deferred direct message
+	Message struct {
+		// ID identifies the message, enqueueing the same ID again replaces it
+		ID string `json:"id"`
+		// ForUserID bot account the message is sent as, empty for messages
+		// deferred before accounts were recorded
+		ForUserID string `json:"for_user_id,omitempty"`
+		// SenderID the user the message is sent to, the sender of the
+		// message it answers
+		SenderID  string `json:"sender_id"`
+		InReplyTo string `json:"in_reply_to,omitempty"`
+		// Request the message of messages deferred before the parts of a
+		// split reply were kept together, see Parts
+		Request twitter.DirectMessageRequest `json:"request"`
+		// Requests the parts of a reply not sent yet, in order
+		Requests []twitter.DirectMessageRequest `json:"requests,omitempty"`
+		Status   string                         `json:"status"`
+		Attempts int                            `json:"attempts"`
+		// NextAttempt unix time the message is due
+		NextAttempt int64  `json:"next_attempt"`
+		LastError   string `json:"last_error,omitempty"`
+		CreatedAt   int64  `json:"created_at"`
+		// ExpiresAt unix time a sent message is removed by the table's TTL,
+		// zero for messages still to be sent
+		ExpiresAt int64 `json:"expires_at,omitempty"`
+	}
+	// Delivery a message sent by Drain
+	Delivery struct {
+		ID        string `json:"id"`
+		SenderID  string `json:"sender_id"`
+		MessageID string `json:"message_id"`
+	}
+	// Report what a Drain did
+	Report struct {
+		Sent    []Delivery `json:"sent"`
+		Retried int        `json:"retried"`
+		Dead    []string   `json:"dead"`
+	}
+)
+
+// Store persists messages
+type Store interface {
+	// Put saves m, replacing a message with the same ID.
+	Put(ctx context.Context, m Message) error
+	// Due returns at most limit pending messages due at now, oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]Message, error)
+	// Claim moves the pending message with id due at nextAttempt to until,
+	// it returns false when another drain claimed or changed it first.
+	Claim(ctx context.Context, id string, nextAttempt, until int64) (bool, error)
+	// Dead returns the dead letters.
+	Dead(ctx context.Context) ([]Message, error)
+	// Delete removes the message with id.
+	Delete(ctx context.Context, id string) error
+}
+
+// SendFunc sends part, one of m's parts, and returns the id of the sent
+// message
+type SendFunc func(ctx context.Context, m Message, part twitter.DirectMessageRequest) (string, error)
+
+type (
+	retryable interface {
+		Retryable() bool
+	}
+	retryAt interface {
+		RetryAt() time.Time
+	}
+)
+
+// Outbox defers and resends messages
+type Outbox struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// New returns an Outbox keeping messages in store.
+func New(store Store, policy Policy) *Outbox {
+	return &Outbox{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Parts returns the direct messages of m in the order they are sent.
+func (m Message) Parts() []twitter.DirectMessageRequest {
+	if len(m.Requests) > 0 {
+		return m.Requests
+	}
+	return []twitter.DirectMessageRequest{m.Request}
+}
+
+// Enqueue defers m after its first attempt failed with cause. Messages
+// failing with an error that is not retryable go straight to the dead
+// letters.
+func (o *Outbox) Enqueue(ctx context.Context, m Message, cause error) error {
+	now := o.now()
+	m.CreatedAt = now.Unix()
+	m.Attempts = 1
+	o.schedule(&m, cause, now)
+	if err := o.store.Put(ctx, m); err != nil {
+		return fmt.Errorf("enqueue %s: %v", m.ID, err)
+	}
+	return nil
+}
+
+// Drain sends at most limit due messages with send, the parts of each in
+// order. Each message is claimed for the policy's lease first so overlapping
+// drains do not send it twice. Sent messages are removed, failed ones
+// rescheduled or moved to the dead letters with the parts not sent yet.
+func (o *Outbox) Drain(ctx context.Context, send SendFunc, limit int) (Report, error) {
+	log := logging.FromContext(ctx)
+	now := o.now()
+	due, err := o.store.Due(ctx, now, limit)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Sent: make([]Delivery, 0), Dead: make([]string, 0)}
+	for _, m := range due {
+		until := now.Add(o.policy.Lease).Unix()
+		claimed, err := o.store.Claim(ctx, m.ID, m.NextAttempt, until)
+		if err != nil {
+			return report, err
+		}
+		if !claimed {
+			log.Info("outbox message claimed by another drain", "id", m.ID)
+			continue
+		}
+		m.NextAttempt = until
+
+		m.Attempts++
+		parts := m.Parts()
+		var sendErr error
+		for len(parts) > 0 {
+			var messageID string
+			if messageID, sendErr = send(ctx, m, parts[0]); sendErr != nil {
+				break
+			}
+			report.Sent = append(report.Sent, Delivery{ID: m.ID, SenderID: m.SenderID, MessageID: messageID})
+			parts = parts[1:]
+		}
+		if sendErr == nil {
+			if err := o.store.Delete(ctx, m.ID); err != nil {
+				// the message is out, it must not be sent again
+				log.Warn("failed to delete sent outbox message", "id", m.ID, "error", err)
+				m.Status = StatusSent
+				m.ExpiresAt = now.Add(o.policy.KeepSent).Unix()
+				if err := o.store.Put(ctx, m); err != nil {
+					log.Error("failed to mark outbox message sent", "id", m.ID, "error", err)
+				}
+			}
+			continue
+		}
+
+		m.Request, m.Requests = twitter.DirectMessageRequest{}, parts
+		o.schedule(&m, sendErr, now)
+		if m.Status == StatusDead {
+			report.Dead = append(report.Dead, m.ID)
+		} else {
+			report.Retried++
+		}
+		if err := o.store.Put(ctx, m); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// DeadLetters returns the messages that will not be sent again.
+func (o *Outbox) DeadLetters(ctx context.Context) ([]Message, error) {
+	return o.store.Dead(ctx)
+}
+
+// schedule sets when m is tried again after failing with cause at now, or
+// marks it dead.
+func (o *Outbox) schedule(m *Message, cause error, now time.Time) {
+	if cause != nil {
+		m.LastError = cause.Error()
+	}
+	if r, ok := cause.(retryable); (ok && !r.Retryable()) || m.Attempts >= o.policy.MaxAttempts {
+		m.Status = StatusDead
+		return
+	}
+
+	next := now.Add(o.policy.Backoff(m.Attempts))
+	if r, ok := cause.(retryAt); ok && r.RetryAt().After(next) {
+		next = r.RetryAt()
+	}
+	m.Status = StatusPending
+	m.NextAttempt = next.Unix()
+}
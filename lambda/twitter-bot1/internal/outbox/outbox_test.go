@@ -0,0 +1,202 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+type testError struct {
+	retryable bool
+	retryAt   time.Time
+}
+
+func (e testError) Error() string      { return "send failed" }
+func (e testError) Retryable() bool    { return e.retryable }
+func (e testError) RetryAt() time.Time { return e.retryAt }
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, MaxAttempts: 5}
+	tt := []struct {
+		attempts int
+		out      time.Duration
+	}{
+		{attempts: 1, out: time.Minute},
+		{attempts: 2, out: 2 * time.Minute},
+		{attempts: 4, out: 8 * time.Minute},
+		{attempts: 5, out: 10 * time.Minute},
+		{attempts: 50, out: 10 * time.Minute},
+	}
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("attempts%d", tc.attempts), func(t *testing.T) {
+			if out := p.Backoff(tc.attempts); out != tc.out {
+				t.Fatalf("got: %v, wanted: %v", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	now := time.Unix(1562101000, 0)
+	policy := Policy{BaseDelay: time.Minute, MaxDelay: time.Hour, MaxAttempts: 3, Lease: time.Minute}
+	tt := []struct {
+		name        string
+		attempts    int
+		sendErr     error
+		sent        int
+		dead        int
+		nextAttempt int64
+	}{
+		{name: "sent", sendErr: nil, sent: 1},
+		{name: "retried", attempts: 1, sendErr: testError{retryable: true}, nextAttempt: now.Add(2 * time.Minute).Unix()},
+		{name: "retriedAfterReset", attempts: 1, sendErr: testError{retryable: true, retryAt: now.Add(15 * time.Minute)}, nextAttempt: now.Add(15 * time.Minute).Unix()},
+		{name: "notRetryable", attempts: 1, sendErr: testError{retryable: false}, dead: 1},
+		{name: "maxAttempts", attempts: 2, sendErr: testError{retryable: true}, dead: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			o := New(store, policy)
+			o.now = func() time.Time { return now }
+			store.Put(context.Background(), Message{ID: "m1", Status: StatusPending, Attempts: tc.attempts, NextAttempt: now.Unix()})
+			store.Put(context.Background(), Message{ID: "later", Status: StatusPending, NextAttempt: now.Add(time.Hour).Unix()})
+
+			report, err := o.Drain(context.Background(), func(ctx context.Context, m Message, part twitter.DirectMessageRequest) (string, error) {
+				return "42", tc.sendErr
+			}, 10)
+			if err != nil {
+				t.Fatalf("Drain failed with error: %v", err)
+			}
+			if len(report.Sent) != tc.sent || len(report.Dead) != tc.dead {
+				t.Fatalf("got: %+v, wanted: %v sent %v dead", report, tc.sent, tc.dead)
+			}
+			dead, _ := o.DeadLetters(context.Background())
+			if len(dead) != tc.dead {
+				t.Fatalf("got: %v dead letters, wanted: %v", len(dead), tc.dead)
+			}
+			if tc.nextAttempt != 0 {
+				due, _ := store.Due(context.Background(), time.Unix(tc.nextAttempt, 0), 10)
+				if len(due) != 1 || due[0].ID != "m1" || due[0].NextAttempt != tc.nextAttempt {
+					t.Fatalf("got: %+v, wanted m1 due at %v", due, tc.nextAttempt)
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueueNotRetryable(t *testing.T) {
+	o := New(NewMemoryStore(), DefaultPolicy)
+	if err := o.Enqueue(context.Background(), Message{ID: "m1"}, testError{retryable: false}); err != nil {
+		t.Fatalf("Enqueue failed with error: %v", err)
+	}
+	dead, _ := o.DeadLetters(context.Background())
+	if len(dead) != 1 {
+		t.Fatalf("got: %v dead letters, wanted: 1", len(dead))
+	}
+}
+
+// failingDelete a store whose Delete fails
+type failingDelete struct {
+	*MemoryStore
+}
+
+func (failingDelete) Delete(ctx context.Context, id string) error {
+	return fmt.Errorf("delete failed")
+}
+
+// claimedFirst a store where an overlapping drain claims each due message
+// before this one
+type claimedFirst struct {
+	*MemoryStore
+}
+
+func (s claimedFirst) Claim(ctx context.Context, id string, nextAttempt, until int64) (bool, error) {
+	s.MemoryStore.Claim(ctx, id, nextAttempt, until)
+	return s.MemoryStore.Claim(ctx, id, nextAttempt, until)
+}
+
+func TestDrainOnce(t *testing.T) {
+	now := time.Unix(1562101000, 0)
+	policy := Policy{BaseDelay: time.Minute, MaxDelay: time.Hour, MaxAttempts: 3, Lease: time.Minute, KeepSent: time.Hour}
+	tt := []struct {
+		name  string
+		store func(*MemoryStore) Store
+		sent  int
+	}{
+		{name: "deleteFailed", store: func(s *MemoryStore) Store { return failingDelete{s} }, sent: 1},
+		{name: "claimedByOther", store: func(s *MemoryStore) Store { return claimedFirst{s} }, sent: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := NewMemoryStore()
+			memory.Put(ctx, Message{ID: "m1", Status: StatusPending, NextAttempt: now.Unix()})
+			o := New(tc.store(memory), policy)
+			o.now = func() time.Time { return now }
+			sends := 0
+			send := func(ctx context.Context, m Message, part twitter.DirectMessageRequest) (string, error) {
+				sends++
+				return "42", nil
+			}
+
+			report, err := o.Drain(ctx, send, 10)
+			if err != nil {
+				t.Fatalf("Drain failed with error: %v", err)
+			}
+			if len(report.Sent) != tc.sent || sends != tc.sent {
+				t.Fatalf("got: %v sent %v sends, wanted: %v", len(report.Sent), sends, tc.sent)
+			}
+			if due, _ := memory.Due(ctx, now.Add(time.Hour), 10); tc.sent > 0 && len(due) != 0 {
+				t.Fatalf("got: %+v due, wanted: the sent message not due again", due)
+			}
+			if m := memory.messages["m1"]; tc.sent > 0 && (m.Status != StatusSent || m.ExpiresAt != now.Add(policy.KeepSent).Unix()) {
+				t.Fatalf("got: %+v, wanted the sent message to expire", m)
+			}
+		})
+	}
+}
+
+func TestDrainParts(t *testing.T) {
+	now := time.Unix(1562101000, 0)
+	policy := Policy{BaseDelay: time.Minute, MaxDelay: time.Hour, MaxAttempts: 3, Lease: time.Minute}
+	parts := make([]twitter.DirectMessageRequest, 0, 3)
+	for _, text := range []string{"1/3", "2/3", "3/3"} {
+		var req twitter.DirectMessageRequest
+		req.Event.MessageCreate.MessageData.Text = text
+		parts = append(parts, req)
+	}
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Put(ctx, Message{ID: "m1", Status: StatusPending, Requests: parts, NextAttempt: now.Unix()})
+	o := New(store, policy)
+	o.now = func() time.Time { return now }
+
+	var sent []string
+	failAt := "3/3"
+	send := func(ctx context.Context, m Message, part twitter.DirectMessageRequest) (string, error) {
+		text := part.Event.MessageCreate.MessageData.Text
+		if text == failAt {
+			return "", testError{retryable: true}
+		}
+		sent = append(sent, text)
+		return text, nil
+	}
+
+	if _, err := o.Drain(ctx, send, 10); err != nil {
+		t.Fatalf("Drain failed with error: %v", err)
+	}
+	failAt = ""
+	o.now = func() time.Time { return now.Add(time.Hour) }
+	if _, err := o.Drain(ctx, send, 10); err != nil {
+		t.Fatalf("Drain failed with error: %v", err)
+	}
+	if fmt.Sprint(sent) != "[1/3 2/3 3/3]" {
+		t.Fatalf("got: %v, wanted each part once in order", sent)
+	}
+}
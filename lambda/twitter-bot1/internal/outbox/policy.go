@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Policy how often and how long apart a message is tried
+type Policy struct {
+	// BaseDelay wait after the first failed attempt, doubled after each
+	// further attempt
+	BaseDelay time.Duration
+	// MaxDelay longest wait between attempts
+	MaxDelay time.Duration
+	// MaxAttempts attempts before a message becomes a dead letter
+	MaxAttempts int
+	// Lease how long a message claimed by a drain is kept from other
+	// drains
+	Lease time.Duration
+	// KeepSent how long a sent message that could not be deleted is kept
+	// before the table's TTL removes it
+	KeepSent time.Duration
+}
+
+// DefaultPolicy tries a message for about a day
+var DefaultPolicy = Policy{
+	BaseDelay:   time.Minute,
+	MaxDelay:    4 * time.Hour,
+	MaxAttempts: 12,
+	Lease:       5 * time.Minute,
+	KeepSent:    24 * time.Hour,
+}
+
+// Backoff returns the wait after attempts failed attempts.
+func (p Policy) Backoff(attempts int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempts && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,184 @@
+// Package phash computes perceptual hashes of pictures. Pictures that look the
+// same have hashes a few bits apart, even when one is a resized or
+// recompressed copy of the other, unlike their SHA-256 checksums.
+//
+// The hash is a difference hash (dHash): the picture is reduced to 9x8 grey
+// cells and every bit tells whether a cell is darker than its right
+// neighbour.
+package phash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	// decoders of the picture types accepted by the media package
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	cols = 9
+	rows = 8
+)
+
+// Hash perceptual hash of a picture
+type Hash uint64
+
+// String returns h as 16 hex digits.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Distance returns the number of bits h and o differ in, 0 for the same
+// picture and around 32 for unrelated ones.
+func (h Hash) Distance(o Hash) int {
+	return bits.OnesCount64(uint64(h ^ o))
+}
+
+// Parse parses a hash written by String.
+func Parse(s string) (Hash, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("perceptual hash %q is not 16 hex digits", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("perceptual hash %q is not 16 hex digits", s)
+	}
+	return Hash(v), nil
+}
+
+// FromImage returns the hash of img.
+func FromImage(img image.Image) Hash {
+	var sums [rows][cols]uint64
+	var counts [rows][cols]uint64
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		r := y * rows / h
+		for x := 0; x < w; x++ {
+			c := x * cols / w
+			sums[r][c] += uint64(luma(img, b.Min.X+x, b.Min.Y+y))
+			counts[r][c]++
+		}
+	}
+
+	var cells [rows][cols]uint64
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if counts[r][c] > 0 {
+				cells[r][c] = sums[r][c] / counts[r][c]
+			}
+		}
+	}
+
+	var hash Hash
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols-1; c++ {
+			hash <<= 1
+			if cells[r][c] < cells[r][c+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// luma returns the brightness of a pixel. JPEG pictures decode to YCbCr,
+// their Y plane is read directly.
+func luma(img image.Image, x int, y int) uint8 {
+	switch p := img.(type) {
+	case *image.YCbCr:
+		return p.Y[p.YOffset(x, y)]
+	case *image.Gray:
+		return p.Pix[p.PixOffset(x, y)]
+	}
+	return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+}
+
+// Decode reads a JPEG or PNG picture from r and returns its hash.
+func Decode(r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("decode picture: %v", err)
+	}
+	return FromImage(img), nil
+}
+
+// Writer hashes the picture written to it, it is decoded while it is written
+// so the picture can be streamed elsewhere at the same time. Writes never
+// fail, a picture that can not be decoded is reported by Sum.
+type Writer struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	hash Hash
+	err  error
+}
+
+// NewWriter returns a Writer, Close or Sum must be called to release it.
+func NewWriter() *Writer {
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		w.hash, w.err = Decode(pr)
+		// the decoder may stop before the end, the rest is drained so
+		// that writes do not block
+		io.Copy(ioutil.Discard, pr)
+	}()
+	return w
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close ends the picture and waits for the decoder.
+func (w *Writer) Close() error {
+	w.pw.Close()
+	<-w.done
+	return nil
+}
+
+// Sum closes w and returns the hash of the picture written.
+func (w *Writer) Sum() (Hash, error) {
+	w.Close()
+	return w.hash, w.err
+}
+
+// Blocklist hashes of pictures the bot refuses, e.g. known abusive images
+type Blocklist []Hash
+
+// ParseBlocklist parses hashes separated by commas or white space.
+func ParseBlocklist(s string) (Blocklist, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+	list := make(Blocklist, 0, len(fields))
+	for _, f := range fields {
+		h, err := Parse(f)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, nil
+}
+
+// Match returns the hash of the list nearest to h, if it is at most
+// maxDistance bits away.
+func (b Blocklist) Match(h Hash, maxDistance int) (Hash, bool) {
+	best, bestDistance := Hash(0), -1
+	for _, blocked := range b {
+		if d := h.Distance(blocked); d <= maxDistance && (bestDistance < 0 || d < bestDistance) {
+			best, bestDistance = blocked, d
+		}
+	}
+	return best, bestDistance >= 0
+}
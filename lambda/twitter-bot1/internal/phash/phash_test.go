@@ -0,0 +1,141 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// picture draws a 320x240 picture with a gradient and a few shapes, mirrored
+// left to right when mirror is set
+func picture(mirror bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			px := x
+			if mirror {
+				px = 319 - x
+			}
+			v := uint8(px * 255 / 320)
+			if px > 40 && px < 120 && y > 60 && y < 140 {
+				v = 250
+			}
+			if (px-230)*(px-230)+(y-170)*(y-170) < 40*40 {
+				v = 20
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+// resize scales img to w x h, nearest neighbour
+func resize(img image.Image, w int, h int) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return out
+}
+
+func encodeJPEG(img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	return buf.Bytes()
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestDistance(t *testing.T) {
+	original, err := Decode(bytes.NewReader(encodeJPEG(picture(false), 90)))
+	if err != nil {
+		t.Fatalf("Decode failed with error: %v", err)
+	}
+
+	tt := []struct {
+		name    string
+		picture []byte
+		// near a copy of the original
+		near bool
+	}{
+		{name: "recompressed", picture: encodeJPEG(picture(false), 30), near: true},
+		{name: "resized", picture: encodeJPEG(resize(picture(false), 133, 100), 60), near: true},
+		{name: "png", picture: encodePNG(picture(false)), near: true},
+		{name: "mirrored", picture: encodeJPEG(picture(true), 90), near: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := Decode(bytes.NewReader(tc.picture))
+			if err != nil {
+				t.Fatalf("Decode failed with error: %v", err)
+			}
+			d := original.Distance(h)
+			if (d <= 3) != tc.near || (!tc.near && d < 10) {
+				t.Fatalf("got: distance %v, wanted near: %v", d, tc.near)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	jpg := encodeJPEG(picture(false), 90)
+	want, _ := Decode(bytes.NewReader(jpg))
+
+	tt := []struct {
+		name string
+		body []byte
+		err  bool
+	}{
+		{name: "picture", body: jpg},
+		{name: "notAPicture", body: []byte(strings.Repeat("<html></html>", 1000)), err: true},
+		{name: "truncated", body: jpg[:len(jpg)/2], err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewWriter()
+			// read through the writer in small chunks, as an upload would
+			var copied bytes.Buffer
+			buf := make([]byte, 100)
+			if _, err := io.CopyBuffer(&copied, io.TeeReader(bytes.NewReader(tc.body), w), buf); err != nil {
+				t.Fatalf("copy failed with error: %v", err)
+			}
+			h, err := w.Sum()
+			if !bytes.Equal(copied.Bytes(), tc.body) {
+				t.Fatalf("got: %v bytes copied, wanted: %v", copied.Len(), len(tc.body))
+			}
+			if (err != nil) != tc.err || (!tc.err && h != want) {
+				t.Fatalf("got: %v %v, wanted: %v error %v", h, err, want, tc.err)
+			}
+		})
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	list, err := ParseBlocklist("00000000000000ff, 0f0f0f0f0f0f0f0f\nffffffffffffffff")
+	if err != nil {
+		t.Fatalf("ParseBlocklist failed with error: %v", err)
+	}
+	if got, ok := list.Match(0x00000000000000fe, 3); !ok || got != 0x00000000000000ff {
+		t.Fatalf("got: %v %v, wanted: 00000000000000ff", got, ok)
+	}
+	if _, ok := list.Match(0x00000000ffff0000, 3); ok {
+		t.Fatalf("got: a match, wanted: none")
+	}
+	if _, err := ParseBlocklist("00000000000000ff,not-a-hash"); err == nil {
+		t.Fatalf("got: no error for an invalid hash")
+	}
+}
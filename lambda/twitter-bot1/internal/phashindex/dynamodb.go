@@ -0,0 +1,198 @@
+package phashindex
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+)
+
+// maxBatchWriteAttempts BatchWriteItem calls made before Add gives up on its
+// unprocessed items
+const maxBatchWriteAttempts = 5
+
+// checksumPrefix starts the partition key of the item keeping a picture's
+// hash, Remove reads it to find the bands
+const checksumPrefix = "checksum#"
+
+// DynamoDBIndex stores an item per band of a hash in a table with the string
+// partition key band and the string sort key checksum, and one more with the
+// partition key checksumPrefix and the checksum. Pictures indexed before that
+// item was written can not be removed.
+type DynamoDBIndex struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	// sleep waits between the attempts of a batch
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type item struct {
+	Band     string `json:"band"`
+	Checksum string `json:"checksum"`
+	Hash     string `json:"hash"`
+}
+
+// NewDynamoDBIndex returns an index using table.
+func NewDynamoDBIndex(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBIndex {
+	return &DynamoDBIndex{
+		client: client,
+		table:  table,
+		sleep:  sleep,
+	}
+}
+
+// Add implements Index.
+func (d *DynamoDBIndex) Add(ctx context.Context, e Entry) error {
+	requests := make([]*dynamodb.WriteRequest, 0, Bands+1)
+	for _, b := range partitions(e) {
+		av, err := dynamodbattribute.MarshalMap(item{
+			Band:     b,
+			Checksum: e.Checksum,
+			Hash:     e.Hash.String(),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal hash item: %v", err)
+		}
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}})
+	}
+	if err := d.batchWrite(ctx, requests); err != nil {
+		return fmt.Errorf("put hash items: %v", err)
+	}
+	return nil
+}
+
+// Remove implements Index.
+func (d *DynamoDBIndex) Remove(ctx context.Context, checksum string) error {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            itemKey(checksumPrefix+checksum, checksum),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("get hash item: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return nil
+	}
+	var it item
+	if err := dynamodbattribute.UnmarshalMap(out.Item, &it); err != nil {
+		return fmt.Errorf("unmarshal hash item: %v", err)
+	}
+	h, err := phash.Parse(it.Hash)
+	if err != nil {
+		return fmt.Errorf("unmarshal hash item: %v", err)
+	}
+
+	requests := make([]*dynamodb.WriteRequest, 0, Bands+1)
+	// the checksum item goes last, a failed remove can be repeated
+	for _, b := range partitions(Entry{Hash: h, Checksum: checksum}) {
+		requests = append(requests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{Key: itemKey(b, checksum)},
+		})
+	}
+	if err := d.batchWrite(ctx, requests[:Bands]); err != nil {
+		return fmt.Errorf("delete hash items: %v", err)
+	}
+	if err := d.batchWrite(ctx, requests[Bands:]); err != nil {
+		return fmt.Errorf("delete hash items: %v", err)
+	}
+	return nil
+}
+
+// batchWrite writes requests, at most 25 of them. Unprocessed items are
+// retried with a growing wait, items still not written after
+// maxBatchWriteAttempts fail.
+func (d *DynamoDBIndex) batchWrite(ctx context.Context, requests []*dynamodb.WriteRequest) error {
+	pending := map[string][]*dynamodb.WriteRequest{d.table: requests}
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == maxBatchWriteAttempts {
+			return fmt.Errorf("%d unprocessed after %d attempts", len(pending[d.table]), attempt)
+		}
+		if attempt > 0 {
+			if err := d.sleep(ctx, time.Duration(attempt)*100*time.Millisecond); err != nil {
+				return err
+			}
+		}
+		out, err := d.client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: pending,
+		})
+		if err != nil {
+			return err
+		}
+		pending = out.UnprocessedItems
+	}
+	return nil
+}
+
+// Nearest implements Index.
+func (d *DynamoDBIndex) Nearest(ctx context.Context, hash phash.Hash, maxDistance int) ([]Match, error) {
+	candidates := make([]Entry, 0)
+	for i := 0; i < Bands; i++ {
+		var unmarshalErr error
+		err := d.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.table),
+			KeyConditionExpression: aws.String("#band = :band"),
+			ExpressionAttributeNames: map[string]*string{
+				"#band": aws.String("band"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":band": {S: aws.String(band(hash, i))},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			items := make([]item, 0, len(page.Items))
+			if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); unmarshalErr != nil {
+				return false
+			}
+			for _, it := range items {
+				h, err := phash.Parse(it.Hash)
+				if err != nil {
+					unmarshalErr = err
+					return false
+				}
+				candidates = append(candidates, Entry{Hash: h, Checksum: it.Checksum})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("query hash band: %v", err)
+		}
+		if unmarshalErr != nil {
+			return nil, fmt.Errorf("unmarshal hash items: %v", unmarshalErr)
+		}
+	}
+	return nearest(candidates, hash, maxDistance), nil
+}
+
+// partitions returns the partition keys of the items of e, the bands and
+// last the checksum item.
+func partitions(e Entry) []string {
+	keys := make([]string, 0, Bands+1)
+	for i := 0; i < Bands; i++ {
+		keys = append(keys, band(e.Hash, i))
+	}
+	return append(keys, checksumPrefix+e.Checksum)
+}
+
+func itemKey(partition string, checksum string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"band":     {S: aws.String(partition)},
+		"checksum": {S: aws.String(checksum)},
+	}
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package phashindex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeDynamoDB leaves every write unprocessed
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	batches int
+}
+
+func (f *fakeDynamoDB) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	f.batches++
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: input.RequestItems}, nil
+}
+
+func TestAddUnprocessed(t *testing.T) {
+	tt := []struct {
+		name    string
+		cancel  bool
+		batches int
+	}{
+		{name: "attemptsRunOut", batches: maxBatchWriteAttempts},
+		{name: "canceled", cancel: true, batches: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := &fakeDynamoDB{}
+			d := NewDynamoDBIndex(client, "hashes")
+			if tc.cancel {
+				cancel()
+			} else {
+				d.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+			}
+
+			if err := d.Add(ctx, Entry{Hash: 0x0123456789abcdef, Checksum: "original"}); err == nil {
+				t.Fatalf("got: no error, wanted the unprocessed items")
+			}
+			if client.batches != tc.batches {
+				t.Fatalf("got: %v batches, wanted: %v", client.batches, tc.batches)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package phashindex finds stored pictures that look like a picture, by their
+// perceptual hashes. A hash is split into Bands bands of 16 bits and indexed
+// under each band: hashes at most Bands-1 bits apart share a band, so a lookup
+// up to that distance finds every match. Entries name the picture by checksum
+// and no sender.
+package phashindex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+)
+
+// Bands number of 16 bit bands of a hash
+const Bands = 4
+
+// Entry the perceptual hash of a stored picture
+type Entry struct {
+	Hash phash.Hash
+	// Checksum hex SHA-256 of the picture
+	Checksum string
+}
+
+// Match an entry near the hash looked up
+type Match struct {
+	Entry
+	Distance int
+}
+
+// Index finds pictures by perceptual hash
+type Index interface {
+	// Add records e, adding a picture again is not an error.
+	Add(ctx context.Context, e Entry) error
+	// Remove forgets the picture checksum once it is deleted, removing an
+	// unknown picture is not an error.
+	Remove(ctx context.Context, checksum string) error
+	// Nearest returns the entries at most maxDistance bits from hash,
+	// nearest first.
+	Nearest(ctx context.Context, hash phash.Hash, maxDistance int) ([]Match, error)
+}
+
+// band returns the i-th band of h, prefixed by i so that equal bits in
+// different positions do not collide.
+func band(h phash.Hash, i int) string {
+	return fmt.Sprintf("%d:%04x", i, uint16(h>>uint(16*(Bands-1-i))))
+}
+
+// nearest returns the matches of candidates, sorted.
+func nearest(candidates []Entry, hash phash.Hash, maxDistance int) []Match {
+	seen := make(map[string]bool)
+	matches := make([]Match, 0)
+	for _, e := range candidates {
+		if seen[e.Checksum] {
+			continue
+		}
+		seen[e.Checksum] = true
+		if d := hash.Distance(e.Hash); d <= maxDistance {
+			matches = append(matches, Match{Entry: e, Distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Checksum < matches[j].Checksum
+	})
+	return matches
+}
+
+// MemoryIndex keeps the index in memory
+type MemoryIndex struct {
+	mu    sync.Mutex
+	bands map[string]map[string]Entry
+}
+
+// NewMemoryIndex returns an empty MemoryIndex.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{bands: make(map[string]map[string]Entry)}
+}
+
+// Add implements Index.
+func (m *MemoryIndex) Add(ctx context.Context, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < Bands; i++ {
+		b := band(e.Hash, i)
+		if m.bands[b] == nil {
+			m.bands[b] = make(map[string]Entry)
+		}
+		m.bands[b][e.Checksum] = e
+	}
+	return nil
+}
+
+// Remove implements Index.
+func (m *MemoryIndex) Remove(ctx context.Context, checksum string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entries := range m.bands {
+		delete(entries, checksum)
+	}
+	return nil
+}
+
+// Nearest implements Index.
+func (m *MemoryIndex) Nearest(ctx context.Context, hash phash.Hash, maxDistance int) ([]Match, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	candidates := make([]Entry, 0)
+	for i := 0; i < Bands; i++ {
+		for _, e := range m.bands[band(hash, i)] {
+			candidates = append(candidates, e)
+		}
+	}
+	return nearest(candidates, hash, maxDistance), nil
+}
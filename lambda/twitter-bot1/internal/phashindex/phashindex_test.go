@@ -0,0 +1,50 @@
+package phashindex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+)
+
+func TestNearest(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryIndex()
+	index.Add(ctx, Entry{Hash: 0x0123456789abcdef, Checksum: "original"})
+	// three bits off, one in each of three bands
+	index.Add(ctx, Entry{Hash: 0x1123556789abcdee, Checksum: "copy"})
+	index.Add(ctx, Entry{Hash: 0xfedcba9876543210, Checksum: "other"})
+
+	tt := []struct {
+		name        string
+		hash        phash.Hash
+		maxDistance int
+		checksums   []string
+	}{
+		{name: "exact", hash: 0x0123456789abcdef, maxDistance: 0, checksums: []string{"original"}},
+		{name: "nearFirst", hash: 0x0123456789abcdef, maxDistance: 3, checksums: []string{"original", "copy"}},
+		{name: "oneBitOff", hash: 0x0123456789abcdee, maxDistance: 3, checksums: []string{"original", "copy"}},
+		{name: "none", hash: 0x00000000ffffffff, maxDistance: 3, checksums: []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := index.Nearest(ctx, tc.hash, tc.maxDistance)
+			if err != nil {
+				t.Fatalf("Nearest failed with error: %v", err)
+			}
+			got := make([]string, 0, len(matches))
+			for _, m := range matches {
+				got = append(got, m.Checksum)
+			}
+			if len(got) != len(tc.checksums) {
+				t.Fatalf("got: %v, wanted: %v", got, tc.checksums)
+			}
+			for i := range got {
+				if got[i] != tc.checksums[i] {
+					t.Fatalf("got: %v, wanted: %v", got, tc.checksums)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package pictureindex
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// batchWriteLimit max number of requests in one BatchWriteItem call
+const batchWriteLimit = 25
+
+// maxBatchWriteAttempts BatchWriteItem calls made for one batch before
+// Delete gives up on its unprocessed items
+const maxBatchWriteAttempts = 5
+
+// AccountIndex name of the global secondary index of the table with the
+// partition key for_user_id and the sort key owner
+const AccountIndex = "for_user_id-owner"
+
+// objectPrefix starts the partition key of the items listing an object's
+// owners, owners are numeric twitter user ids
+const objectPrefix = "object#"
+
+// DynamoDBIndex stores two items per object and owner in a table with the
+// string partition key owner and the string sort key object. One has the
+// owner, Owner.String, as partition key and the object as sort key, List
+// queries them. The other swaps the two, the partition key prefixed with
+// objectPrefix, so Owners is a consistent query of the table too. Senders
+// queries the AccountIndex.
+type DynamoDBIndex struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	// sleep waits between the attempts of a batch
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type item struct {
+	Owner     string `json:"owner"`
+	ForUserID string `json:"for_user_id"`
+	SenderID  string `json:"sender_id"`
+	Object    string `json:"object"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+}
+
+// NewDynamoDBIndex returns an index using table.
+func NewDynamoDBIndex(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBIndex {
+	return &DynamoDBIndex{
+		client: client,
+		table:  table,
+		sleep:  sleep,
+	}
+}
+
+// Add implements Index. Both items are written in one transaction.
+func (d *DynamoDBIndex) Add(ctx context.Context, owner Owner, obj Object) error {
+	it := item{
+		Owner:     owner.String(),
+		ForUserID: owner.ForUserID,
+		SenderID:  owner.SenderID,
+		Object:    obj.String(),
+		Bucket:    obj.Bucket,
+		Key:       obj.Key,
+	}
+	reverse := it
+	reverse.Owner, reverse.Object = objectPrefix+obj.String(), owner.String()
+
+	puts := make([]*dynamodb.TransactWriteItem, 0, 2)
+	for _, it := range []item{it, reverse} {
+		av, err := dynamodbattribute.MarshalMap(it)
+		if err != nil {
+			return fmt.Errorf("marshal index item: %v", err)
+		}
+		puts = append(puts, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{TableName: aws.String(d.table), Item: av},
+		})
+	}
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: puts,
+	})
+	if err != nil {
+		return fmt.Errorf("put index item: %v", err)
+	}
+	return nil
+}
+
+// Remove implements Index.
+func (d *DynamoDBIndex) Remove(ctx context.Context, owner Owner, obj Object) error {
+	deletes := make([]*dynamodb.TransactWriteItem, 0, 2)
+	for _, key := range itemKeys(owner, obj) {
+		deletes = append(deletes, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{TableName: aws.String(d.table), Key: key},
+		})
+	}
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: deletes,
+	})
+	if err != nil {
+		return fmt.Errorf("delete index item: %v", err)
+	}
+	return nil
+}
+
+// List implements Index.
+func (d *DynamoDBIndex) List(ctx context.Context, owner Owner) ([]Object, error) {
+	objects := make([]Object, 0)
+	err := d.query(ctx, owner.String(), func(it item) {
+		objects = append(objects, Object{Bucket: it.Bucket, Key: it.Key})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Owners implements Index. The read is consistent, an owner added a moment
+// ago is included.
+func (d *DynamoDBIndex) Owners(ctx context.Context, obj Object) ([]Owner, error) {
+	owners := make([]Owner, 0)
+	err := d.query(ctx, objectPrefix+obj.String(), func(it item) {
+		owners = append(owners, Owner{ForUserID: it.ForUserID, SenderID: it.SenderID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
+
+// Senders implements Index. The global secondary index is eventually
+// consistent, a sender added a moment ago may be missing.
+func (d *DynamoDBIndex) Senders(ctx context.Context, forUserID string) ([]string, error) {
+	prefix := Owner{ForUserID: forUserID}.String()
+	seen := make(map[string]bool)
+	senders := make([]string, 0)
+	var unmarshalErr error
+	err := d.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		IndexName:              aws.String(AccountIndex),
+		KeyConditionExpression: aws.String("for_user_id = :account AND begins_with(#owner, :prefix)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":account": {S: aws.String(forUserID)},
+			":prefix":  {S: aws.String(prefix)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items := make([]item, 0, len(page.Items))
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); unmarshalErr != nil {
+			return false
+		}
+		// the index only projects the keys, the sender is in the owner
+		for _, it := range items {
+			senderID := strings.TrimPrefix(it.Owner, prefix)
+			if !seen[senderID] {
+				seen[senderID] = true
+				senders = append(senders, senderID)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query account index: %v", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("unmarshal index items: %v", unmarshalErr)
+	}
+	return senders, nil
+}
+
+// Delete implements Index. Unprocessed items are retried with a growing
+// wait, a batch still not done after maxBatchWriteAttempts fails.
+func (d *DynamoDBIndex) Delete(ctx context.Context, owner Owner) error {
+	objects, err := d.List(ctx, owner)
+	if err != nil {
+		return err
+	}
+	requests := make([]*dynamodb.WriteRequest, 0, 2*len(objects))
+	for _, obj := range objects {
+		for _, key := range itemKeys(owner, obj) {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{Key: key},
+			})
+		}
+	}
+
+	for start := 0; start < len(requests); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(requests) {
+			end = len(requests)
+		}
+		pending := map[string][]*dynamodb.WriteRequest{d.table: requests[start:end]}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchWriteAttempts {
+				return fmt.Errorf("delete index items: %d unprocessed after %d attempts", len(pending[d.table]), attempt)
+			}
+			if attempt > 0 {
+				if err := d.sleep(ctx, time.Duration(attempt)*100*time.Millisecond); err != nil {
+					return fmt.Errorf("delete index items: %v", err)
+				}
+			}
+			out, err := d.client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: pending,
+			})
+			if err != nil {
+				return fmt.Errorf("delete index items: %v", err)
+			}
+			pending = out.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// query calls fn with every item in the partition.
+func (d *DynamoDBIndex) query(ctx context.Context, partition string, fn func(item)) error {
+	var unmarshalErr error
+	err := d.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		KeyConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(partition)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items := make([]item, 0, len(page.Items))
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); unmarshalErr != nil {
+			return false
+		}
+		for _, it := range items {
+			fn(it)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("query index: %v", err)
+	}
+	if unmarshalErr != nil {
+		return fmt.Errorf("unmarshal index items: %v", unmarshalErr)
+	}
+	return nil
+}
+
+// itemKeys returns the keys of the two items of owner and obj.
+func itemKeys(owner Owner, obj Object) []map[string]*dynamodb.AttributeValue {
+	return []map[string]*dynamodb.AttributeValue{
+		{
+			"owner":  {S: aws.String(owner.String())},
+			"object": {S: aws.String(obj.String())},
+		},
+		{
+			"owner":  {S: aws.String(objectPrefix + obj.String())},
+			"object": {S: aws.String(owner.String())},
+		},
+	}
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package pictureindex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeDynamoDB lists one object and leaves every delete unprocessed
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	batches int
+}
+
+func (f *fakeDynamoDB) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	av, _ := dynamodbattribute.MarshalMap(item{Owner: "4337869213/alice", Object: "s3://pictures/1.jpg", Bucket: "pictures", Key: "1.jpg"})
+	fn(&dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{av}}, true)
+	return nil
+}
+
+func (f *fakeDynamoDB) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	f.batches++
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: input.RequestItems}, nil
+}
+
+func TestDeleteUnprocessed(t *testing.T) {
+	owner := Owner{ForUserID: "4337869213", SenderID: "alice"}
+	tt := []struct {
+		name    string
+		cancel  bool
+		batches int
+	}{
+		{name: "attemptsRunOut", batches: maxBatchWriteAttempts},
+		{name: "canceled", cancel: true, batches: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := &fakeDynamoDB{}
+			d := NewDynamoDBIndex(client, "index")
+			if tc.cancel {
+				cancel()
+			} else {
+				d.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+			}
+
+			if err := d.Delete(ctx, owner); err == nil {
+				t.Fatalf("got: no error, wanted the unprocessed items'")
+			}
+			if client.batches != tc.batches {
+				t.Fatalf("got: %v batches, wanted: %v", client.batches, tc.batches)
+			}
+		})
+	}
+}
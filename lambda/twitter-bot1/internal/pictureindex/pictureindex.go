@@ -0,0 +1,137 @@
+// Package pictureindex records which stored objects belong to which sender
+// of which bot account, the keys in PictureBucket do not contain the sender.
+// Pictures are stored by their content, so one object can belong to several
+// senders.
+package pictureindex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Object a stored picture or analysis
+type Object struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// String returns the s3 url of o.
+func (o Object) String() string {
+	return fmt.Sprintf("s3://%s/%s", o.Bucket, o.Key)
+}
+
+// Owner a sender of one bot account, the same user sending to two accounts
+// are two owners
+type Owner struct {
+	ForUserID string `json:"for_user_id"`
+	SenderID  string `json:"sender_id"`
+}
+
+// String returns the key of o in the DynamoDB table.
+func (o Owner) String() string {
+	return o.ForUserID + "/" + o.SenderID
+}
+
+// Index maps owners to their stored objects
+type Index interface {
+	// Add records that obj belongs to owner.
+	Add(ctx context.Context, owner Owner, obj Object) error
+	// Remove forgets a single object of owner.
+	Remove(ctx context.Context, owner Owner, obj Object) error
+	// List returns all objects recorded for owner.
+	List(ctx context.Context, owner Owner) ([]Object, error)
+	// Owners returns the owners obj is recorded for. The read is
+	// consistent, deciding whether an object is shared relies on it.
+	Owners(ctx context.Context, obj Object) ([]Owner, error)
+	// Delete forgets all objects of owner. The objects themselves are not
+	// touched.
+	Delete(ctx context.Context, owner Owner) error
+	// Senders returns the senders of the account forUserID with objects.
+	Senders(ctx context.Context, forUserID string) ([]string, error)
+}
+
+// MemoryIndex keeps the index in memory
+type MemoryIndex struct {
+	mu      sync.Mutex
+	objects map[Owner]map[Object]struct{}
+}
+
+// NewMemoryIndex returns an empty MemoryIndex.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		objects: make(map[Owner]map[Object]struct{}),
+	}
+}
+
+// Add implements Index.
+func (m *MemoryIndex) Add(ctx context.Context, owner Owner, obj Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects[owner] == nil {
+		m.objects[owner] = make(map[Object]struct{})
+	}
+	m.objects[owner][obj] = struct{}{}
+	return nil
+}
+
+// Remove implements Index.
+func (m *MemoryIndex) Remove(ctx context.Context, owner Owner, obj Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects[owner], obj)
+	return nil
+}
+
+// List implements Index. Objects are sorted by bucket and key.
+func (m *MemoryIndex) List(ctx context.Context, owner Owner) ([]Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objects := make([]Object, 0, len(m.objects[owner]))
+	for obj := range m.objects[owner] {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].String() < objects[j].String()
+	})
+	return objects, nil
+}
+
+// Owners implements Index. Owners are sorted.
+func (m *MemoryIndex) Owners(ctx context.Context, obj Object) ([]Owner, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	owners := make([]Owner, 0)
+	for owner, objects := range m.objects {
+		if _, ok := objects[obj]; ok {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		return owners[i].String() < owners[j].String()
+	})
+	return owners, nil
+}
+
+// Senders implements Index. Senders are sorted.
+func (m *MemoryIndex) Senders(ctx context.Context, forUserID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	senders := make([]string, 0)
+	for owner, objects := range m.objects {
+		if owner.ForUserID == forUserID && len(objects) > 0 {
+			senders = append(senders, owner.SenderID)
+		}
+	}
+	sort.Strings(senders)
+	return senders, nil
+}
+
+// Delete implements Index.
+func (m *MemoryIndex) Delete(ctx context.Context, owner Owner) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, owner)
+	return nil
+}
@@ -0,0 +1,111 @@
+package picturestore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Object metadata written with an envelope
+const (
+	metaDataKey   = "X-Bot-Data-Key"
+	metaNonce     = "X-Bot-Nonce"
+	metaKeyID     = "X-Bot-Key-Id"
+	metaAlgorithm = "X-Bot-Algorithm"
+
+	algorithmAESGCM = "AES/GCM/NoPadding"
+)
+
+// seal encrypts plaintext with a new data key and returns the ciphertext and
+// the object metadata needed to decrypt it.
+func seal(ctx context.Context, keys KeyProvider, encContext map[string]string, plaintext []byte) ([]byte, map[string]*string, error) {
+	dataKey, err := keys.GenerateDataKey(ctx, encContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate data key: %v", err)
+	}
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("generate nonce: %v", err)
+	}
+
+	metadata := map[string]*string{
+		metaDataKey:   aws.String(base64.StdEncoding.EncodeToString(dataKey.Ciphertext)),
+		metaNonce:     aws.String(base64.StdEncoding.EncodeToString(nonce)),
+		metaKeyID:     aws.String(dataKey.KeyID),
+		metaAlgorithm: aws.String(algorithmAESGCM),
+	}
+	return gcm.Seal(nil, nonce, plaintext, nil), metadata, nil
+}
+
+// open reverses seal.
+func open(ctx context.Context, keys KeyProvider, encContext map[string]string, metadata map[string]*string, ciphertext []byte) ([]byte, error) {
+	if alg := metadataValue(metadata, metaAlgorithm); alg != algorithmAESGCM {
+		return nil, fmt.Errorf("unsupported envelope algorithm %q", alg)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadataValue(metadata, metaDataKey))
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %v", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(metadataValue(metadata, metaNonce))
+	if err != nil {
+		return nil, fmt.Errorf("decode nonce: %v", err)
+	}
+
+	plainKey, err := keys.Decrypt(ctx, DataKey{
+		KeyID:      metadataValue(metadata, metaKeyID),
+		Ciphertext: wrapped,
+	}, encContext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key: %v", err)
+	}
+
+	gcm, err := newGCM(plainKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("nonce has %d bytes, wanted %d", len(nonce), gcm.NonceSize())
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt object: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("data key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func hasEnvelope(metadata map[string]*string) bool {
+	return metadataValue(metadata, metaDataKey) != ""
+}
+
+// metadataValue looks up name ignoring case, s3 returns metadata keys with
+// canonical header casing.
+func metadataValue(metadata map[string]*string, name string) string {
+	if v, ok := metadata[name]; ok {
+		return aws.StringValue(v)
+	}
+	for k, v := range metadata {
+		if strings.EqualFold(k, name) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
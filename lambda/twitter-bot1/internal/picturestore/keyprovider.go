@@ -0,0 +1,138 @@
+package picturestore
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// dataKeySize AES-256
+const dataKeySize = 32
+
+// DataKey a data key, Plaintext is only set when the key was just generated
+type DataKey struct {
+	KeyID      string
+	Plaintext  []byte
+	Ciphertext []byte
+}
+
+// KeyProvider generates and unwraps per object data keys
+type KeyProvider interface {
+	GenerateDataKey(ctx context.Context, encContext map[string]string) (DataKey, error)
+	Decrypt(ctx context.Context, key DataKey, encContext map[string]string) ([]byte, error)
+}
+
+// KMSKeyProvider wraps data keys with a KMS customer master key
+type KMSKeyProvider struct {
+	client kmsiface.KMSAPI
+	keyID  string
+}
+
+// NewKMSKeyProvider returns a provider using keyID.
+func NewKMSKeyProvider(client kmsiface.KMSAPI, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client: client,
+		keyID:  keyID,
+	}
+}
+
+// GenerateDataKey implements KeyProvider.
+func (k *KMSKeyProvider) GenerateDataKey(ctx context.Context, encContext map[string]string) (DataKey, error) {
+	out, err := k.client.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(k.keyID),
+		KeySpec:           aws.String(kms.DataKeySpecAes256),
+		EncryptionContext: aws.StringMap(encContext),
+	})
+	if err != nil {
+		return DataKey{}, err
+	}
+	return DataKey{
+		KeyID:      aws.StringValue(out.KeyId),
+		Plaintext:  out.Plaintext,
+		Ciphertext: out.CiphertextBlob,
+	}, nil
+}
+
+// Decrypt implements KeyProvider.
+func (k *KMSKeyProvider) Decrypt(ctx context.Context, key DataKey, encContext map[string]string) ([]byte, error) {
+	out, err := k.client.DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob:    key.Ciphertext,
+		EncryptionContext: aws.StringMap(encContext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// LocalKeyProvider wraps data keys with a master key held in memory. It is
+// meant for tests and self-hosted setups without KMS.
+type LocalKeyProvider struct {
+	keyID     string
+	masterKey []byte
+}
+
+// NewLocalKeyProvider returns a provider wrapping with masterKey, which must
+// be 16, 24 or 32 bytes.
+func NewLocalKeyProvider(keyID string, masterKey []byte) (*LocalKeyProvider, error) {
+	if _, err := newGCM(masterKey); err != nil {
+		return nil, err
+	}
+	return &LocalKeyProvider{
+		keyID:     keyID,
+		masterKey: masterKey,
+	}, nil
+}
+
+// GenerateDataKey implements KeyProvider.
+func (l *LocalKeyProvider) GenerateDataKey(ctx context.Context, encContext map[string]string) (DataKey, error) {
+	plaintext := make([]byte, dataKeySize)
+	if _, err := rand.Read(plaintext); err != nil {
+		return DataKey{}, err
+	}
+	gcm, err := newGCM(l.masterKey)
+	if err != nil {
+		return DataKey{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return DataKey{}, err
+	}
+	return DataKey{
+		KeyID:      l.keyID,
+		Plaintext:  plaintext,
+		Ciphertext: gcm.Seal(nonce, nonce, plaintext, additionalData(encContext)),
+	}, nil
+}
+
+// Decrypt implements KeyProvider.
+func (l *LocalKeyProvider) Decrypt(ctx context.Context, key DataKey, encContext map[string]string) ([]byte, error) {
+	if key.KeyID != l.keyID {
+		return nil, fmt.Errorf("data key was wrapped with %q, not %q", key.KeyID, l.keyID)
+	}
+	gcm, err := newGCM(l.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+	nonce := key.Ciphertext[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, key.Ciphertext[gcm.NonceSize():], additionalData(encContext))
+}
+
+// additionalData serializes an encryption context in a stable order.
+func additionalData(encContext map[string]string) []byte {
+	pairs := make([]string, 0, len(encContext))
+	for k, v := range encContext {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return []byte(strings.Join(pairs, "&"))
+}
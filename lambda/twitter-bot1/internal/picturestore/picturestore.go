@@ -0,0 +1,403 @@
+// Package picturestore reads and writes pictures and analyses in s3. Objects
+// can be protected with SSE-KMS and, on top of that, with client-side envelope
+// encryption where every object gets its own data key. Pictures are stored by
+// the SHA-256 of their content, see ContentKey.
+package picturestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Encryption modes
+const (
+	EncryptionNone     = "none"
+	EncryptionSSEKMS   = "sse-kms"
+	EncryptionEnvelope = "envelope"
+)
+
+// Config how objects are encrypted
+type Config struct {
+	// Encryption one of the Encryption constants, empty means none
+	Encryption string
+	// KMSKeyID key used for SSE-KMS and by KMSKeyProvider. With SSE-KMS an
+	// empty id uses the bucket's default aws/s3 key.
+	KMSKeyID string
+}
+
+// PutInput an object to store
+type PutInput struct {
+	Bucket      string
+	Key         string
+	Body        []byte
+	ContentType string
+	// Tagging url encoded object tags
+	Tagging string
+}
+
+// StreamInput an object to store, read from Body until io.EOF
+type StreamInput struct {
+	Bucket      string
+	Key         string
+	Body        io.Reader
+	ContentType string
+	// Tagging url encoded object tags
+	Tagging string
+}
+
+// MoveInput an object to store under another key
+type MoveInput struct {
+	Bucket string
+	From   string
+	To     string
+	// Tagging url encoded tags of the moved object
+	Tagging string
+}
+
+// ErrNotFound returned by Get when the object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// codeNotFound error code of HeadObject for a missing object, it has no body
+// to carry s3.ErrCodeNoSuchKey
+const codeNotFound = "NotFound"
+
+// ContentKey returns the key of a picture by checksum, the hex encoded
+// SHA-256 of the picture, and ext, its file name extension. The same picture
+// sent twice is stored once.
+func ContentKey(checksum string, ext string) string {
+	return fmt.Sprintf("sha256/%s%s", checksum, ext)
+}
+
+// Checksum returns the checksum of a picture's ContentKey, false when key is
+// not one.
+func Checksum(key string) (string, bool) {
+	if !strings.HasPrefix(key, "sha256/") {
+		return "", false
+	}
+	name := strings.TrimPrefix(key, "sha256/")
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name, name != ""
+}
+
+// PartSize size of the parts of a multipart upload, the smallest s3 allows
+const PartSize = 5 << 20
+
+// Store reads and writes objects
+type Store struct {
+	s3       s3iface.S3API
+	keys     KeyProvider
+	sseKMS   bool
+	envelope bool
+	kmsKeyID string
+	partSize int
+}
+
+// New returns a Store for cfg. keys is required for envelope encryption.
+// Objects with an envelope are decrypted by Get whatever the configured
+// mode, as long as keys is set, so the mode can be changed without rewriting
+// the bucket.
+func New(cfg Config, s3Svc s3iface.S3API, keys KeyProvider) (*Store, error) {
+	s := &Store{
+		s3:       s3Svc,
+		keys:     keys,
+		kmsKeyID: cfg.KMSKeyID,
+		partSize: PartSize,
+	}
+	switch cfg.Encryption {
+	case "", EncryptionNone:
+	case EncryptionSSEKMS:
+		s.sseKMS = true
+	case EncryptionEnvelope:
+		if keys == nil {
+			return nil, fmt.Errorf("picture encryption %s requires a key provider", cfg.Encryption)
+		}
+		s.sseKMS = true
+		s.envelope = true
+	default:
+		return nil, fmt.Errorf("unknown picture encryption %q", cfg.Encryption)
+	}
+	return s, nil
+}
+
+// Put stores in.Body, encrypted according to the configuration.
+func (s *Store) Put(ctx context.Context, in PutInput) error {
+	body := in.Body
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(in.Bucket),
+		Key:         aws.String(in.Key),
+		ContentType: aws.String(in.ContentType),
+	}
+	if in.Tagging != "" {
+		input.Tagging = aws.String(in.Tagging)
+	}
+	if s.sseKMS {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		if s.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+	if s.envelope {
+		sealed, metadata, err := seal(ctx, s.keys, objectContext(in.Bucket, in.Key), in.Body)
+		if err != nil {
+			return err
+		}
+		body = sealed
+		input.Metadata = metadata
+	}
+	input.Body = bytes.NewReader(body)
+
+	_, err := s.s3.PutObjectWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("put object %s: %v", in.Key, err)
+	}
+	return nil
+}
+
+// PutStream stores in.Body, read to the end. A body larger than PartSize is
+// sent as a multipart upload, without holding more than a part in memory.
+// Envelope encryption seals the body as a whole, with it the body is read into
+// memory and Put.
+func (s *Store) PutStream(ctx context.Context, in StreamInput) error {
+	if s.envelope {
+		body, err := ioutil.ReadAll(in.Body)
+		if err != nil {
+			return fmt.Errorf("read object %s: %v", in.Key, err)
+		}
+		return s.Put(ctx, PutInput{Bucket: in.Bucket, Key: in.Key, Body: body, ContentType: in.ContentType, Tagging: in.Tagging})
+	}
+
+	part := make([]byte, s.partSize)
+	n, err := io.ReadFull(in.Body, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.Put(ctx, PutInput{Bucket: in.Bucket, Key: in.Key, Body: part[:n], ContentType: in.ContentType, Tagging: in.Tagging})
+	}
+	if err != nil {
+		return fmt.Errorf("read object %s: %v", in.Key, err)
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(in.Bucket),
+		Key:         aws.String(in.Key),
+		ContentType: aws.String(in.ContentType),
+	}
+	if in.Tagging != "" {
+		input.Tagging = aws.String(in.Tagging)
+	}
+	if s.sseKMS {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		if s.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+	upload, err := s.s3.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("create multipart upload %s: %v", in.Key, err)
+	}
+
+	parts, err := s.uploadParts(ctx, upload, part, in.Body)
+	if err != nil {
+		// without the abort s3 keeps the uploaded parts, and bills them
+		s.s3.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   upload.Bucket,
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		return fmt.Errorf("multipart upload %s: %v", in.Key, err)
+	}
+	_, err = s.s3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          upload.Bucket,
+		Key:             upload.Key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload %s: %v", in.Key, err)
+	}
+	return nil
+}
+
+// uploadParts uploads first, a full part, and the rest of body.
+func (s *Store) uploadParts(ctx context.Context, upload *s3.CreateMultipartUploadOutput, first []byte, body io.Reader) ([]*s3.CompletedPart, error) {
+	var parts []*s3.CompletedPart
+	part := first
+	for number := int64(1); len(part) > 0; number++ {
+		out, err := s.s3.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     upload.Bucket,
+			Key:        upload.Key,
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int64(number),
+			Body:       bytes.NewReader(part),
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.ETag, PartNumber: aws.Int64(number)})
+
+		n, err := io.ReadFull(body, first)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		part = first[:n]
+	}
+	return parts, nil
+}
+
+// Get returns the plaintext of an object. SSE-KMS is handled by s3, an
+// envelope is opened with the key provider.
+func (s *Store) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	out, err := s.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get object %s: %v", key, err)
+	}
+	defer out.Body.Close()
+
+	body, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read object %s: %v", key, err)
+	}
+
+	if !hasEnvelope(out.Metadata) {
+		return body, nil
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("object %s is envelope encrypted but no key provider is configured", key)
+	}
+	return open(ctx, s.keys, objectContext(bucket, key), out.Metadata, body)
+}
+
+// Exists reports whether the object key exists.
+func (s *Store) Exists(ctx context.Context, bucket string, key string) (bool, error) {
+	_, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == codeNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("head object %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// Move stores the object in.From at in.To and deletes in.From. s3 copies the
+// object, except with envelope encryption: the data key is bound to the key
+// of the object, so the plaintext is read and sealed again for in.To.
+func (s *Store) Move(ctx context.Context, in MoveInput) error {
+	if s.envelope {
+		out, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(in.Bucket),
+			Key:    aws.String(in.From),
+		})
+		if err != nil {
+			return fmt.Errorf("head object %s: %v", in.From, err)
+		}
+		body, err := s.Get(ctx, in.Bucket, in.From)
+		if err != nil {
+			return err
+		}
+		err = s.Put(ctx, PutInput{
+			Bucket:      in.Bucket,
+			Key:         in.To,
+			Body:        body,
+			ContentType: aws.StringValue(out.ContentType),
+			Tagging:     in.Tagging,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		input := &s3.CopyObjectInput{
+			Bucket:           aws.String(in.Bucket),
+			Key:              aws.String(in.To),
+			CopySource:       aws.String((&url.URL{Path: in.Bucket + "/" + in.From}).EscapedPath()),
+			TaggingDirective: aws.String(s3.TaggingDirectiveReplace),
+			Tagging:          aws.String(in.Tagging),
+		}
+		if s.sseKMS {
+			input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			if s.kmsKeyID != "" {
+				input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+			}
+		}
+		if _, err := s.s3.CopyObjectWithContext(ctx, input); err != nil {
+			return fmt.Errorf("copy object %s to %s: %v", in.From, in.To, err)
+		}
+	}
+	return s.Delete(ctx, in.Bucket, in.From)
+}
+
+// Tags returns the tags of an object, url encoded.
+func (s *Store) Tags(ctx context.Context, bucket string, key string) (string, error) {
+	out, err := s.s3.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get tags of %s: %v", key, err)
+	}
+	values := url.Values{}
+	for _, tag := range out.TagSet {
+		values.Set(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return values.Encode(), nil
+}
+
+// Tag replaces the tags of an object with tagging, url encoded tags.
+func (s *Store) Tag(ctx context.Context, bucket string, key string, tagging string) error {
+	values, err := url.ParseQuery(tagging)
+	if err != nil {
+		return fmt.Errorf("parse tags of %s: %v", key, err)
+	}
+	tagSet := make([]*s3.Tag, 0, len(values))
+	for k := range values {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(values.Get(k))})
+	}
+	_, err = s.s3.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("tag object %s: %v", key, err)
+	}
+	return nil
+}
+
+// Delete deletes an object, a missing object is not an error.
+func (s *Store) Delete(ctx context.Context, bucket string, key string) error {
+	_, err := s.s3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete object %s: %v", key, err)
+	}
+	return nil
+}
+
+// objectContext binds a data key to the object it encrypts.
+func objectContext(bucket string, key string) map[string]string {
+	return map[string]string{
+		"s3-object": fmt.Sprintf("%s/%s", bucket, key),
+	}
+}
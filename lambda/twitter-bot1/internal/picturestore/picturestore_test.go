@@ -0,0 +1,246 @@
+package picturestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type fakeObject struct {
+	body     []byte
+	metadata map[string]*string
+	input    *s3.PutObjectInput
+}
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]fakeObject
+	// parts of the multipart upload in progress
+	parts   [][]byte
+	aborted bool
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	body, _ := ioutil.ReadAll(input.Body)
+	// s3 returns metadata keys with canonical header casing
+	metadata := make(map[string]*string)
+	for k, v := range input.Metadata {
+		metadata[http.CanonicalHeaderKey(strings.ToLower(k))] = v
+	}
+	f.objects[aws.StringValue(input.Key)] = fakeObject{body: body, metadata: metadata, input: input}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	obj, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:     ioutil.NopCloser(bytes.NewReader(obj.body)),
+		Metadata: obj.metadata,
+	}, nil
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	keys, err := NewLocalKeyProvider("local", bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewLocalKeyProvider failed with error: %v", err)
+	}
+	picture := []byte("\xff\xd8\xff\xe0 not really a jpeg")
+
+	tt := []struct {
+		name       string
+		cfg        Config
+		sse        string
+		plainInS3  bool
+		keyInInput string
+	}{
+		{name: "none", cfg: Config{}, plainInS3: true},
+		{name: "sseKMS", cfg: Config{Encryption: EncryptionSSEKMS, KMSKeyID: "alias/pictures"}, sse: "aws:kms", plainInS3: true, keyInInput: "alias/pictures"},
+		{name: "envelope", cfg: Config{Encryption: EncryptionEnvelope}, sse: "aws:kms", plainInS3: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s3Svc := &fakeS3{objects: make(map[string]fakeObject)}
+			store, err := New(tc.cfg, s3Svc, keys)
+			if err != nil {
+				t.Fatalf("New failed with error: %v", err)
+			}
+
+			err = store.Put(context.Background(), PutInput{Bucket: "pictures", Key: "1.jpg", Body: picture, ContentType: "image/jpeg"})
+			if err != nil {
+				t.Fatalf("Put failed with error: %v", err)
+			}
+
+			stored := s3Svc.objects["1.jpg"]
+			if got := aws.StringValue(stored.input.ServerSideEncryption); got != tc.sse {
+				t.Fatalf("got server side encryption: %q, wanted: %q", got, tc.sse)
+			}
+			if got := aws.StringValue(stored.input.SSEKMSKeyId); got != tc.keyInInput {
+				t.Fatalf("got kms key: %q, wanted: %q", got, tc.keyInInput)
+			}
+			if bytes.Equal(stored.body, picture) != tc.plainInS3 {
+				t.Fatalf("got plaintext stored: %v, wanted: %v", !tc.plainInS3, tc.plainInS3)
+			}
+
+			got, err := store.Get(context.Background(), "pictures", "1.jpg")
+			if err != nil {
+				t.Fatalf("Get failed with error: %v", err)
+			}
+			if !bytes.Equal(got, picture) {
+				t.Fatalf("got: %q, wanted: %q", got, picture)
+			}
+		})
+	}
+}
+
+func TestEnvelopeBoundToObject(t *testing.T) {
+	keys, _ := NewLocalKeyProvider("local", bytes.Repeat([]byte{7}, 32))
+	s3Svc := &fakeS3{objects: make(map[string]fakeObject)}
+	store, _ := New(Config{Encryption: EncryptionEnvelope}, s3Svc, keys)
+
+	store.Put(context.Background(), PutInput{Bucket: "pictures", Key: "1.jpg", Body: []byte("secret")})
+	s3Svc.objects["2.jpg"] = s3Svc.objects["1.jpg"]
+
+	if _, err := store.Get(context.Background(), "pictures", "2.jpg"); err == nil {
+		t.Fatalf("got no error for an envelope copied to another key")
+	}
+}
+
+func (f *fakeS3) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{Bucket: input.Bucket, Key: input.Key, UploadId: aws.String("upload-1")}, nil
+}
+
+func (f *fakeS3) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	body, _ := ioutil.ReadAll(input.Body)
+	f.parts = append(f.parts, body)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.Int64Value(input.PartNumber)))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	f.objects[aws.StringValue(input.Key)] = fakeObject{body: bytes.Join(f.parts, nil)}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	f.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestPutStream(t *testing.T) {
+	tt := []struct {
+		name    string
+		body    io.Reader
+		parts   int
+		stored  string
+		aborted bool
+	}{
+		{name: "singlePart", body: strings.NewReader("jpeg"), stored: "jpeg"},
+		{name: "exactlyOnePart", body: strings.NewReader("jpeg1234"), parts: 1, stored: "jpeg1234"},
+		{name: "multipart", body: strings.NewReader("jpeg1234abcdefgh5"), parts: 3, stored: "jpeg1234abcdefgh5"},
+		{name: "readFails", body: io.MultiReader(strings.NewReader("jpeg1234abcd"), failingReader{}), parts: 1, aborted: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s3Svc := &fakeS3{objects: make(map[string]fakeObject)}
+			store, _ := New(Config{}, s3Svc, nil)
+			store.partSize = 8
+
+			err := store.PutStream(context.Background(), StreamInput{Bucket: "pictures", Key: "1.jpg", Body: tc.body, ContentType: "image/jpeg"})
+			if (err != nil) != tc.aborted || s3Svc.aborted != tc.aborted {
+				t.Fatalf("got: %v aborted %v, wanted aborted %v", err, s3Svc.aborted, tc.aborted)
+			}
+			if len(s3Svc.parts) != tc.parts {
+				t.Fatalf("got: %v parts, wanted: %v", len(s3Svc.parts), tc.parts)
+			}
+			if got := string(s3Svc.objects["1.jpg"].body); got != tc.stored {
+				t.Fatalf("got: %q, wanted: %q", got, tc.stored)
+			}
+		})
+	}
+}
+
+// failingReader fails every read
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("connection reset")
+}
+
+func (f *fakeS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	obj, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(codeNotFound, "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{ContentType: obj.input.ContentType, Metadata: obj.metadata}, nil
+}
+
+func (f *fakeS3) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	source := strings.TrimPrefix(aws.StringValue(input.CopySource), aws.StringValue(input.Bucket)+"/")
+	obj := f.objects[source]
+	obj.input = &s3.PutObjectInput{ContentType: obj.input.ContentType, Tagging: input.Tagging}
+	f.objects[aws.StringValue(input.Key)] = obj
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestMove(t *testing.T) {
+	keys, _ := NewLocalKeyProvider("local", bytes.Repeat([]byte{7}, 32))
+	picture := []byte("\xff\xd8\xff\xe0 not really a jpeg")
+
+	tt := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "copy", cfg: Config{}},
+		{name: "resealed", cfg: Config{Encryption: EncryptionEnvelope}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s3Svc := &fakeS3{objects: make(map[string]fakeObject)}
+			store, _ := New(tc.cfg, s3Svc, keys)
+			store.Put(ctx, PutInput{Bucket: "pictures", Key: "incoming/1.jpg", Body: picture, ContentType: "image/jpeg", Tagging: "RetentionClass=transient"})
+
+			to := ContentKey("3a", ".jpg")
+			err := store.Move(ctx, MoveInput{Bucket: "pictures", From: "incoming/1.jpg", To: to, Tagging: "RetentionClass=raw-image"})
+			if err != nil {
+				t.Fatalf("Move failed with error: %v", err)
+			}
+
+			got, err := store.Get(ctx, "pictures", to)
+			if err != nil || !bytes.Equal(got, picture) {
+				t.Fatalf("got: %q %v, wanted: %q", got, err, picture)
+			}
+			stored := s3Svc.objects[to].input
+			if aws.StringValue(stored.ContentType) != "image/jpeg" || aws.StringValue(stored.Tagging) != "RetentionClass=raw-image" {
+				t.Fatalf("got: %v %v, wanted: the content type kept and the tags replaced", aws.StringValue(stored.ContentType), aws.StringValue(stored.Tagging))
+			}
+			if _, err := store.Get(ctx, "pictures", "incoming/1.jpg"); err != ErrNotFound {
+				t.Fatalf("got: %v, wanted: %v", err, ErrNotFound)
+			}
+			if ok, err := store.Exists(ctx, "pictures", "incoming/1.jpg"); ok || err != nil {
+				t.Fatalf("got: %v %v, wanted: the moved object gone", ok, err)
+			}
+		})
+	}
+}
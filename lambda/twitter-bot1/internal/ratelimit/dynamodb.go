@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// expireAfter how long after its reset a limit is kept in the table
+const expireAfter = time.Hour
+
+// DynamoDBStore keeps one item per endpoint in a table with the string
+// partition key endpoint. expires_at can be enabled as the table's TTL
+// attribute to let DynamoDB remove old windows.
+type DynamoDBStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBStore returns a store using table.
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client: client,
+		table:  table,
+	}
+}
+
+// Get implements Store.
+func (d *DynamoDBStore) Get(ctx context.Context, endpoint string) (Limit, bool, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"endpoint": {S: aws.String(endpoint)},
+		},
+	})
+	if err != nil {
+		return Limit{}, false, fmt.Errorf("get rate limit: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return Limit{}, false, nil
+	}
+
+	l := Limit{Endpoint: endpoint}
+	l.Limit = intAttribute(out.Item["limit"])
+	l.Remaining = intAttribute(out.Item["remaining"])
+	l.Reset = time.Unix(int64(intAttribute(out.Item["reset"])), 0)
+	return l, true, nil
+}
+
+// Put implements Store.
+func (d *DynamoDBStore) Put(ctx context.Context, limit Limit) error {
+	_, err := d.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"endpoint":   {S: aws.String(limit.Endpoint)},
+			"limit":      {N: aws.String(strconv.Itoa(limit.Limit))},
+			"remaining":  {N: aws.String(strconv.Itoa(limit.Remaining))},
+			"reset":      {N: aws.String(strconv.FormatInt(limit.Reset.Unix(), 10))},
+			"expires_at": {N: aws.String(strconv.FormatInt(limit.Reset.Add(expireAfter).Unix(), 10))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put rate limit: %v", err)
+	}
+	return nil
+}
+
+func intAttribute(v *dynamodb.AttributeValue) int {
+	if v == nil || v.N == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(*v.N)
+	return n
+}
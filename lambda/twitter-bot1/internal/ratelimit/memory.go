@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps limits in memory, they are only shared within one
+// process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	limits map[string]Limit
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		limits: make(map[string]Limit),
+	}
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(ctx context.Context, endpoint string) (Limit, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.limits[endpoint]
+	return l, ok, nil
+}
+
+// Put implements Store.
+func (m *MemoryStore) Put(ctx context.Context, limit Limit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits[limit.Endpoint] = limit
+	return nil
+}
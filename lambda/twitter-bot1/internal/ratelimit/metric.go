@@ -0,0 +1,13 @@
+package ratelimit
+
+import (
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+)
+
+// Budget returns a Transport.Observe recording the RateLimitRemaining metric
+// per Endpoint with r.
+func Budget(r metrics.Recorder) func(Limit) {
+	return func(limit Limit) {
+		metrics.Count(r, metrics.RateLimitRemaining, limit.Remaining, "Endpoint", limit.Endpoint)
+	}
+}
@@ -0,0 +1,75 @@
+// Package ratelimit keeps track of twitter's per endpoint rate limits, read
+// from the x-rate-limit headers of every response, so requests can be held
+// back before twitter starts rejecting them.
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit response headers
+const (
+	HeaderLimit     = "x-rate-limit-limit"
+	HeaderRemaining = "x-rate-limit-remaining"
+	HeaderReset     = "x-rate-limit-reset"
+)
+
+// endpointSegments number of path segments identifying an endpoint, enough
+// for /1.1/direct_messages/events/new.json and to leave out the media ids of
+// /1.1/ton/data/dm/<id>/<id>/<name>
+const endpointSegments = 4
+
+// Limit the rate limit window of one endpoint
+type Limit struct {
+	Endpoint  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Store shares limits between lambdas
+type Store interface {
+	// Get returns the limit of endpoint, ok is false when it is unknown.
+	Get(ctx context.Context, endpoint string) (limit Limit, ok bool, err error)
+	// Put saves limit, replacing what was stored for limit.Endpoint.
+	Put(ctx context.Context, limit Limit) error
+}
+
+// Exhausted is true when no requests are left before Reset.
+func (l Limit) Exhausted(now time.Time) bool {
+	return l.Remaining <= 0 && now.Before(l.Reset)
+}
+
+// Endpoint returns the key limits of req are tracked under, e.g.
+// "POST api.twitter.com/1.1/direct_messages/events/new.json".
+func Endpoint(req *http.Request) string {
+	segments := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", endpointSegments+1)
+	if len(segments) > endpointSegments {
+		segments = segments[:endpointSegments]
+	}
+	return req.Method + " " + req.URL.Host + "/" + strings.Join(segments, "/")
+}
+
+// FromHeader returns the limit in a response's headers, ok is false when the
+// response has none.
+func FromHeader(endpoint string, h http.Header) (limit Limit, ok bool) {
+	remaining, err := strconv.Atoi(h.Get(HeaderRemaining))
+	if err != nil {
+		return Limit{}, false
+	}
+	reset, err := strconv.ParseInt(h.Get(HeaderReset), 10, 64)
+	if err != nil {
+		return Limit{}, false
+	}
+	l, _ := strconv.Atoi(h.Get(HeaderLimit))
+	return Limit{
+		Endpoint:  endpoint,
+		Limit:     l,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}, true
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+)
+
+// DefaultMaxDelay longest a request is held back waiting for its window to
+// reset, longer waits are deferred to the caller
+const DefaultMaxDelay = 10 * time.Second
+
+// deferredBody body of a response the transport answers itself, shaped like
+// twitter's own rate limit error
+const deferredBody = `{"errors":[{"code":88,"message":"Rate limit exceeded, deferred by the bot"}]}`
+
+// Transport is an http.RoundTripper honouring twitter's rate limits. A
+// request to an exhausted endpoint waits for the reset when it is within
+// MaxDelay, otherwise it is answered with a 429 without reaching twitter so
+// callers handle it like twitter's own rate limit error.
+type Transport struct {
+	base  http.RoundTripper
+	store Store
+	// MaxDelay longest a request waits for its window to reset
+	MaxDelay time.Duration
+	// Observe is called with every limit read from a response, e.g. to
+	// record the remaining budget as a metric
+	Observe func(Limit)
+	// Scope prefixes the endpoints, twitter counts user limits per access
+	// token so every account sharing the store needs its own scope
+	Scope string
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTransport returns a Transport sending requests with base and keeping
+// limits in store.
+func NewTransport(base http.RoundTripper, store Store) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:     base,
+		store:    store,
+		MaxDelay: DefaultMaxDelay,
+		now:      time.Now,
+		sleep:    sleep,
+	}
+}
+
+// RoundTrip implements http.RoundTripper. A request cancelled while waiting
+// for the reset fails with the context's error.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	endpoint := Endpoint(req)
+	if t.Scope != "" {
+		endpoint = t.Scope + " " + endpoint
+	}
+
+	limit, ok, err := t.store.Get(ctx, endpoint)
+	if err != nil {
+		// the limit is only advisory, twitter still enforces it
+		logging.FromContext(ctx).Warn("failed to get rate limit", "endpoint", endpoint, "error", err)
+	}
+	if ok && limit.Exhausted(t.now()) {
+		wait := limit.Reset.Sub(t.now())
+		if wait > t.MaxDelay {
+			logging.FromContext(ctx).Warn("rate limit exhausted, deferring request", "endpoint", endpoint, "reset", limit.Reset)
+			return deferred(req, limit), nil
+		}
+		logging.FromContext(ctx).Info("rate limit exhausted, waiting", "endpoint", endpoint, "wait", wait)
+		if err := t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := FromHeader(endpoint, resp.Header); ok {
+		if err := t.store.Put(ctx, l); err != nil {
+			logging.FromContext(ctx).Warn("failed to put rate limit", "endpoint", endpoint, "error", err)
+		}
+		if t.Observe != nil {
+			t.Observe(l)
+		}
+	}
+	return resp, nil
+}
+
+func deferred(req *http.Request, limit Limit) *http.Response {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json")
+	h.Set(HeaderLimit, strconv.Itoa(limit.Limit))
+	h.Set(HeaderRemaining, "0")
+	h.Set(HeaderReset, strconv.FormatInt(limit.Reset.Unix(), 10))
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(deferredBody))),
+		ContentLength: int64(len(deferredBody)),
+		Request:       req,
+	}
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEndpoint(t *testing.T) {
+	tt := []struct {
+		name   string
+		method string
+		url    string
+		out    string
+	}{
+		{name: "directMessage", method: "POST", url: "https://api.twitter.com/1.1/direct_messages/events/new.json", out: "POST api.twitter.com/1.1/direct_messages/events/new.json"},
+		{name: "media", method: "GET", url: "https://ton.twitter.com/1.1/ton/data/dm/1/2/abc.jpg?x=1", out: "GET ton.twitter.com/1.1/ton/data/dm"},
+		{name: "upload", method: "POST", url: "https://upload.twitter.com/1.1/media/upload.json", out: "POST upload.twitter.com/1.1/media/upload.json"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if out := Endpoint(req); out != tc.out {
+				t.Fatalf("got: %v, wanted: %v", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	now := time.Unix(1562101000, 0)
+	tt := []struct {
+		name      string
+		known     *Limit
+		status    int
+		requests  int
+		slept     time.Duration
+		remaining int
+	}{
+		{name: "unknownLimit", status: 200, requests: 1, remaining: 14},
+		{name: "budgetLeft", known: &Limit{Remaining: 3, Reset: now.Add(time.Minute)}, status: 200, requests: 1, remaining: 14},
+		{name: "waitForReset", known: &Limit{Remaining: 0, Reset: now.Add(5 * time.Second)}, status: 200, requests: 1, slept: 5 * time.Second, remaining: 14},
+		{name: "deferred", known: &Limit{Remaining: 0, Reset: now.Add(15 * time.Minute)}, status: 429, requests: 0, remaining: 0},
+		{name: "windowReset", known: &Limit{Remaining: 0, Reset: now.Add(-time.Second)}, status: 200, requests: 1, remaining: 14},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set(HeaderLimit, "15")
+				w.Header().Set(HeaderRemaining, "14")
+				w.Header().Set(HeaderReset, strconv.FormatInt(now.Add(15*time.Minute).Unix(), 10))
+			}))
+			defer ts.Close()
+
+			req, _ := http.NewRequest("POST", ts.URL+"/1.1/direct_messages/events/new.json", nil)
+			store := NewMemoryStore()
+			if tc.known != nil {
+				tc.known.Endpoint = Endpoint(req)
+				store.Put(req.Context(), *tc.known)
+			}
+			var slept time.Duration
+			transport := NewTransport(nil, store)
+			transport.now = func() time.Time { return now }
+			transport.sleep = func(ctx context.Context, d time.Duration) error {
+				slept += d
+				return nil
+			}
+
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err != nil {
+				t.Fatalf("Do failed with error: %v", err)
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.status || requests != tc.requests || slept != tc.slept {
+				t.Fatalf("got: %v %v %v, wanted: %v %v %v", resp.StatusCode, requests, slept, tc.status, tc.requests, tc.slept)
+			}
+			l, _, _ := store.Get(req.Context(), Endpoint(req))
+			if l.Remaining != tc.remaining {
+				t.Fatalf("got remaining: %v, wanted: %v", l.Remaining, tc.remaining)
+			}
+		})
+	}
+}
+
+func TestTransportCancelled(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("POST", ts.URL+"/1.1/direct_messages/events/new.json", nil)
+	req = req.WithContext(ctx)
+	store := NewMemoryStore()
+	store.Put(ctx, Limit{Endpoint: Endpoint(req), Remaining: 0, Reset: time.Now().Add(5 * time.Second)})
+
+	start := time.Now()
+	_, err := NewTransport(nil, store).RoundTrip(req)
+	if err != context.Canceled || requests != 0 {
+		t.Fatalf("got: %v after %v requests, wanted: %v", err, requests, context.Canceled)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("got: waited %v, wanted no wait for the reset", waited)
+	}
+}
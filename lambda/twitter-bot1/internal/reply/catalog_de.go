@@ -0,0 +1,86 @@
+package reply
+
+var catalogDe = catalog{
+	plural: pluralOneOther,
+	words: map[string]string{
+		"Male":      "männlich",
+		"Female":    "weiblich",
+		"HAPPY":     "glücklich",
+		"SAD":       "traurig",
+		"ANGRY":     "wütend",
+		"CONFUSED":  "verwirrt",
+		"DISGUSTED": "angewidert",
+		"SURPRISED": "überrascht",
+		"CALM":      "ruhig",
+		"FEAR":      "ängstlich",
+		"UNKNOWN":   "unbekannt",
+	},
+	templates: `
+{{- define "faces"}}
+{{- if not .Faces}}Ich habe in deinem Bild keine Gesichter gefunden.
+{{- else}}Ich habe {{len .Faces}} {{plural (len .Faces) "Gesicht" "Gesichter"}} in deinem Bild gefunden.
+{{range .Faces}}
+{{template "face" .}}{{end}}{{end}}
+{{- end}}
+
+{{- define "face"}}Gesicht:{{.Index}} {{emoji .Emotion}}
+{{if .Full}}Alter zwischen {{.AgeLow}} und {{.AgeHigh}}
+Geschlecht: {{word .Gender}}
+{{end}}Emotion: {{word .Emotion}}
+{{end}}
+
+{{- define "send-picture"}}Schick mir ein Bild und ich erzähle dir von den Gesichtern darin.{{end}}
+
+{{- define "how-many"}}Ich habe {{.Count}} {{plural .Count "Gesicht" "Gesichter"}} in deinem letzten Bild gefunden.{{end}}
+
+{{- define "ask-about-face"}}Frag mich nach einem Gesicht in deinem letzten Bild, z.B. "what about the second face?", oder schick ein neues Bild.{{end}}
+
+{{- define "no-faces"}}Ich habe in deinem letzten Bild keine Gesichter gefunden.{{end}}
+
+{{- define "only-found"}}Ich habe nur {{.Count}} {{plural .Count "Gesicht" "Gesichter"}} in deinem letzten Bild gefunden.{{end}}
+
+{{- define "setting-changed"}}{{.Name}} ist jetzt {{.Value}}.{{end}}
+
+{{- define "setting-invalid"}}Die Einstellung konnte nicht geändert werden: {{.Err}}{{end}}
+
+{{- define "settings"}}Sprache: {{.Language}}
+Details: {{.Details}}
+Speicherung: {{.Retention}}{{end}}
+
+{{- define "help"}}Schick mir ein Bild und ich beschreibe die Gesichter darin.
+Befehle:
+set language en|sv|de
+set details full|minimal
+set retention on|off
+settings
+show labels
+blur faces
+delete my photo
+forget me{{end}}
+
+{{- define "forgotten"}}Erledigt. Ich habe {{plural .Count "dein" "deine"}} {{.Count}} {{plural .Count "gespeichertes Bild oder Analyse" "gespeicherten Bilder und Analysen"}} gelöscht und unser Gespräch vergessen.{{end}}
+
+{{- define "labels"}}
+{{- if not .Labels}}Ich konnte in deinem letzten Bild nichts erkennen.
+{{- else}}In deinem letzten Bild sehe ich:
+{{range .Labels}}{{.Name}} ({{.Confidence}}%)
+{{end}}{{end}}
+{{- end}}
+
+{{- define "blurred"}}Hier ist dein letztes Bild mit unkenntlich gemachten Gesichtern.{{end}}
+
+{{- define "photo-deleted"}}Erledigt. Ich habe dein letztes Bild und seine Analyse gelöscht.{{end}}
+
+{{- define "picture-gone"}}Dein letztes Bild ist nicht mehr gespeichert, schick es noch einmal.{{end}}
+
+{{- define "picture-refused"}}Dieses Bild kann ich nicht analysieren.{{end}}
+
+{{- define "option-show-labels"}}Labels anzeigen{{end}}
+
+{{- define "option-blur-faces"}}Gesichter verpixeln{{end}}
+
+{{- define "option-delete-photo"}}Mein Bild löschen{{end}}
+
+{{- define "welcome"}}Danke fürs Folgen{{with .ScreenName}} @{{.}}{{end}}! Schick mir ein Bild als Direktnachricht und ich erzähle dir von den Gesichtern darin. Schreib "help", um zu sehen, was ich noch kann.{{end}}
+`,
+}
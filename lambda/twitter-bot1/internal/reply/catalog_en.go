@@ -0,0 +1,86 @@
+package reply
+
+var catalogEn = catalog{
+	plural: pluralOneOther,
+	words: map[string]string{
+		"Male":      "male",
+		"Female":    "female",
+		"HAPPY":     "happy",
+		"SAD":       "sad",
+		"ANGRY":     "angry",
+		"CONFUSED":  "confused",
+		"DISGUSTED": "disgusted",
+		"SURPRISED": "surprised",
+		"CALM":      "calm",
+		"FEAR":      "afraid",
+		"UNKNOWN":   "unknown",
+	},
+	templates: `
+{{- define "faces"}}
+{{- if not .Faces}}I did not find any faces in your picture.
+{{- else}}I found {{len .Faces}} {{plural (len .Faces) "face" "faces"}} in your picture.
+{{range .Faces}}
+{{template "face" .}}{{end}}{{end}}
+{{- end}}
+
+{{- define "face"}}face:{{.Index}} {{emoji .Emotion}}
+{{if .Full}}age between {{.AgeLow}} and {{.AgeHigh}}
+gender: {{word .Gender}}
+{{end}}emotion: {{word .Emotion}}
+{{end}}
+
+{{- define "send-picture"}}Send me a picture and I will tell you about the faces in it.{{end}}
+
+{{- define "how-many"}}I found {{.Count}} {{plural .Count "face" "faces"}} in your last picture.{{end}}
+
+{{- define "ask-about-face"}}Ask me about a face in your last picture, e.g. "what about the second face?", or send me a new picture.{{end}}
+
+{{- define "no-faces"}}I did not find any faces in your last picture.{{end}}
+
+{{- define "only-found"}}I only found {{.Count}} {{plural .Count "face" "faces"}} in your last picture.{{end}}
+
+{{- define "setting-changed"}}{{.Name}} is now {{.Value}}.{{end}}
+
+{{- define "setting-invalid"}}Could not change the setting: {{.Err}}{{end}}
+
+{{- define "settings"}}language: {{.Language}}
+details: {{.Details}}
+retention: {{.Retention}}{{end}}
+
+{{- define "help"}}Send me a picture and I will describe the faces in it.
+Commands:
+set language en|sv|de
+set details full|minimal
+set retention on|off
+settings
+show labels
+blur faces
+delete my photo
+forget me{{end}}
+
+{{- define "forgotten"}}Done. I have deleted your {{.Count}} stored {{plural .Count "picture or analysis" "pictures and analyses"}} and forgotten our conversation.{{end}}
+
+{{- define "labels"}}
+{{- if not .Labels}}I could not recognise anything in your last picture.
+{{- else}}In your last picture I see:
+{{range .Labels}}{{.Name}} ({{.Confidence}}%)
+{{end}}{{end}}
+{{- end}}
+
+{{- define "blurred"}}Here is your last picture with the faces blurred.{{end}}
+
+{{- define "photo-deleted"}}Done. I have deleted your last picture and its analysis.{{end}}
+
+{{- define "picture-gone"}}Your last picture is no longer stored, send it again.{{end}}
+
+{{- define "picture-refused"}}I cannot analyse this picture.{{end}}
+
+{{- define "option-show-labels"}}Show labels{{end}}
+
+{{- define "option-blur-faces"}}Blur faces{{end}}
+
+{{- define "option-delete-photo"}}Delete my photo{{end}}
+
+{{- define "welcome"}}Thanks for following{{with .ScreenName}} @{{.}}{{end}}! Send me a picture in a direct message and I will tell you about the faces in it. Write "help" to see what else I can do.{{end}}
+`,
+}
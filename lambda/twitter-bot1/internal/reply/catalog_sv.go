@@ -0,0 +1,86 @@
+package reply
+
+var catalogSv = catalog{
+	plural: pluralOneOther,
+	words: map[string]string{
+		"Male":      "man",
+		"Female":    "kvinna",
+		"HAPPY":     "glad",
+		"SAD":       "ledsen",
+		"ANGRY":     "arg",
+		"CONFUSED":  "förvirrad",
+		"DISGUSTED": "äcklad",
+		"SURPRISED": "förvånad",
+		"CALM":      "lugn",
+		"FEAR":      "rädd",
+		"UNKNOWN":   "okänd",
+	},
+	templates: `
+{{- define "faces"}}
+{{- if not .Faces}}Jag hittade inga ansikten i din bild.
+{{- else}}Jag hittade {{len .Faces}} {{plural (len .Faces) "ansikte" "ansikten"}} i din bild.
+{{range .Faces}}
+{{template "face" .}}{{end}}{{end}}
+{{- end}}
+
+{{- define "face"}}ansikte:{{.Index}} {{emoji .Emotion}}
+{{if .Full}}ålder mellan {{.AgeLow}} och {{.AgeHigh}}
+kön: {{word .Gender}}
+{{end}}känsla: {{word .Emotion}}
+{{end}}
+
+{{- define "send-picture"}}Skicka en bild så berättar jag om ansiktena i den.{{end}}
+
+{{- define "how-many"}}Jag hittade {{.Count}} {{plural .Count "ansikte" "ansikten"}} i din senaste bild.{{end}}
+
+{{- define "ask-about-face"}}Fråga mig om ett ansikte i din senaste bild, t.ex. "what about the second face?", eller skicka en ny bild.{{end}}
+
+{{- define "no-faces"}}Jag hittade inga ansikten i din senaste bild.{{end}}
+
+{{- define "only-found"}}Jag hittade bara {{.Count}} {{plural .Count "ansikte" "ansikten"}} i din senaste bild.{{end}}
+
+{{- define "setting-changed"}}{{.Name}} är nu {{.Value}}.{{end}}
+
+{{- define "setting-invalid"}}Kunde inte ändra inställningen: {{.Err}}{{end}}
+
+{{- define "settings"}}språk: {{.Language}}
+detaljer: {{.Details}}
+lagring: {{.Retention}}{{end}}
+
+{{- define "help"}}Skicka en bild så beskriver jag ansiktena i den.
+Kommandon:
+set language en|sv|de
+set details full|minimal
+set retention on|off
+settings
+show labels
+blur faces
+delete my photo
+forget me{{end}}
+
+{{- define "forgotten"}}Klart. Jag har raderat {{plural .Count "din" "dina"}} {{.Count}} {{plural .Count "sparade bild eller analys" "sparade bilder och analyser"}} och glömt vår konversation.{{end}}
+
+{{- define "labels"}}
+{{- if not .Labels}}Jag kunde inte känna igen något i din senaste bild.
+{{- else}}I din senaste bild ser jag:
+{{range .Labels}}{{.Name}} ({{.Confidence}}%)
+{{end}}{{end}}
+{{- end}}
+
+{{- define "blurred"}}Här är din senaste bild med ansiktena suddade.{{end}}
+
+{{- define "photo-deleted"}}Klart. Jag har raderat din senaste bild och dess analys.{{end}}
+
+{{- define "picture-gone"}}Din senaste bild är inte längre sparad, skicka den igen.{{end}}
+
+{{- define "picture-refused"}}Jag kan inte analysera den här bilden.{{end}}
+
+{{- define "option-show-labels"}}Visa etiketter{{end}}
+
+{{- define "option-blur-faces"}}Sudda ansikten{{end}}
+
+{{- define "option-delete-photo"}}Radera min bild{{end}}
+
+{{- define "welcome"}}Tack för att du följer mig{{with .ScreenName}} @{{.}}{{end}}! Skicka en bild i ett direktmeddelande så berättar jag om ansiktena i den. Skriv "help" för att se vad mer jag kan göra.{{end}}
+`,
+}
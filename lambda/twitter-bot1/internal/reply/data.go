@@ -0,0 +1,66 @@
+package reply
+
+import (
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+)
+
+type (
+	// FaceData data of TemplateFace
+	FaceData struct {
+		Index   int
+		AgeLow  int64
+		AgeHigh int64
+		Gender  string
+		Emotion string
+		// Full includes age and gender
+		Full bool
+	}
+	// FacesData data of TemplateFaces
+	FacesData struct {
+		Faces []FaceData
+	}
+	// CountData data of templates about a number of things
+	CountData struct {
+		Count int
+	}
+	// WelcomeData data of TemplateWelcome
+	WelcomeData struct {
+		ScreenName string
+	}
+	// LabelData one label of TemplateLabels, Confidence in percent
+	LabelData struct {
+		Name       string
+		Confidence int
+	}
+	// LabelsData data of TemplateLabels
+	LabelsData struct {
+		Labels []LabelData
+	}
+	// SettingData data of TemplateSettingChanged and TemplateSettingInvalid
+	SettingData struct {
+		Name  string
+		Value string
+		Err   string
+	}
+)
+
+// NewFaceData returns the data to render face i honouring prefs.
+func NewFaceData(i int, f conversation.Face, prefs conversation.Preferences) FaceData {
+	return FaceData{
+		Index:   i,
+		AgeLow:  f.AgeLow,
+		AgeHigh: f.AgeHigh,
+		Gender:  f.Gender,
+		Emotion: f.Emotion,
+		Full:    prefs.WithDefaults().Details != conversation.DetailsMinimal,
+	}
+}
+
+// NewFacesData returns the data to render an analysis honouring prefs.
+func NewFacesData(fs []conversation.Face, prefs conversation.Preferences) FacesData {
+	d := FacesData{Faces: make([]FaceData, 0, len(fs))}
+	for i, f := range fs {
+		d.Faces = append(d.Faces, NewFaceData(i, f, prefs))
+	}
+	return d
+}
@@ -0,0 +1,207 @@
+// Package reply renders the bot's direct messages from text/template
+// catalogs, one per language, and fits them into twitter's message size.
+package reply
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+)
+
+// Template names
+const (
+	// TemplateFaces reply to an analysed picture, AnalysisFaces analysis type
+	TemplateFaces          = "faces"
+	TemplateFace           = "face"
+	TemplateSendPicture    = "send-picture"
+	TemplateHowMany        = "how-many"
+	TemplateAskAboutFace   = "ask-about-face"
+	TemplateNoFaces        = "no-faces"
+	TemplateOnlyFound      = "only-found"
+	TemplateSettingChanged = "setting-changed"
+	TemplateSettingInvalid = "setting-invalid"
+	TemplateSettings       = "settings"
+	TemplateHelp           = "help"
+	TemplateForgotten      = "forgotten"
+	// TemplateLabels reply to the show labels action
+	TemplateLabels       = "labels"
+	TemplateBlurred      = "blurred"
+	TemplatePhotoDeleted = "photo-deleted"
+	TemplatePictureGone  = "picture-gone"
+	// TemplatePictureRefused reply to a picture on the blocklist
+	TemplatePictureRefused = "picture-refused"
+	// Quick reply option labels
+	TemplateOptionShowLabels  = "option-show-labels"
+	TemplateOptionBlurFaces   = "option-blur-faces"
+	TemplateOptionDeletePhoto = "option-delete-photo"
+	// TemplateWelcome message to a new follower, WelcomeData
+	TemplateWelcome = "welcome"
+)
+
+// Overflow modes for messages longer than MaxLength
+const (
+	OverflowSplit    = "split"
+	OverflowTruncate = "truncate"
+)
+
+// MaxLength max number of characters in a twitter direct message
+const MaxLength = 10000
+
+// catalog templates and vocabulary of one language
+type catalog struct {
+	// templates text/template definitions, one {{define}} per template name
+	templates string
+	// words translations of rekognition values such as HAPPY or Female
+	words map[string]string
+	// plural returns one or other for n
+	plural func(n int, one string, other string) string
+}
+
+var catalogs = map[string]catalog{
+	"en": catalogEn,
+	"sv": catalogSv,
+	"de": catalogDe,
+}
+
+var emojis = map[string]string{
+	"HAPPY":     "😄",
+	"SAD":       "😢",
+	"ANGRY":     "😠",
+	"CONFUSED":  "😕",
+	"DISGUSTED": "🤢",
+	"SURPRISED": "😮",
+	"CALM":      "😌",
+	"FEAR":      "😨",
+	"UNKNOWN":   "🤔",
+}
+
+// Renderer renders templates in the sender's language
+type Renderer struct {
+	templates map[string]*template.Template
+	overflow  string
+	maxLength int
+}
+
+// New parses all catalogs. overflow is OverflowSplit or OverflowTruncate,
+// empty means split.
+func New(overflow string) (*Renderer, error) {
+	switch overflow {
+	case "":
+		overflow = OverflowSplit
+	case OverflowSplit, OverflowTruncate:
+	default:
+		return nil, fmt.Errorf("unknown reply overflow %q", overflow)
+	}
+
+	r := &Renderer{
+		templates: make(map[string]*template.Template),
+		overflow:  overflow,
+		maxLength: MaxLength,
+	}
+	for lang, c := range catalogs {
+		t, err := template.New(lang).Funcs(c.funcs()).Parse(c.templates)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s catalog: %v", lang, err)
+		}
+		r.templates[lang] = t
+	}
+	return r, nil
+}
+
+// Languages returns the languages with a catalog.
+func (r *Renderer) Languages() []string {
+	langs := make([]string, 0, len(r.templates))
+	for lang := range r.templates {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Render executes template name of lang with data. Languages without a
+// catalog, or without the template, fall back to the default language.
+func (r *Renderer) Render(lang string, name string, data interface{}) (string, error) {
+	t, ok := r.templates[lang]
+	if !ok || t.Lookup(name) == nil {
+		t = r.templates[conversation.DefaultLanguage]
+	}
+	var b bytes.Buffer
+	if err := t.ExecuteTemplate(&b, name, data); err != nil {
+		return "", fmt.Errorf("render %s/%s: %v", lang, name, err)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// Define replaces template name in every language with text, e.g. a
+// deployment's own welcome message.
+func (r *Renderer) Define(name string, text string) error {
+	def := fmt.Sprintf(`{{define %q}}%s{{end}}`, name, text)
+	for lang, t := range r.templates {
+		if _, err := t.Parse(def); err != nil {
+			return fmt.Errorf("define %s/%s: %v", lang, name, err)
+		}
+	}
+	return nil
+}
+
+// With returns a copy of r with templates, by name, replacing the built-in
+// ones. r is returned as is when there are none.
+func (r *Renderer) With(templates map[string]string) (*Renderer, error) {
+	if len(templates) == 0 {
+		return r, nil
+	}
+	c := &Renderer{
+		templates: make(map[string]*template.Template, len(r.templates)),
+		overflow:  r.overflow,
+		maxLength: r.maxLength,
+	}
+	for lang, t := range r.templates {
+		clone, err := t.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("clone %s catalog: %v", lang, err)
+		}
+		c.templates[lang] = clone
+	}
+	for name, text := range templates {
+		if err := c.Define(name, text); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Fit returns text as the messages to send, split or truncated to MaxLength
+// characters.
+func (r *Renderer) Fit(text string) []string {
+	if r.overflow == OverflowTruncate {
+		return []string{Truncate(text, r.maxLength)}
+	}
+	return Split(text, r.maxLength)
+}
+
+func (c catalog) funcs() template.FuncMap {
+	return template.FuncMap{
+		"plural": c.plural,
+		"word": func(s string) string {
+			if w, ok := c.words[s]; ok {
+				return w
+			}
+			return strings.ToLower(s)
+		},
+		"emoji": func(emotion string) string {
+			return emojis[emotion]
+		},
+	}
+}
+
+// pluralOneOther plural rule of languages with a singular and a plural form.
+func pluralOneOther(n int, one string, other string) string {
+	if n == 1 {
+		return one
+	}
+	return other
+}
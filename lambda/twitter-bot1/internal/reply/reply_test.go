@@ -0,0 +1,126 @@
+package reply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+)
+
+func TestRender(t *testing.T) {
+	r, err := New("")
+	if err != nil {
+		t.Fatalf("New failed with error: %v", err)
+	}
+	faces := []conversation.Face{
+		{AgeLow: 20, AgeHigh: 30, Gender: "Female", Emotion: "HAPPY"},
+	}
+
+	tt := []struct {
+		name string
+		lang string
+		tmpl string
+		data interface{}
+		out  string
+	}{
+		{
+			name: "facesFull",
+			lang: "en",
+			tmpl: TemplateFaces,
+			data: NewFacesData(faces, conversation.Preferences{}),
+			out:  "I found 1 face in your picture.\n\nface:0 😄\nage between 20 and 30\ngender: female\nemotion: happy",
+		},
+		{
+			name: "facesMinimalSwedish",
+			lang: "sv",
+			tmpl: TemplateFaces,
+			data: NewFacesData(faces, conversation.Preferences{Details: conversation.DetailsMinimal}),
+			out:  "Jag hittade 1 ansikte i din bild.\n\nansikte:0 😄\nkänsla: glad",
+		},
+		{
+			name: "noFaces",
+			lang: "de",
+			tmpl: TemplateFaces,
+			data: NewFacesData(nil, conversation.Preferences{}),
+			out:  "Ich habe in deinem Bild keine Gesichter gefunden.",
+		},
+		{
+			name: "plural",
+			lang: "de",
+			tmpl: TemplateHowMany,
+			data: CountData{Count: 3},
+			out:  "Ich habe 3 Gesichter in deinem letzten Bild gefunden.",
+		},
+		{
+			name: "unknownLanguage",
+			lang: "fi",
+			tmpl: TemplateOnlyFound,
+			data: CountData{Count: 1},
+			out:  "I only found 1 face in your last picture.",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := r.Render(tc.lang, tc.tmpl, tc.data)
+			if err != nil {
+				t.Fatalf("Render failed with error: %v", err)
+			}
+			if out != tc.out {
+				t.Fatalf("got: %q, wanted: %q", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestWith(t *testing.T) {
+	r, err := New("")
+	if err != nil {
+		t.Fatalf("New failed with error: %v", err)
+	}
+	custom, err := r.With(map[string]string{TemplateHelp: "Pictures only, please."})
+	if err != nil {
+		t.Fatalf("With failed with error: %v", err)
+	}
+
+	out, _ := custom.Render("sv", TemplateHelp, nil)
+	if out != "Pictures only, please." {
+		t.Fatalf("got: %q, wanted the account's help text", out)
+	}
+	out, _ = r.Render("en", TemplateHelp, nil)
+	if out == "Pictures only, please." {
+		t.Fatalf("got: %q, wanted the built-in help text unchanged", out)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tt := []struct {
+		name string
+		text string
+		max  int
+		out  []string
+	}{
+		{name: "fits", text: "face:0", max: 10, out: []string{"face:0"}},
+		{name: "lines", text: "face:0\nface:1\nface:2", max: 14, out: []string{"face:0\nface:1", "face:2"}},
+		{name: "words", text: "aaa bbb ccc", max: 8, out: []string{"aaa bbb", "ccc"}},
+		{name: "runes", text: "ååååå", max: 2, out: []string{"åå", "åå", "å"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out := Split(tc.text, tc.max)
+			if strings.Join(out, "|") != strings.Join(tc.out, "|") {
+				t.Fatalf("got: %q, wanted: %q", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if out := Truncate("hello world", 8); out != "hello w…" {
+		t.Fatalf("got: %q, wanted: %q", out, "hello w…")
+	}
+	if out := Truncate("hello", 8); out != "hello" {
+		t.Fatalf("got: %q, wanted: %q", out, "hello")
+	}
+}
@@ -0,0 +1,50 @@
+package reply
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ellipsis marks a truncated message
+const ellipsis = "…"
+
+// Truncate cuts text to at most max characters, ending with an ellipsis when
+// something was cut.
+func Truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimRight(string(runes[:max-1]), " \n") + ellipsis
+}
+
+// Split cuts text into messages of at most max characters. Messages are cut
+// at line breaks when possible, then at spaces, and only then inside a word.
+func Split(text string, max int) []string {
+	parts := make([]string, 0, 1)
+	runes := []rune(text)
+	for len(runes) > max {
+		cut := lastIndex(runes[:max+1], '\n')
+		if cut <= 0 {
+			cut = lastIndex(runes[:max+1], ' ')
+		}
+		if cut <= 0 {
+			cut = max
+		}
+		parts = append(parts, strings.TrimRight(string(runes[:cut]), " \n"))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " \n"))
+	}
+	if len(runes) > 0 || len(parts) == 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+func lastIndex(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
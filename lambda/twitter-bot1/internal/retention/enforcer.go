@@ -0,0 +1,219 @@
+// Package retention tags stored objects with a retention class and enforces
+// how long each class is kept in PictureBucket.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+)
+
+// deleteObjectsLimit max number of keys in one DeleteObjects call
+const deleteObjectsLimit = 1000
+
+type (
+	// ExpiredObject an object older than its class allows
+	ExpiredObject struct {
+		Key       string        `json:"key"`
+		Class     string        `json:"class"`
+		Sender    string        `json:"sender,omitempty"`
+		ForUserID string        `json:"for_user_id,omitempty"`
+		Age       time.Duration `json:"age"`
+	}
+	// ClassReport counts for one retention class
+	ClassReport struct {
+		Scanned int `json:"scanned"`
+		Expired int `json:"expired"`
+	}
+	// Report result of a run. In dry-run mode Expired lists what would
+	// have been deleted and Deleted is zero.
+	Report struct {
+		Bucket  string                 `json:"bucket"`
+		Policy  string                 `json:"policy"`
+		DryRun  bool                   `json:"dry_run"`
+		Scanned int                    `json:"scanned"`
+		Deleted int                    `json:"deleted"`
+		Classes map[string]ClassReport `json:"classes"`
+		Expired []ExpiredObject        `json:"expired"`
+		// Omitted expired objects left out of Expired, see Capped
+		Omitted int `json:"omitted,omitempty"`
+	}
+)
+
+// Capped returns r listing at most max expired objects, the counts are kept.
+func (r Report) Capped(max int) Report {
+	if len(r.Expired) <= max {
+		return r
+	}
+	r.Omitted += len(r.Expired) - max
+	r.Expired = r.Expired[:max]
+	return r
+}
+
+// Enforcer deletes objects that are older than their retention class allows
+type Enforcer struct {
+	s3     s3iface.S3API
+	index  pictureindex.Index
+	hashes phashindex.Index
+	bucket string
+	policy Policy
+	// DryRun only reports, nothing is deleted
+	DryRun bool
+	now    func() time.Time
+}
+
+// NewEnforcer returns an Enforcer for bucket. Deleted objects are also
+// removed from index, deleted pictures from hashes.
+func NewEnforcer(s3Svc s3iface.S3API, index pictureindex.Index, hashes phashindex.Index, bucket string, policy Policy) *Enforcer {
+	return &Enforcer{
+		s3:     s3Svc,
+		index:  index,
+		hashes: hashes,
+		bucket: bucket,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Run scans the bucket once.
+func (e *Enforcer) Run(ctx context.Context) (Report, error) {
+	report := Report{
+		Bucket:  e.bucket,
+		Policy:  e.policy.String(),
+		DryRun:  e.DryRun,
+		Classes: make(map[string]ClassReport),
+		Expired: make([]ExpiredObject, 0),
+	}
+	now := e.now()
+	minAge := e.policy.minAge()
+
+	var scanErr error
+	err := e.s3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(e.bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			report.Scanned++
+			key := aws.StringValue(obj.Key)
+			age := now.Sub(aws.TimeValue(obj.LastModified))
+
+			var tags Tags
+			if minAge > 0 && age > minAge {
+				out, err := e.s3.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+					Bucket: aws.String(e.bucket),
+					Key:    obj.Key,
+				})
+				if err != nil {
+					scanErr = fmt.Errorf("get tags of %s: %v", key, err)
+					return false
+				}
+				tags = TagsFromS3(out.TagSet)
+			}
+
+			class := ClassOf(key, tags)
+			c := report.Classes[class]
+			c.Scanned++
+			if maxAge, ok := e.policy[class]; ok && age > maxAge {
+				c.Expired++
+				report.Expired = append(report.Expired, ExpiredObject{
+					Key:       key,
+					Class:     class,
+					Sender:    tags.Sender,
+					ForUserID: tags.ForUserID,
+					Age:       age,
+				})
+			}
+			report.Classes[class] = c
+		}
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("list objects: %v", err)
+	}
+	if scanErr != nil {
+		return report, scanErr
+	}
+
+	if e.DryRun {
+		return report, nil
+	}
+	deleted, err := e.delete(ctx, report.Expired)
+	report.Deleted = deleted
+	return report, err
+}
+
+func (e *Enforcer) delete(ctx context.Context, expired []ExpiredObject) (int, error) {
+	deleted := 0
+	for start := 0; start < len(expired); start += deleteObjectsLimit {
+		end := start + deleteObjectsLimit
+		if end > len(expired) {
+			end = len(expired)
+		}
+		batch := expired[start:end]
+
+		ids := make([]*s3.ObjectIdentifier, 0, len(batch))
+		for _, obj := range batch {
+			ids = append(ids, &s3.ObjectIdentifier{Key: aws.String(obj.Key)})
+		}
+		out, err := e.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(e.bucket),
+			Delete: &s3.Delete{
+				Objects: ids,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("delete objects: %v", err)
+		}
+
+		failed := make(map[string]bool)
+		for _, f := range out.Errors {
+			failed[aws.StringValue(f.Key)] = true
+		}
+		for _, obj := range batch {
+			if failed[obj.Key] {
+				continue
+			}
+			deleted++
+			if err := e.unindex(ctx, obj); err != nil {
+				return deleted, err
+			}
+		}
+		if len(out.Errors) > 0 {
+			return deleted, fmt.Errorf("delete objects: %d failed, first %s: %s",
+				len(out.Errors), aws.StringValue(out.Errors[0].Key), aws.StringValue(out.Errors[0].Message))
+		}
+	}
+	return deleted, nil
+}
+
+// unindex removes a deleted object from the index of every owner it was
+// stored for, and a picture's perceptual hash. Objects are stored by
+// content, the Sender and ForUserID tags only name the first of them.
+func (e *Enforcer) unindex(ctx context.Context, obj ExpiredObject) error {
+	if checksum, ok := picturestore.Checksum(obj.Key); ok {
+		if err := e.hashes.Remove(ctx, checksum); err != nil {
+			return err
+		}
+	}
+	indexed := pictureindex.Object{Bucket: e.bucket, Key: obj.Key}
+	owners, err := e.index.Owners(ctx, indexed)
+	if err != nil {
+		return err
+	}
+	if obj.Sender != "" && obj.ForUserID != "" {
+		owners = append(owners, pictureindex.Owner{ForUserID: obj.ForUserID, SenderID: obj.Sender})
+	}
+	for _, owner := range owners {
+		if err := e.index.Remove(ctx, owner, indexed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
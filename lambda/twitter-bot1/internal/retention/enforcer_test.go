@@ -0,0 +1,155 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+)
+
+type fakeObject struct {
+	modified time.Time
+	tags     Tags
+}
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]fakeObject
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	page := &s3.ListObjectsV2Output{}
+	for key, obj := range f.objects {
+		page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key), LastModified: aws.Time(obj.modified)})
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeS3) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	t := f.objects[aws.StringValue(input.Key)].tags
+	out := &s3.GetObjectTaggingOutput{}
+	if t.RetentionClass != "" {
+		out.TagSet = append(out.TagSet, &s3.Tag{Key: aws.String(TagRetentionClass), Value: aws.String(t.RetentionClass)})
+	}
+	if t.Sender != "" {
+		out.TagSet = append(out.TagSet, &s3.Tag{Key: aws.String(TagSender), Value: aws.String(t.Sender)})
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	for _, id := range input.Delete.Objects {
+		delete(f.objects, aws.StringValue(id.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestEnforcerRun(t *testing.T) {
+	now := time.Date(2019, 7, 10, 12, 0, 0, 0, time.UTC)
+	newS3 := func() *fakeS3 {
+		return &fakeS3{objects: map[string]fakeObject{
+			"2019/07/10/1.jpg":      {modified: now.Add(-time.Hour), tags: Tags{Sender: "alice", ForUserID: "4337869213", RetentionClass: ClassRawImage}},
+			"sha256/2b.jpg":         {modified: now.Add(-48 * time.Hour), tags: Tags{Sender: "alice", ForUserID: "4337869213", RetentionClass: ClassRawImage}},
+			"2019/07/08/2.jpg.json": {modified: now.Add(-48 * time.Hour), tags: Tags{Sender: "alice", ForUserID: "4337869213", RetentionClass: ClassAnalysis}},
+			"2019/05/01/3.jpg.json": {modified: now.Add(-70 * 24 * time.Hour)},
+		}}
+	}
+
+	alice := pictureindex.Owner{ForUserID: "4337869213", SenderID: "alice"}
+	bob := pictureindex.Owner{ForUserID: "4337869213", SenderID: "bob"}
+	tt := []struct {
+		name      string
+		dryRun    bool
+		expired   int
+		deleted   int
+		remaining int
+		indexed   int
+		hashed    int
+	}{
+		{name: "dryRun", dryRun: true, expired: 2, deleted: 0, remaining: 4, indexed: 1, hashed: 1},
+		{name: "enforce", dryRun: false, expired: 2, deleted: 2, remaining: 2, indexed: 0, hashed: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s3Svc := newS3()
+			index := pictureindex.NewMemoryIndex()
+			index.Add(context.Background(), alice, pictureindex.Object{Bucket: "pictures", Key: "sha256/2b.jpg"})
+			// bob sent the same picture, the Sender tag only names alice
+			index.Add(context.Background(), bob, pictureindex.Object{Bucket: "pictures", Key: "sha256/2b.jpg"})
+
+			hashes := phashindex.NewMemoryIndex()
+			hashes.Add(context.Background(), phashindex.Entry{Hash: 0x0123456789abcdef, Checksum: "2b"})
+
+			e := NewEnforcer(s3Svc, index, hashes, "pictures", DefaultPolicy)
+			e.DryRun = tc.dryRun
+			e.now = func() time.Time { return now }
+
+			report, err := e.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run failed with error: %v", err)
+			}
+			if len(report.Expired) != tc.expired || report.Deleted != tc.deleted || len(s3Svc.objects) != tc.remaining {
+				t.Fatalf("got expired: %v deleted: %v remaining: %v, wanted: %v %v %v",
+					len(report.Expired), report.Deleted, len(s3Svc.objects), tc.expired, tc.deleted, tc.remaining)
+			}
+			if _, ok := s3Svc.objects["2019/07/08/2.jpg.json"]; !ok {
+				t.Fatalf("analysis younger than 30 days was deleted")
+			}
+			for _, owner := range []pictureindex.Owner{alice, bob} {
+				objects, _ := index.List(context.Background(), owner)
+				if len(objects) != tc.indexed {
+					t.Fatalf("got: %v indexed objects for %v, wanted: %v", len(objects), owner, tc.indexed)
+				}
+			}
+			if matches, _ := hashes.Nearest(context.Background(), 0x0123456789abcdef, 0); len(matches) != tc.hashed {
+				t.Fatalf("got: %v hashes, wanted: %v", len(matches), tc.hashed)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("raw-image=24h, analysis=720h")
+	if err != nil {
+		t.Fatalf("ParsePolicy failed with error: %v", err)
+	}
+	if p[ClassRawImage] != 24*time.Hour || p[ClassAnalysis] != 720*time.Hour {
+		t.Fatalf("got: %v", p)
+	}
+	for _, bad := range []string{"raw-image", "raw-image=soon", "analysis=-1h"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Fatalf("ParsePolicy(%q) got no error", bad)
+		}
+	}
+}
+
+func TestReportCapped(t *testing.T) {
+	report := Report{Scanned: 3, Expired: []ExpiredObject{{Key: "1.jpg"}, {Key: "2.jpg"}, {Key: "3.jpg"}}}
+
+	tt := []struct {
+		name    string
+		max     int
+		listed  int
+		omitted int
+	}{
+		{name: "underCap", max: 5, listed: 3},
+		{name: "overCap", max: 2, listed: 2, omitted: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := report.Capped(tc.max)
+			if len(got.Expired) != tc.listed || got.Omitted != tc.omitted || got.Scanned != 3 {
+				t.Fatalf("got: %+v, wanted: %v listed %v omitted", got, tc.listed, tc.omitted)
+			}
+		})
+	}
+}
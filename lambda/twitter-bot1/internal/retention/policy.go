@@ -0,0 +1,63 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Policy maximum age per retention class. Classes without a rule are kept.
+type Policy map[string]time.Duration
+
+// DefaultPolicy deletes raw images after a day and analyses after 30 days.
+var DefaultPolicy = Policy{
+	ClassTransient: time.Hour,
+	ClassRawImage:  24 * time.Hour,
+	ClassAnalysis:  30 * 24 * time.Hour,
+}
+
+// ParsePolicy parses rules in the form "raw-image=24h,analysis=720h". An
+// empty string returns DefaultPolicy.
+func ParsePolicy(s string) (Policy, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultPolicy, nil
+	}
+	p := make(Policy)
+	for _, rule := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("retention rule %q is not class=duration", rule)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("retention rule %q: %v", rule, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("retention rule %q: duration must be positive", rule)
+		}
+		p[parts[0]] = d
+	}
+	return p, nil
+}
+
+// String returns p in the form ParsePolicy reads.
+func (p Policy) String() string {
+	rules := make([]string, 0, len(p))
+	for class, d := range p {
+		rules = append(rules, fmt.Sprintf("%s=%s", class, d))
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ",")
+}
+
+// minAge shortest max age in p, objects younger than that need no lookup.
+func (p Policy) minAge() time.Duration {
+	var min time.Duration
+	for _, d := range p {
+		if min == 0 || d < min {
+			min = d
+		}
+	}
+	return min
+}
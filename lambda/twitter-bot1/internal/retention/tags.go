@@ -0,0 +1,112 @@
+package retention
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Object tag keys
+const (
+	TagSender         = "sender"
+	TagForUserID      = "for-user-id"
+	TagMediaType      = "media-type"
+	TagAnalysisType   = "analysis-type"
+	TagRetentionClass = "retention-class"
+)
+
+// Retention classes
+const (
+	// ClassRawImage pictures as downloaded from twitter
+	ClassRawImage = "raw-image"
+	// ClassAnalysis analysis results, they do not contain the picture
+	ClassAnalysis = "analysis"
+	// ClassTransient objects of senders who turned retention off, they are
+	// normally deleted right after the analysis
+	ClassTransient = "transient"
+)
+
+// Analysis types
+const (
+	// AnalysisFaces DetectFaces results
+	AnalysisFaces = "faces"
+	// AnalysisLabels DetectLabels results
+	AnalysisLabels = "labels"
+)
+
+// Tags describe a stored object
+type Tags struct {
+	Sender string
+	// ForUserID bot account the sender sent the object to
+	ForUserID      string
+	MediaType      string
+	AnalysisType   string
+	RetentionClass string
+}
+
+// Encode returns t in the form of the Tagging parameter of PutObject.
+func (t Tags) Encode() string {
+	v := url.Values{}
+	set := func(key string, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set(TagSender, t.Sender)
+	set(TagForUserID, t.ForUserID)
+	set(TagMediaType, t.MediaType)
+	set(TagAnalysisType, t.AnalysisType)
+	set(TagRetentionClass, t.RetentionClass)
+	return v.Encode()
+}
+
+// DecodeTags parses tags in the form Encode returns, unknown keys are
+// ignored.
+func DecodeTags(tagging string) (Tags, error) {
+	values, err := url.ParseQuery(tagging)
+	if err != nil {
+		return Tags{}, err
+	}
+	return Tags{
+		Sender:         values.Get(TagSender),
+		ForUserID:      values.Get(TagForUserID),
+		MediaType:      values.Get(TagMediaType),
+		AnalysisType:   values.Get(TagAnalysisType),
+		RetentionClass: values.Get(TagRetentionClass),
+	}, nil
+}
+
+// TagsFromS3 converts a GetObjectTagging tag set.
+func TagsFromS3(tagSet []*s3.Tag) Tags {
+	var t Tags
+	for _, tag := range tagSet {
+		value := aws.StringValue(tag.Value)
+		switch aws.StringValue(tag.Key) {
+		case TagSender:
+			t.Sender = value
+		case TagForUserID:
+			t.ForUserID = value
+		case TagMediaType:
+			t.MediaType = value
+		case TagAnalysisType:
+			t.AnalysisType = value
+		case TagRetentionClass:
+			t.RetentionClass = value
+		}
+	}
+	return t
+}
+
+// ClassOf returns the retention class of an object. Objects stored before
+// tagging was introduced are classified by their key.
+func ClassOf(key string, t Tags) string {
+	if t.RetentionClass != "" {
+		return t.RetentionClass
+	}
+	if strings.HasSuffix(key, ".json") {
+		return ClassAnalysis
+	}
+	return ClassRawImage
+}
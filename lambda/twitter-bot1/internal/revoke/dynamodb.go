@@ -0,0 +1,42 @@
+package revoke
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBAuditLog keeps entries in a table with the string partition key
+// user_id and the number sort key created_at.
+type DynamoDBAuditLog struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBAuditLog returns an audit log using table.
+func NewDynamoDBAuditLog(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBAuditLog {
+	return &DynamoDBAuditLog{
+		client: client,
+		table:  table,
+	}
+}
+
+// Record implements AuditLog.
+func (d *DynamoDBAuditLog) Record(ctx context.Context, entry Entry) error {
+	item, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %v", err)
+	}
+	_, err = d.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("put audit entry: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package revoke
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryAuditLog keeps entries in memory. It is used for tests and when the
+// bot is self-hosted without DynamoDB.
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewMemoryAuditLog returns an empty MemoryAuditLog.
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+// Record implements AuditLog.
+func (m *MemoryAuditLog) Record(ctx context.Context, entry Entry) error {
+	m.mu.Lock()
+	m.entries = append(m.entries, entry)
+	m.mu.Unlock()
+	return nil
+}
+
+// Entries returns the recorded entries, oldest first.
+func (m *MemoryAuditLog) Entries() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Entry(nil), m.entries...)
+}
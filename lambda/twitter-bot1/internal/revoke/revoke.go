@@ -0,0 +1,126 @@
+// Package revoke cleans up after a user revokes the app's access to their
+// account: the webhook subscription is removed, everything stored by the
+// user's account, about every sender of it, is deleted, the account is
+// removed from the registry and the revocation is recorded in an audit log.
+package revoke
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// Audit entry statuses
+const (
+	StatusPurged = "purged"
+	StatusFailed = "failed"
+)
+
+type (
+	// Entry one audit log record of a revocation
+	Entry struct {
+		UserID string `json:"user_id"`
+		// CreatedAt unix milliseconds the entry was recorded
+		CreatedAt int64  `json:"created_at"`
+		AppID     string `json:"app_id"`
+		// RevokedAt unix milliseconds of the revocation, 0 when unknown
+		RevokedAt int64  `json:"revoked_at"`
+		RequestID string `json:"request_id"`
+		Status    string `json:"status"`
+		// Objects number of deleted pictures and analyses
+		Objects int    `json:"objects"`
+		Error   string `json:"error,omitempty"`
+	}
+	// AuditLog records revocations, entries are never changed or removed
+	AuditLog interface {
+		Record(ctx context.Context, entry Entry) error
+	}
+	// Forgetter deletes everything an account stored, see forget.Forgetter
+	Forgetter interface {
+		ForgetAccount(ctx context.Context, forUserID string) (forget.Result, error)
+	}
+	// Accounts removes revoked accounts, see account.Registry
+	Accounts interface {
+		Delete(ctx context.Context, userID string) error
+	}
+	// UnsubscribeFunc stops webhook deliveries for userID
+	UnsubscribeFunc func(ctx context.Context, userID string) error
+)
+
+// Revoker runs the cleanup. It implements webhook.ActivityHandler for revoke
+// activities.
+type Revoker struct {
+	unsubscribe UnsubscribeFunc
+	forgetter   Forgetter
+	accounts    Accounts
+	audit       AuditLog
+	now         func() time.Time
+}
+
+// New returns a Revoker.
+func New(unsubscribe UnsubscribeFunc, forgetter Forgetter, accounts Accounts, audit AuditLog) *Revoker {
+	return &Revoker{
+		unsubscribe: unsubscribe,
+		forgetter:   forgetter,
+		accounts:    accounts,
+		audit:       audit,
+		now:         time.Now,
+	}
+}
+
+// HandleActivity implements webhook.ActivityHandler.
+func (r *Revoker) HandleActivity(ctx context.Context, activity webhook.Activity) error {
+	if activity.Kind != webhook.KindRevoke {
+		return nil
+	}
+	return r.Revoke(ctx, activity)
+}
+
+// Revoke unsubscribes the user who revoked access, deletes what their
+// account stored and removes the account, last so a repeated run still finds
+// it.
+// Every step can be repeated, so on failure the revocation is recorded as
+// failed and the error returned for the event to be delivered again.
+func (r *Revoker) Revoke(ctx context.Context, activity webhook.Activity) error {
+	entry := Entry{
+		UserID:    activity.SourceID,
+		AppID:     activity.ObjectID,
+		RevokedAt: activity.CreateTimestamp,
+		RequestID: activity.RequestID,
+		Status:    StatusPurged,
+	}
+
+	objects, err := r.purge(ctx, activity.SourceID)
+	entry.Objects = objects
+	if err != nil {
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+	}
+	entry.CreatedAt = r.now().UnixNano() / int64(time.Millisecond)
+
+	if aerr := r.audit.Record(ctx, entry); aerr != nil {
+		if err == nil {
+			return aerr
+		}
+		logging.FromContext(ctx).Error("failed to record failed revocation", logging.FieldSenderHash, logging.SenderHash(activity.SourceID), "error", aerr)
+	}
+	return err
+}
+
+func (r *Revoker) purge(ctx context.Context, userID string) (int, error) {
+	if err := r.unsubscribe(ctx, userID); err != nil {
+		return 0, fmt.Errorf("unsubscribe %s: %v", userID, err)
+	}
+	result, err := r.forgetter.ForgetAccount(ctx, userID)
+	if err != nil {
+		return len(result.Objects), fmt.Errorf("forget %s: %v", userID, err)
+	}
+	if err := r.accounts.Delete(ctx, userID); err != nil {
+		return len(result.Objects), fmt.Errorf("delete account %s: %v", userID, err)
+	}
+	return len(result.Objects), nil
+}
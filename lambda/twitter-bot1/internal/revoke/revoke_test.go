@@ -0,0 +1,120 @@
+package revoke
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+type fakeS3 struct {
+	s3iface.S3API
+	deleted int
+	err     error
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.deleted += len(input.Delete.Objects)
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestHandleActivity(t *testing.T) {
+	revocation := webhook.Activity{Kind: webhook.KindRevoke, ForUserID: "4337869213", SourceID: "4337869213", ObjectID: "app", CreateTimestamp: 1527155292000}
+
+	tt := []struct {
+		name           string
+		activity       webhook.Activity
+		unsubscribeErr error
+		forgetErr      error
+		err            bool
+		unsubscribed   int
+		deleted        int
+		purged         bool
+		status         string
+		objects        int
+	}{
+		{name: "revoke", activity: revocation, unsubscribed: 1, deleted: 3, purged: true, status: StatusPurged, objects: 3},
+		{name: "otherKind", activity: webhook.Activity{Kind: webhook.KindFollow, ForUserID: "4337869213", SourceID: "alice"}},
+		{name: "unsubscribeFailure", activity: revocation, unsubscribeErr: fmt.Errorf("boom"), err: true, unsubscribed: 1, status: StatusFailed},
+		{name: "forgetFailure", activity: revocation, forgetErr: fmt.Errorf("boom"), err: true, unsubscribed: 1, status: StatusFailed, objects: 2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			index := pictureindex.NewMemoryIndex()
+			conversations := conversation.NewMemoryStore()
+			registry := account.NewMemoryRegistry(account.Account{UserID: "4337869213"}, account.Account{UserID: "783214"})
+			alice := pictureindex.Owner{ForUserID: "4337869213", SenderID: "alice"}
+			bob := pictureindex.Owner{ForUserID: "4337869213", SenderID: "bob"}
+			// alice also talks to another bot account
+			aliceElsewhere := pictureindex.Owner{ForUserID: "783214", SenderID: "alice"}
+			index.Add(ctx, alice, pictureindex.Object{Bucket: "pictures", Key: "1.jpg"})
+			index.Add(ctx, alice, pictureindex.Object{Bucket: "pictures", Key: "1.jpg.json"})
+			index.Add(ctx, bob, pictureindex.Object{Bucket: "pictures", Key: "2.jpg"})
+			index.Add(ctx, aliceElsewhere, pictureindex.Object{Bucket: "pictures", Key: "3.jpg"})
+			// carol only set her preferences
+			conversations.Put(ctx, conversation.State{ForUserID: "4337869213", SenderID: "carol", Preferences: conversation.Preferences{Language: "sv"}})
+			conversations.Put(ctx, conversation.State{ForUserID: "783214", SenderID: "alice", Preferences: conversation.Preferences{Language: "sv"}})
+
+			unsubscribed := 0
+			s3Svc := &fakeS3{err: tc.forgetErr}
+			audit := NewMemoryAuditLog()
+			r := New(func(ctx context.Context, userID string) error {
+				unsubscribed++
+				return tc.unsubscribeErr
+			}, forget.New(s3Svc, index, phashindex.NewMemoryIndex(), conversations), registry, audit)
+
+			err := r.HandleActivity(ctx, tc.activity)
+			if (err != nil) != tc.err {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.err)
+			}
+			if unsubscribed != tc.unsubscribed || s3Svc.deleted != tc.deleted {
+				t.Fatalf("got: %v unsubscribed %v deleted, wanted: %v unsubscribed %v deleted", unsubscribed, s3Svc.deleted, tc.unsubscribed, tc.deleted)
+			}
+			senders, _ := index.Senders(ctx, "4337869213")
+			talked, _ := conversations.Senders(ctx, "4337869213")
+			_, accountErr := registry.Get(ctx, "4337869213")
+			if purged := len(senders) == 0 && len(talked) == 0 && accountErr == account.ErrUnknownAccount; purged != tc.purged {
+				t.Fatalf("got: senders %v %v account error %v, wanted purged: %v", senders, talked, accountErr, tc.purged)
+			}
+			if others, _ := index.List(ctx, aliceElsewhere); len(others) != 1 {
+				t.Fatalf("got: %v, wanted the other account's object kept", others)
+			}
+			if other, _ := conversations.Get(ctx, "783214", "alice"); other.Preferences.Language != "sv" {
+				t.Fatalf("got: %+v, wanted the other account's preferences kept", other)
+			}
+			if _, err := registry.Get(ctx, "783214"); err != nil {
+				t.Fatalf("got: %v, wanted the other account kept", err)
+			}
+
+			entries := audit.Entries()
+			if tc.status == "" {
+				if len(entries) != 0 {
+					t.Fatalf("got: %+v, wanted no audit entries", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got: %v audit entries, wanted: 1", len(entries))
+			}
+			e := entries[0]
+			if e.Status != tc.status || e.Objects != tc.objects || e.UserID != "4337869213" || e.RevokedAt != 1527155292000 {
+				t.Fatalf("got: %+v, wanted status %v with %v objects", e, tc.status, tc.objects)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+type awsSpanKey struct{}
+
+// Session adds span handlers to sess and returns it, every client created
+// from it afterwards times its calls in a span. Only calls made with a traced
+// context, the ...WithContext methods, get a span.
+func Session(sess *session.Session) *session.Session {
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "trace.StartSpan",
+		Fn:   startAWSSpan,
+	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "trace.EndSpan",
+		Fn:   endAWSSpan,
+	})
+	return sess
+}
+
+func startAWSSpan(r *request.Request) {
+	ctx, span := Start(r.Context(), r.ClientInfo.ServiceName+"."+r.Operation.Name)
+	if span == nil {
+		return
+	}
+	span.SetAttribute("aws.service", r.ClientInfo.ServiceName)
+	span.SetAttribute("aws.operation", r.Operation.Name)
+	r.SetContext(context.WithValue(ctx, awsSpanKey{}, span))
+}
+
+func endAWSSpan(r *request.Request) {
+	span, _ := r.Context().Value(awsSpanKey{}).(*Span)
+	if span == nil {
+		return
+	}
+	defer span.End()
+	span.SetAttribute("aws.request_id", r.RequestID)
+	span.SetAttribute("aws.retries", strconv.Itoa(r.RetryCount))
+	if r.HTTPResponse != nil {
+		span.SetAttribute("http.status_code", strconv.Itoa(r.HTTPResponse.StatusCode))
+	}
+	if aerr, ok := r.Error.(awserr.Error); ok {
+		span.SetAttribute("aws.error_code", aerr.Code())
+	}
+	span.SetError(r.Error)
+}
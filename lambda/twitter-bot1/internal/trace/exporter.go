@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// DefaultXRayDaemonAddress where the X-Ray daemon listens unless lambda's
+// AWS_XRAY_DAEMON_ADDRESS says otherwise
+const DefaultXRayDaemonAddress = "127.0.0.1:2000"
+
+// Exporter receives every ended span
+type Exporter interface {
+	Export(s Span)
+}
+
+// Nop discards every span
+type Nop struct{}
+
+// Export implements Exporter.
+func (Nop) Export(Span) {}
+
+// Writer writes every span as a JSON line, the local exporter
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Export implements Exporter.
+func (e *Writer) Export(s Span) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintln(e.w, string(b))
+}
+
+// Memory keeps every span in memory, for tests
+type Memory struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewMemory returns an empty Memory exporter.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Export implements Exporter.
+func (m *Memory) Export(s Span) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, s)
+}
+
+// Spans returns the exported spans in the order they ended.
+func (m *Memory) Spans() []Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Span(nil), m.spans...)
+}
+
+// XRay sends every span to the X-Ray daemon as a segment document
+type XRay struct {
+	conn net.Conn
+}
+
+// NewXRay returns an XRay exporter sending to the daemon at addr, empty addr
+// is DefaultXRayDaemonAddress.
+func NewXRay(addr string) (*XRay, error) {
+	if addr == "" {
+		addr = DefaultXRayDaemonAddress
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial x-ray daemon: %v", err)
+	}
+	return &XRay{conn: conn}, nil
+}
+
+// Export implements Exporter. Sending is best effort, a lost span is not
+// worth failing a request over.
+func (x *XRay) Export(s Span) {
+	b, err := json.Marshal(Segment(s))
+	if err != nil {
+		return
+	}
+	x.conn.Write(append([]byte("{\"format\":\"json\",\"version\":1}\n"), b...))
+}
+
+// Segment returns s as an X-Ray segment document. Spans with a parent are
+// sent as independent subsegments of it.
+func Segment(s Span) map[string]interface{} {
+	doc := map[string]interface{}{
+		"name":       s.Service,
+		"id":         s.SpanID,
+		"trace_id":   fmt.Sprintf("1-%s-%s", s.TraceID[:8], s.TraceID[8:]),
+		"start_time": float64(s.StartTime.UnixNano()) / 1e9,
+		"end_time":   float64(s.EndTime.UnixNano()) / 1e9,
+	}
+	if s.ParentID != "" {
+		doc["name"] = s.Name
+		doc["type"] = "subsegment"
+		doc["parent_id"] = s.ParentID
+	}
+	metadata := map[string]interface{}{"span": s.Name}
+	for k, v := range s.Attributes {
+		metadata[k] = v
+	}
+	if s.Error != "" {
+		doc["fault"] = true
+		metadata["error"] = s.Error
+	}
+	doc["metadata"] = map[string]interface{}{"default": metadata}
+	return doc
+}
@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Transport is an http.RoundTripper timing every request in a span, a child
+// of the span of the request's context. The trace context is not sent along,
+// the requests go to twitter.
+type Transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport returns a Transport sending requests with base, nil base is
+// http.DefaultTransport.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method+" "+req.URL.Host)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	defer span.End()
+	// only the path, queries may carry user input
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.host", req.URL.Host)
+	span.SetAttribute("http.path", req.URL.Path)
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.Error = resp.Status
+	}
+	return resp, nil
+}
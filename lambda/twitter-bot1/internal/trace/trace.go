@@ -0,0 +1,200 @@
+// Package trace follows one webhook delivery through the pipeline. Spans are
+// started by each lambda handler, by outbound http requests and by AWS SDK
+// calls, and the trace context travels between the Step Functions states in
+// the event as a W3C traceparent.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exporter names of NewExporter
+const (
+	ExporterOff    = "off"
+	ExporterStdout = "stdout"
+	ExporterXRay   = "xray"
+)
+
+// SpanContext identifies a span within its trace
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// Parse reads a traceparent, e.g.
+// 00-5d0e9f4a9b7c1e2f3a4b5c6d7e8f9a0b-1a2b3c4d5e6f7a8b-01.
+func Parse(traceparent string) (SpanContext, bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) {
+		return SpanContext{}, false
+	}
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}, true
+}
+
+// String returns sc as a traceparent.
+func (sc SpanContext) String() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Span one timed operation
+type Span struct {
+	SpanContext
+	ParentID   string            `json:"parent_id,omitempty"`
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	tracer *Tracer
+	ended  bool
+}
+
+// SetAttribute sets key to value on s. Like every Span method it does
+// nothing on a nil Span, the span of an untraced context.
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks s as failed with err, a nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Error = err.Error()
+}
+
+// End ends s and exports it, only the first End counts.
+func (s *Span) End() {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	s.EndTime = s.tracer.now()
+	s.tracer.exporter.Export(*s)
+}
+
+// Tracer starts the spans of one service
+type Tracer struct {
+	service  string
+	exporter Exporter
+	now      func() time.Time
+}
+
+// New returns a Tracer of service exporting its spans to exporter.
+func New(service string, exporter Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter, now: time.Now}
+}
+
+// NewExporter returns the exporter of a lambda by name: xray to the X-Ray
+// daemon lambda runs at xrayAddr, stdout as JSON lines or off.
+func NewExporter(name string, xrayAddr string) (Exporter, error) {
+	switch name {
+	case "", ExporterOff:
+		return Nop{}, nil
+	case ExporterStdout:
+		return NewWriter(os.Stdout), nil
+	case ExporterXRay:
+		return NewXRay(xrayAddr)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// Start starts a span, a child of the span of ctx or else the root of a new
+// trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if parent := FromContext(ctx); parent != nil {
+		return t.start(ctx, name, parent.TraceID, parent.SpanID)
+	}
+	return t.start(ctx, name, newTraceID(t.now()), "")
+}
+
+// Continue starts a span, a child of the remote span traceparent names. A
+// missing or malformed traceparent starts a new trace.
+func (t *Tracer) Continue(ctx context.Context, name string, traceparent string) (context.Context, *Span) {
+	if sc, ok := Parse(traceparent); ok {
+		return t.start(ctx, name, sc.TraceID, sc.SpanID)
+	}
+	return t.Start(ctx, name)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, traceID string, parentID string) (context.Context, *Span) {
+	s := &Span{
+		SpanContext: SpanContext{TraceID: traceID, SpanID: randomHex(8)},
+		ParentID:    parentID,
+		Service:     t.service,
+		Name:        name,
+		StartTime:   t.now(),
+		Attributes:  make(map[string]string),
+		tracer:      t,
+	}
+	return NewContext(ctx, s), s
+}
+
+// Start starts a child of the span of ctx, with the same tracer. An untraced
+// ctx is returned as is with a nil Span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+// Traceparent returns the traceparent of the span of ctx, to be passed on to
+// the next lambda. It is empty for an untraced ctx.
+func Traceparent(ctx context.Context) string {
+	if s := FromContext(ctx); s != nil {
+		return s.SpanContext.String()
+	}
+	return ""
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying s.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the span of ctx, nil when ctx is untraced.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// newTraceID starts with the time, as X-Ray trace ids do, so the same id
+// works with every exporter.
+func newTraceID(now time.Time) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(now.Unix()))
+	return hex.EncodeToString(b) + randomHex(12)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
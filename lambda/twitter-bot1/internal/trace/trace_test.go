@@ -0,0 +1,150 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name        string
+		traceparent string
+		ok          bool
+	}{
+		{name: "valid", traceparent: "00-5d0e9f4a9b7c1e2f3a4b5c6d7e8f9a0b-1a2b3c4d5e6f7a8b-01", ok: true},
+		{name: "empty", traceparent: ""},
+		{name: "unknownVersion", traceparent: "ff-5d0e9f4a9b7c1e2f3a4b5c6d7e8f9a0b-1a2b3c4d5e6f7a8b-01"},
+		{name: "zeroTraceID", traceparent: "00-00000000000000000000000000000000-1a2b3c4d5e6f7a8b-01"},
+		{name: "shortSpanID", traceparent: "00-5d0e9f4a9b7c1e2f3a4b5c6d7e8f9a0b-1a2b-01"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, ok := Parse(tc.traceparent)
+			if ok != tc.ok {
+				t.Fatalf("got: %v, wanted: %v", ok, tc.ok)
+			}
+			if ok && sc.String() != tc.traceparent {
+				t.Fatalf("got: %v, wanted: %v", sc.String(), tc.traceparent)
+			}
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	webhookSpans := NewMemory()
+	replySpans := NewMemory()
+
+	ctx, root := New("twitter-bot1", webhookSpans).Start(context.Background(), "webhook")
+	_, child := Start(ctx, "publish")
+	child.End()
+	root.End()
+
+	_, remote := New("twitter-reply", replySpans).Continue(context.Background(), "reply", Traceparent(ctx))
+	remote.End()
+
+	spans := append(webhookSpans.Spans(), replySpans.Spans()...)
+	if len(spans) != 3 {
+		t.Fatalf("got: %v spans, wanted: %v", len(spans), 3)
+	}
+	for _, s := range spans {
+		if s.TraceID != root.TraceID {
+			t.Fatalf("got: %v trace of %s, wanted: %v", s.TraceID, s.Name, root.TraceID)
+		}
+	}
+	if child.ParentID != root.SpanID || remote.ParentID != root.SpanID {
+		t.Fatalf("got: %v and %v parents, wanted: %v", child.ParentID, remote.ParentID, root.SpanID)
+	}
+	if root.ParentID != "" {
+		t.Fatalf("got: %v, wanted: a root span", root.ParentID)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tt := []struct {
+		name   string
+		traced bool
+		spans  int
+	}{
+		{name: "traced", traced: true, spans: 2},
+		{name: "untraced", traced: false, spans: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := NewMemory()
+			ctx := context.Background()
+			var root *Span
+			if tc.traced {
+				ctx, root = New("twitter-get-picture", exporter).Start(ctx, "handler")
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/dm/1/picture.jpg?secret=x", nil)
+			resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req.WithContext(ctx))
+			if err != nil {
+				t.Fatalf("got: %v, wanted: no error", err)
+			}
+			resp.Body.Close()
+			root.End()
+
+			spans := exporter.Spans()
+			if len(spans) != tc.spans {
+				t.Fatalf("got: %v spans, wanted: %v", len(spans), tc.spans)
+			}
+			if tc.traced {
+				s := spans[0]
+				if s.Attributes["http.path"] != "/dm/1/picture.jpg" || s.Attributes["http.status_code"] != "503" || s.Error == "" {
+					t.Fatalf("got: %v %v, wanted: the path, status and error", s.Attributes, s.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "req-1")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	sess := Session(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("eu-north-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})))
+	exporter := NewMemory()
+	ctx, root := New("twitter-reply", exporter).Start(context.Background(), "handler")
+
+	_, err := dynamodb.New(sess).GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("conversations"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"sender_id": {S: aws.String("1")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("got: %v, wanted: no error", err)
+	}
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got: %v spans, wanted: %v", len(spans), 2)
+	}
+	s := spans[0]
+	if s.Name != "dynamodb.GetItem" || s.ParentID != root.SpanID || s.Attributes["aws.request_id"] != "req-1" {
+		t.Fatalf("got: %v %v %v, wanted: %v %v %v", s.Name, s.ParentID, s.Attributes["aws.request_id"], "dynamodb.GetItem", root.SpanID, "req-1")
+	}
+}
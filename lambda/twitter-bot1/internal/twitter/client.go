@@ -0,0 +1,174 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dbgeek/oauth"
+)
+
+// DirectMessageURL endpoint direct messages are sent to
+const DirectMessageURL = "https://api.twitter.com/1.1/direct_messages/events/new.json"
+
+// Quick reply limits of the direct message API
+const (
+	QuickReplyOptions         = "options"
+	MaxQuickReplyOptions      = 20
+	MaxQuickReplyLabel        = 36
+	MaxQuickReplyMetadataSize = 1000
+)
+
+type (
+	// DirectMessageRequest body of a direct_messages/events/new request
+	DirectMessageRequest struct {
+		Event OutgoingEvent `json:"event"`
+	}
+	// OutgoingEvent ..
+	OutgoingEvent struct {
+		Type          string                `json:"type"`
+		MessageCreate OutgoingMessageCreate `json:"message_create"`
+	}
+	// OutgoingMessageCreate ..
+	OutgoingMessageCreate struct {
+		Target      Target              `json:"target"`
+		MessageData OutgoingMessageData `json:"message_data"`
+	}
+	// OutgoingMessageData ..
+	OutgoingMessageData struct {
+		Text       string              `json:"text"`
+		QuickReply *QuickReply         `json:"quick_reply,omitempty"`
+		Attachment *OutgoingAttachment `json:"attachment,omitempty"`
+	}
+	// QuickReply options the recipient can answer with a single tap
+	QuickReply struct {
+		Type    string             `json:"type"`
+		Options []QuickReplyOption `json:"options"`
+	}
+	// QuickReplyOption ..
+	QuickReplyOption struct {
+		Label       string `json:"label"`
+		Description string `json:"description,omitempty"`
+		Metadata    string `json:"metadata,omitempty"`
+	}
+	// OutgoingAttachment media uploaded with UploadMedia
+	OutgoingAttachment struct {
+		Type  string        `json:"type"`
+		Media OutgoingMedia `json:"media"`
+	}
+	// OutgoingMedia ..
+	OutgoingMedia struct {
+		ID string `json:"id"`
+	}
+	// DirectMessageResponse body of a successful direct_messages/events/new
+	// request, Event.ID is the id of the sent message
+	DirectMessageResponse struct {
+		Event DirectMessageEvent `json:"event"`
+	}
+)
+
+// NewHTTPClient returns a client signing requests with the app's consumer
+// key and the bot account's access token.
+func NewHTTPClient(consumerKey string, consumerSecret string, oauthToken string, oauthSecret string) (*http.Client, error) {
+	c := oauth.NewConsumer(
+		consumerKey,
+		consumerSecret,
+		oauth.ServiceProvider{
+			RequestTokenUrl:   "https://api.twitter.com/oauth/request_token",
+			AuthorizeTokenUrl: "https://api.twitter.com/oauth/authorize",
+			AccessTokenUrl:    "https://api.twitter.com/oauth/access_token",
+		})
+
+	return c.MakeHttpClient(&oauth.AccessToken{
+		Token:  oauthToken,
+		Secret: oauthSecret,
+	})
+}
+
+// NewDirectMessageRequest returns a text message to recipientID.
+func NewDirectMessageRequest(recipientID string, text string) DirectMessageRequest {
+	return DirectMessageRequest{
+		Event: OutgoingEvent{
+			Type: "message_create",
+			MessageCreate: OutgoingMessageCreate{
+				Target: Target{
+					RecipientID: recipientID,
+				},
+				MessageData: OutgoingMessageData{
+					Text: text,
+				},
+			},
+		},
+	}
+}
+
+// SetQuickReplies offers options with the message. Options beyond
+// MaxQuickReplyOptions are dropped and labels are cut to MaxQuickReplyLabel.
+func (r *DirectMessageRequest) SetQuickReplies(options []QuickReplyOption) {
+	if len(options) == 0 {
+		r.Event.MessageCreate.MessageData.QuickReply = nil
+		return
+	}
+	if len(options) > MaxQuickReplyOptions {
+		options = options[:MaxQuickReplyOptions]
+	}
+	qr := &QuickReply{
+		Type:    QuickReplyOptions,
+		Options: make([]QuickReplyOption, 0, len(options)),
+	}
+	for _, o := range options {
+		if label := []rune(o.Label); len(label) > MaxQuickReplyLabel {
+			o.Label = string(label[:MaxQuickReplyLabel])
+		}
+		qr.Options = append(qr.Options, o)
+	}
+	r.Event.MessageCreate.MessageData.QuickReply = qr
+}
+
+// SetMedia attaches media uploaded with UploadMedia.
+func (r *DirectMessageRequest) SetMedia(mediaID string) {
+	if mediaID == "" {
+		r.Event.MessageCreate.MessageData.Attachment = nil
+		return
+	}
+	r.Event.MessageCreate.MessageData.Attachment = &OutgoingAttachment{
+		Type:  "media",
+		Media: OutgoingMedia{ID: mediaID},
+	}
+}
+
+// SendDirectMessage posts req with client and returns the sent message.
+// Failed requests return an *APIError.
+func SendDirectMessage(ctx context.Context, client *http.Client, req DirectMessageRequest) (DirectMessageEvent, error) {
+	payLoad, err := json.Marshal(req)
+	if err != nil {
+		return DirectMessageEvent{}, fmt.Errorf("marshal direct message: %v", err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, DirectMessageURL, bytes.NewReader(payLoad))
+	if err != nil {
+		return DirectMessageEvent{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return DirectMessageEvent{}, &APIError{Kind: ErrorTransport, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return DirectMessageEvent{}, &APIError{Kind: ErrorTransport, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode >= 300 {
+		return DirectMessageEvent{}, newAPIError(resp, body)
+	}
+
+	var r DirectMessageResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return DirectMessageEvent{}, fmt.Errorf("decode direct message response: %v", err)
+	}
+	return r.Event, nil
+}
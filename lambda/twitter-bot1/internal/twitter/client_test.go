@@ -0,0 +1,208 @@
+package twitter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+)
+
+// rewriteTransport sends every request to the test server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSendDirectMessage(t *testing.T) {
+	tt := []struct {
+		name      string
+		status    int
+		body      string
+		id        string
+		kind      string
+		retryable bool
+	}{
+		{
+			name:   "sent",
+			status: 200,
+			body:   `{"event":{"type":"message_create","id":"1146471302356254724","created_timestamp":"1562101442452"}}`,
+			id:     "1146471302356254724",
+		},
+		{
+			name:   "doesNotAcceptDMs",
+			status: 403,
+			body:   `{"errors":[{"code":349,"message":"You cannot send messages to this user."}]}`,
+			kind:   ErrorForbidden,
+		},
+		{
+			name:      "rateLimited",
+			status:    429,
+			body:      `{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`,
+			kind:      ErrorRateLimited,
+			retryable: true,
+		},
+		{
+			name:      "serverError",
+			status:    503,
+			body:      `Over capacity`,
+			kind:      ErrorServer,
+			retryable: true,
+		},
+		{
+			name:   "badRequest",
+			status: 400,
+			body:   `{"errors":[{"code":214,"message":"event.message_create.target.recipient_id: 'x' is not a valid Long"}]}`,
+			kind:   ErrorRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("x-rate-limit-reset", "1562101500")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer ts.Close()
+			target, _ := url.Parse(ts.URL)
+			client := &http.Client{Transport: rewriteTransport{target: target}}
+
+			event, err := SendDirectMessage(context.Background(), client, NewDirectMessageRequest("3805104374", "hi"))
+			if tc.kind == "" {
+				if err != nil {
+					t.Fatalf("SendDirectMessage failed with error: %v", err)
+				}
+				if event.ID != tc.id {
+					t.Fatalf("got id: %v, wanted: %v", event.ID, tc.id)
+				}
+				return
+			}
+			apiErr, ok := err.(*APIError)
+			if !ok {
+				t.Fatalf("got error: %v, wanted an *APIError", err)
+			}
+			if apiErr.Kind != tc.kind || apiErr.Retryable() != tc.retryable {
+				t.Fatalf("got: %v %v, wanted: %v %v", apiErr.Kind, apiErr.Retryable(), tc.kind, tc.retryable)
+			}
+			if tc.kind == ErrorRateLimited && apiErr.Reset.Unix() != 1562101500 {
+				t.Fatalf("got reset: %v, wanted: 1562101500", apiErr.Reset.Unix())
+			}
+		})
+	}
+}
+
+func TestSendDirectMessageTraced(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event":{"type":"message_create","id":"1146471302356254724"}}`))
+	}))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	client := &http.Client{Transport: trace.NewTransport(rewriteTransport{target: target})}
+
+	exporter := trace.NewMemory()
+	ctx, root := trace.New("twitter-reply", exporter).Start(context.Background(), "handler")
+	if _, err := SendDirectMessage(ctx, client, NewDirectMessageRequest("3805104374", "hi")); err != nil {
+		t.Fatalf("SendDirectMessage failed with error: %v", err)
+	}
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got: %v spans, wanted: 2", len(spans))
+	}
+	post := spans[0]
+	if post.ParentID != root.SpanID || post.Attributes["http.method"] != http.MethodPost || post.Attributes["http.path"] != "/1.1/direct_messages/events/new.json" {
+		t.Fatalf("got: %v %v, wanted: the DM POST as a child of %v", post.ParentID, post.Attributes, root.SpanID)
+	}
+}
+
+func TestWorking(t *testing.T) {
+	tt := []struct {
+		name        string
+		lastReadID  string
+		recipientID string
+		paths       []string
+	}{
+		{
+			name:        "markReadAndType",
+			lastReadID:  "954491830116155396",
+			recipientID: "3805104374",
+			paths:       []string{"/1.1/direct_messages/mark_read.json", "/1.1/direct_messages/indicate_typing.json"},
+		},
+		{
+			name:        "refreshTyping",
+			recipientID: "3805104374",
+			paths:       []string{"/1.1/direct_messages/indicate_typing.json"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var paths []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				if r.FormValue("recipient_id") != tc.recipientID {
+					t.Errorf("got recipient_id: %v, wanted: %v", r.FormValue("recipient_id"), tc.recipientID)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer ts.Close()
+			target, _ := url.Parse(ts.URL)
+
+			Working(context.Background(), &http.Client{Transport: rewriteTransport{target: target}}, tc.lastReadID, tc.recipientID)
+
+			if len(paths) != len(tc.paths) {
+				t.Fatalf("got: %v, wanted: %v", paths, tc.paths)
+			}
+			for i := range paths {
+				if paths[i] != tc.paths[i] {
+					t.Fatalf("got: %v, wanted: %v", paths, tc.paths)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	tt := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{name: "unsubscribed", status: http.StatusNoContent},
+		{name: "notSubscribed", status: http.StatusNotFound},
+		{name: "serverError", status: http.StatusServiceUnavailable, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete || r.URL.Path != "/1.1/account_activity/all/prod/subscriptions/3805104374.json" {
+					t.Errorf("got: %v %v, wanted the DELETE of the subscription", r.Method, r.URL.Path)
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("got authorization: %v, wanted: Bearer token", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+			target, _ := url.Parse(ts.URL)
+
+			client := NewAppClient("token")
+			client.Transport.(*bearerTransport).base = rewriteTransport{target: target}
+
+			err := Unsubscribe(context.Background(), client, "prod", "3805104374")
+			if (err != nil) != tc.err {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package twitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kinds of failed API requests
+const (
+	// ErrorForbidden the recipient does not accept direct messages from the
+	// bot, or the app lacks permission. Retrying does not help.
+	ErrorForbidden = "forbidden"
+	// ErrorRateLimited the endpoint's rate limit is used up until Reset.
+	ErrorRateLimited = "rate-limited"
+	// ErrorServer twitter failed with a 5xx status.
+	ErrorServer = "server"
+	// ErrorRequest any other 4xx status, the request itself is wrong.
+	ErrorRequest = "request"
+	// ErrorTransport no response was received.
+	ErrorTransport = "transport"
+)
+
+type (
+	// APIError a failed twitter API request
+	APIError struct {
+		Kind       string
+		StatusCode int
+		// Code and Message of the first error in the response body
+		Code    int
+		Message string
+		// Reset when a rate limited endpoint can be used again, zero when
+		// twitter did not say
+		Reset time.Time
+		// Err the transport error of ErrorTransport
+		Err error
+	}
+	errorsResponse struct {
+		Errors []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+)
+
+// Error implements error.
+func (e *APIError) Error() string {
+	if e.Kind == ErrorTransport {
+		return fmt.Sprintf("twitter %s error: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("twitter %s error: status %d code %d: %s", e.Kind, e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable is true when the same request may succeed later.
+func (e *APIError) Retryable() bool {
+	switch e.Kind {
+	case ErrorRateLimited, ErrorServer, ErrorTransport:
+		return true
+	}
+	return false
+}
+
+// RetryAt earliest time a retry may succeed, zero when unknown.
+func (e *APIError) RetryAt() time.Time {
+	return e.Reset
+}
+
+// newAPIError classifies a response with an error status.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+	}
+	var r errorsResponse
+	if json.Unmarshal(body, &r) == nil && len(r.Errors) > 0 {
+		e.Code = r.Errors[0].Code
+		e.Message = r.Errors[0].Message
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrorForbidden
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrorRateLimited
+		if reset, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+			e.Reset = time.Unix(reset, 0)
+		}
+	case resp.StatusCode >= 500:
+		e.Kind = ErrorServer
+	default:
+		e.Kind = ErrorRequest
+	}
+	return e
+}
@@ -0,0 +1,78 @@
+package twitter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+)
+
+// Endpoints showing the recipient that the bot is working on their message
+const (
+	MarkReadURL       = "https://api.twitter.com/1.1/direct_messages/mark_read.json"
+	IndicateTypingURL = "https://api.twitter.com/1.1/direct_messages/indicate_typing.json"
+)
+
+// MarkRead marks the direct messages from recipientID up to lastReadEventID
+// as read by the bot. Failed requests return an *APIError.
+func MarkRead(ctx context.Context, client *http.Client, lastReadEventID string, recipientID string) error {
+	return postEmpty(ctx, client, MarkReadURL, url.Values{
+		"last_read_event_id": {lastReadEventID},
+		"recipient_id":       {recipientID},
+	})
+}
+
+// IndicateTyping shows recipientID that the bot is typing. Twitter shows the
+// indicator for a few seconds, or until the bot's next message, so it has to
+// be sent again during longer work. Failed requests return an *APIError.
+func IndicateTyping(ctx context.Context, client *http.Client, recipientID string) error {
+	return postEmpty(ctx, client, IndicateTypingURL, url.Values{
+		"recipient_id": {recipientID},
+	})
+}
+
+// postEmpty posts params to an endpoint answering 204 No Content.
+func postEmpty(ctx context.Context, client *http.Client, endpoint string, params url.Values) error {
+	resp, err := postForm(ctx, client, endpoint, params)
+	if err != nil {
+		return &APIError{Kind: ErrorTransport, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{Kind: ErrorTransport, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode >= 300 {
+		return newAPIError(resp, body)
+	}
+	return nil
+}
+
+// postForm is client.PostForm with ctx, the request's spans and logs belong
+// to the caller's.
+func postForm(ctx context.Context, client *http.Client, endpoint string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(req.WithContext(ctx))
+}
+
+// Working marks lastReadEventID from recipientID as read and shows the
+// recipient that the bot is typing, both are only a courtesy so failures are
+// logged and otherwise ignored.
+func Working(ctx context.Context, client *http.Client, lastReadEventID string, recipientID string) {
+	if lastReadEventID != "" {
+		if err := MarkRead(ctx, client, lastReadEventID, recipientID); err != nil {
+			logging.FromContext(ctx).Warn("failed to mark as read", logging.FieldDMEventID, lastReadEventID, "error", err)
+		}
+	}
+	if err := IndicateTyping(ctx, client, recipientID); err != nil {
+		logging.FromContext(ctx).Warn("failed to indicate typing", "error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package twitter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// MediaUploadURL endpoint media is uploaded to before it is attached to a
+// direct message
+const MediaUploadURL = "https://upload.twitter.com/1.1/media/upload.json"
+
+// MediaCategoryDMImage category of images attached to direct messages
+const MediaCategoryDMImage = "dm_image"
+
+type mediaUploadResponse struct {
+	MediaIDString string `json:"media_id_string"`
+}
+
+// UploadMedia uploads an image with the simple, non chunked, upload and
+// returns its media id. Twitter accepts images up to 5MB this way. Failed
+// requests return an *APIError.
+func UploadMedia(ctx context.Context, client *http.Client, data []byte) (string, error) {
+	resp, err := postForm(ctx, client, MediaUploadURL, url.Values{
+		"media_data":     {base64.StdEncoding.EncodeToString(data)},
+		"media_category": {MediaCategoryDMImage},
+	})
+	if err != nil {
+		return "", &APIError{Kind: ErrorTransport, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &APIError{Kind: ErrorTransport, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode >= 300 {
+		return "", newAPIError(resp, body)
+	}
+
+	var r mediaUploadResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", fmt.Errorf("decode media upload response: %v", err)
+	}
+	if r.MediaIDString == "" {
+		return "", fmt.Errorf("upload media: no media id in response")
+	}
+	return r.MediaIDString, nil
+}
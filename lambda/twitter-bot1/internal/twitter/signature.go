@@ -0,0 +1,41 @@
+package twitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const signaturePrefix = "sha256="
+
+// CRCResponseToken returns the response_token twitter expects as answer to a
+// challenge-response check with crcToken.
+func CRCResponseToken(consumerSecret string, crcToken string) string {
+	return fmt.Sprintf("%s%s", signaturePrefix, sign(consumerSecret, []byte(crcToken)))
+}
+
+// VerifySignature returns an error telling why signature, the value of the
+// X-Twitter-Webhooks-Signature header, is not valid for body.
+func VerifySignature(consumerSecret string, signature string, body []byte) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("signature has no %s prefix", signaturePrefix)
+	}
+	got, err := base64.StdEncoding.DecodeString(signature[len(signaturePrefix):])
+	if err != nil {
+		return fmt.Errorf("decode signature: %v", err)
+	}
+	h := hmac.New(sha256.New, []byte(consumerSecret))
+	h.Write(body)
+	if !hmac.Equal(got, h.Sum(nil)) {
+		return fmt.Errorf("signature does not match the body")
+	}
+	return nil
+}
+
+func sign(consumerSecret string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(consumerSecret))
+	h.Write(data)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
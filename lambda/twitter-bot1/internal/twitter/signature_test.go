@@ -0,0 +1,73 @@
+package twitter
+
+import (
+	"testing"
+)
+
+func TestCRCResponseToken(t *testing.T) {
+	tt := []struct {
+		name            string
+		twitterCrcToken string
+		consumerSecret  string
+		out             string
+	}{
+		{
+			name:            "simpleUnitTestforTwitterCrcToken",
+			twitterCrcToken: "helloWorld",
+			consumerSecret:  "ss",
+			out:             "sha256=YFpPr1o5UmzuIUDQn+BqYQ14kFOjWiWYc7oNiVymMgg=",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			result := CRCResponseToken(tc.consumerSecret, tc.twitterCrcToken)
+			if tc.out != result {
+				t.Fatalf("got: %v, wanted: %v", result, tc.out)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	tt := []struct {
+		name      string
+		signature string
+		body      string
+		out       bool
+	}{
+		{
+			name:      "validSignature",
+			signature: "sha256=P/M6xYi2AxkjB8C36xD3AfjT5XuOx3dWgw9EVXCYA2U=",
+			body:      "html body",
+			out:       true,
+		},
+		{
+			name:      "tamperedBody",
+			signature: "sha256=P/M6xYi2AxkjB8C36xD3AfjT5XuOx3dWgw9EVXCYA2U=",
+			body:      "html body!",
+			out:       false,
+		},
+		{
+			name:      "missingPrefix",
+			signature: "P/M6",
+			body:      "html body",
+			out:       false,
+		},
+		{
+			name:      "emptySignature",
+			signature: "",
+			body:      "html body",
+			out:       false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifySignature("bbbbbb", tc.signature, []byte(tc.body))
+			if result := err == nil; tc.out != result {
+				t.Fatalf("got: %v, wanted: %v", result, tc.out)
+			}
+		})
+	}
+}
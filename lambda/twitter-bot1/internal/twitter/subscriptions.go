@@ -0,0 +1,67 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// SubscriptionsURL format of the Account Activity API subscription of a user
+// in an environment
+const SubscriptionsURL = "https://api.twitter.com/1.1/account_activity/all/%s/subscriptions/%s.json"
+
+// bearerTransport authenticates requests with an app-only bearer token
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+// NewAppClient returns a client authenticating as the app itself with
+// bearerToken. It is needed for requests about users who have revoked the
+// app's access to their account.
+func NewAppClient(bearerToken string) *http.Client {
+	return &http.Client{
+		Transport: &bearerTransport{token: bearerToken, base: http.DefaultTransport},
+	}
+}
+
+// Unsubscribe stops webhook deliveries for userID in the Account Activity
+// environment envName. client must be an app client, see NewAppClient. A
+// user that is not subscribed is not an error. Failed requests return an
+// *APIError.
+func Unsubscribe(ctx context.Context, client *http.Client, envName string, userID string) error {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(SubscriptionsURL, envName, userID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return &APIError{Kind: ErrorTransport, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{Kind: ErrorTransport, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return newAPIError(resp, body)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package twitter
+
+type (
+	// WebhookPayload body of an Account Activity API webhook delivery
+	WebhookPayload struct {
+		ForUserID                         string                `json:"for_user_id"`
+		DirectMessageEvents               []DirectMessageEvent  `json:"direct_message_events,omitempty"`
+		DirectMessageIndicateTypingEvents []IndicateTypingEvent `json:"direct_message_indicate_typing_events,omitempty"`
+		DirectMessageMarkReadEvents       []MarkReadEvent       `json:"direct_message_mark_read_events,omitempty"`
+		FollowEvents                      []UserActionEvent     `json:"follow_events,omitempty"`
+		BlockEvents                       []UserActionEvent     `json:"block_events,omitempty"`
+		MuteEvents                        []UserActionEvent     `json:"mute_events,omitempty"`
+		FavoriteEvents                    []FavoriteEvent       `json:"favorite_events,omitempty"`
+		TweetCreateEvents                 []Tweet               `json:"tweet_create_events,omitempty"`
+		TweetDeleteEvents                 []TweetDeleteEvent    `json:"tweet_delete_events,omitempty"`
+		UserEvent                         *UserEvent            `json:"user_event,omitempty"`
+	}
+	// DirectMessageEvent ..
+	DirectMessageEvent struct {
+		Type            string        `json:"type"`
+		ID              string        `json:"id"`
+		CreateTimestamp string        `json:"created_timestamp"`
+		MessageCreate   MessageCreate `json:"message_create"`
+	}
+	// MessageCreate ..
+	MessageCreate struct {
+		SenderID    string      `json:"sender_id"`
+		Target      Target      `json:"target"`
+		MessageData MessageData `json:"message_data"`
+	}
+	// Target ..
+	Target struct {
+		RecipientID string `json:"recipient_id"`
+	}
+	// MessageData ..
+	MessageData struct {
+		Text               string              `json:"text"`
+		Entities           struct{}            `json:"entities"`
+		Attachment         Attachment          `json:"attachment"`
+		QuickReplyResponse *QuickReplyResponse `json:"quick_reply_response,omitempty"`
+	}
+	// QuickReplyResponse set when the message is the answer to a quick reply
+	// option, Metadata is the metadata of the chosen option.
+	QuickReplyResponse struct {
+		Type     string `json:"type"`
+		Metadata string `json:"metadata"`
+	}
+	// Attachment ..
+	Attachment struct {
+		Type  string `json:"type"`
+		Media Media  `json:"media"`
+	}
+	// Media ..
+	Media struct {
+		ID         int64  `json:"id"`
+		MediaURL   string `json:"media_url"`
+		URL        string `json:"url"`
+		DisplayURL string `json:"display_url"`
+	}
+	// IndicateTypingEvent ..
+	IndicateTypingEvent struct {
+		CreateTimestamp string `json:"created_timestamp"`
+		SenderID        string `json:"sender_id"`
+		Target          Target `json:"target"`
+	}
+	// MarkReadEvent the recipient read the direct messages up to
+	// LastReadEventID
+	MarkReadEvent struct {
+		CreateTimestamp string `json:"created_timestamp"`
+		SenderID        string `json:"sender_id"`
+		Target          Target `json:"target"`
+		LastReadEventID string `json:"last_read_event_id"`
+	}
+	// UserActionEvent follow, unfollow, block, unblock, mute and unmute
+	// events, Type tells which
+	UserActionEvent struct {
+		Type            string `json:"type"`
+		CreateTimestamp string `json:"created_timestamp"`
+		Target          User   `json:"target"`
+		Source          User   `json:"source"`
+	}
+	// User ..
+	User struct {
+		ID         string `json:"id"`
+		ScreenName string `json:"screen_name"`
+		Name       string `json:"name"`
+	}
+	// FavoriteEvent a tweet was liked
+	FavoriteEvent struct {
+		ID              string  `json:"id"`
+		TimestampMs     int64   `json:"timestamp_ms"`
+		FavoritedStatus Tweet   `json:"favorited_status"`
+		User            Tweeter `json:"user"`
+	}
+	// Tweet the fields of a tweet the bot uses
+	Tweet struct {
+		IDStr       string  `json:"id_str"`
+		TimestampMs string  `json:"timestamp_ms"`
+		User        Tweeter `json:"user"`
+	}
+	// Tweeter user object embedded in tweets and favorites
+	Tweeter struct {
+		IDStr      string `json:"id_str"`
+		ScreenName string `json:"screen_name"`
+	}
+	// TweetDeleteEvent ..
+	TweetDeleteEvent struct {
+		Status struct {
+			ID     string `json:"id"`
+			UserID string `json:"user_id"`
+		} `json:"status"`
+		TimestampMs string `json:"timestamp_ms"`
+	}
+	// UserEvent account level events, Revoke is set when the user revoked
+	// the app's access
+	UserEvent struct {
+		Revoke *Revoke `json:"revoke,omitempty"`
+	}
+	// Revoke ..
+	Revoke struct {
+		DateTime string `json:"date_time"`
+		Target   struct {
+			AppID string `json:"app_id"`
+		} `json:"target"`
+		Source struct {
+			UserID string `json:"user_id"`
+		} `json:"source"`
+	}
+)
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// Activity kinds of the Account Activity API besides direct messages, which
+// are published as Event
+const (
+	KindTyping      = "typing"
+	KindRead        = "read"
+	KindFollow      = "follow"
+	KindUnfollow    = "unfollow"
+	KindFavorite    = "favorite"
+	KindBlock       = "block"
+	KindUnblock     = "unblock"
+	KindMute        = "mute"
+	KindUnmute      = "unmute"
+	KindRevoke      = "revoke"
+	KindTweetCreate = "tweet_create"
+	KindTweetDelete = "tweet_delete"
+)
+
+// Kinds all activity kinds
+var Kinds = []string{
+	KindTyping, KindRead, KindFollow, KindUnfollow, KindFavorite, KindBlock,
+	KindUnblock, KindMute, KindUnmute, KindRevoke, KindTweetCreate, KindTweetDelete,
+}
+
+// Activity an account activity other than a direct message
+type Activity struct {
+	Kind      string `json:"kind"`
+	RequestID string `json:"request-id"`
+	ForUserID string `json:"for-user-id"`
+	// SourceID the user who did something, e.g. the follower
+	SourceID string `json:"source_id"`
+	// SourceScreenName screen name of the source, when twitter includes it
+	SourceScreenName string `json:"source_screen_name,omitempty"`
+	// TargetID the user it was done to, e.g. the followed user
+	TargetID string `json:"target_id,omitempty"`
+	// ObjectID the tweet or direct message event involved, if any
+	ObjectID        string `json:"object_id,omitempty"`
+	CreateTimestamp int64  `json:"create_timestamp"`
+}
+
+// Own is true when the subscribed account itself did it, e.g. the bot's own
+// typing indicator echoed back by twitter.
+func (a Activity) Own() bool {
+	return a.SourceID == a.ForUserID
+}
+
+// ActivityHandler handles one kind of activity
+type ActivityHandler interface {
+	HandleActivity(ctx context.Context, activity Activity) error
+}
+
+// ActivityHandlerFunc adapts a function to ActivityHandler
+type ActivityHandlerFunc func(ctx context.Context, activity Activity) error
+
+// HandleActivity implements ActivityHandler.
+func (f ActivityHandlerFunc) HandleActivity(ctx context.Context, activity Activity) error {
+	return f(ctx, activity)
+}
+
+// ParseRoutes parses routes such as "follow=welcome,typing=log" into the
+// handler of each kind, handler names are looked up in handlers. Kinds
+// without a route are dropped.
+func ParseRoutes(routes string, handlers map[string]ActivityHandler) (map[string]ActivityHandler, error) {
+	out := make(map[string]ActivityHandler)
+	for _, route := range strings.Split(routes, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("activity route %q is not kind=handler", route)
+		}
+		kind, name := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !knownKind(kind) {
+			return nil, fmt.Errorf("unknown activity kind %q", kind)
+		}
+		h, ok := handlers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown activity handler %q", name)
+		}
+		out[kind] = h
+	}
+	return out, nil
+}
+
+func knownKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// NewActivities classifies everything in payload except direct messages.
+func NewActivities(requestID string, payload twitter.WebhookPayload) []Activity {
+	activities := make([]Activity, 0)
+	add := func(a Activity) {
+		a.RequestID = requestID
+		a.ForUserID = payload.ForUserID
+		activities = append(activities, a)
+	}
+
+	for _, e := range payload.DirectMessageIndicateTypingEvents {
+		add(Activity{Kind: KindTyping, SourceID: e.SenderID, TargetID: e.Target.RecipientID, CreateTimestamp: parseTimestamp(e.CreateTimestamp)})
+	}
+	for _, e := range payload.DirectMessageMarkReadEvents {
+		add(Activity{Kind: KindRead, SourceID: e.SenderID, TargetID: e.Target.RecipientID, ObjectID: e.LastReadEventID, CreateTimestamp: parseTimestamp(e.CreateTimestamp)})
+	}
+	for _, events := range [][]twitter.UserActionEvent{payload.FollowEvents, payload.BlockEvents, payload.MuteEvents} {
+		for _, e := range events {
+			add(Activity{Kind: e.Type, SourceID: e.Source.ID, SourceScreenName: e.Source.ScreenName, TargetID: e.Target.ID, CreateTimestamp: parseTimestamp(e.CreateTimestamp)})
+		}
+	}
+	for _, e := range payload.FavoriteEvents {
+		add(Activity{Kind: KindFavorite, SourceID: e.User.IDStr, SourceScreenName: e.User.ScreenName, TargetID: e.FavoritedStatus.User.IDStr, ObjectID: e.FavoritedStatus.IDStr, CreateTimestamp: e.TimestampMs})
+	}
+	for _, e := range payload.TweetCreateEvents {
+		add(Activity{Kind: KindTweetCreate, SourceID: e.User.IDStr, ObjectID: e.IDStr, CreateTimestamp: parseTimestamp(e.TimestampMs)})
+	}
+	for _, e := range payload.TweetDeleteEvents {
+		add(Activity{Kind: KindTweetDelete, SourceID: e.Status.UserID, ObjectID: e.Status.ID, CreateTimestamp: parseTimestamp(e.TimestampMs)})
+	}
+	if payload.UserEvent != nil && payload.UserEvent.Revoke != nil {
+		r := payload.UserEvent.Revoke
+		a := Activity{Kind: KindRevoke, SourceID: r.Source.UserID, ObjectID: r.Target.AppID}
+		if revokedAt, err := time.Parse(time.RFC3339, r.DateTime); err == nil {
+			a.CreateTimestamp = revokedAt.UnixNano() / int64(time.Millisecond)
+		}
+		add(a)
+	}
+	return activities
+}
+
+// parseTimestamp parses twitter's millisecond timestamps, 0 when invalid.
+func parseTimestamp(s string) int64 {
+	ms, _ := strconv.ParseInt(s, 10, 64)
+	return ms
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+const activityPayload = `{
+  "for_user_id": "4337869213",
+  "direct_message_indicate_typing_events": [
+    {"created_timestamp": "1518127183443", "sender_id": "3805104374", "target": {"recipient_id": "4337869213"}},
+    {"created_timestamp": "1518127183444", "sender_id": "4337869213", "target": {"recipient_id": "3805104374"}}
+  ],
+  "direct_message_mark_read_events": [
+    {"created_timestamp": "1518452444662", "sender_id": "3805104374", "target": {"recipient_id": "4337869213"}, "last_read_event_id": "963085315333238788"}
+  ],
+  "follow_events": [
+    {"type": "follow", "created_timestamp": "1517588749178", "target": {"id": "4337869213"}, "source": {"id": "3805104374"}},
+    {"type": "unfollow", "created_timestamp": "1517588749179", "target": {"id": "4337869213"}, "source": {"id": "3805104374"}}
+  ],
+  "block_events": [
+    {"type": "block", "created_timestamp": "1518127020304", "target": {"id": "4337869213"}, "source": {"id": "3805104374"}}
+  ],
+  "mute_events": [
+    {"type": "unmute", "created_timestamp": "1518127020305", "target": {"id": "4337869213"}, "source": {"id": "3805104374"}}
+  ],
+  "favorite_events": [
+    {"id": "a7ba59eab0bfcba386f7acedac279542", "timestamp_ms": 1517597014233, "favorited_status": {"id_str": "959174811231547392", "user": {"id_str": "4337869213"}}, "user": {"id_str": "3805104374"}}
+  ],
+  "tweet_delete_events": [
+    {"status": {"id": "601430178305220608", "user_id": "3805104374"}, "timestamp_ms": "1432228155593"}
+  ],
+  "user_event": {
+    "revoke": {"date_time": "2018-05-24T09:48:12+00:00", "target": {"app_id": "13090192"}, "source": {"user_id": "3805104374"}}
+  }
+}`
+
+func TestNewActivities(t *testing.T) {
+	var payload twitter.WebhookPayload
+	if err := json.Unmarshal([]byte(activityPayload), &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+
+	got := NewActivities("req-1", payload)
+
+	want := []struct {
+		kind     string
+		source   string
+		objectID string
+		own      bool
+	}{
+		{kind: KindTyping, source: "3805104374"},
+		{kind: KindTyping, source: "4337869213", own: true},
+		{kind: KindRead, source: "3805104374", objectID: "963085315333238788"},
+		{kind: KindFollow, source: "3805104374"},
+		{kind: KindUnfollow, source: "3805104374"},
+		{kind: KindBlock, source: "3805104374"},
+		{kind: KindUnmute, source: "3805104374"},
+		{kind: KindFavorite, source: "3805104374", objectID: "959174811231547392"},
+		{kind: KindTweetDelete, source: "3805104374", objectID: "601430178305220608"},
+		{kind: KindRevoke, source: "3805104374", objectID: "13090192"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got: %v activities, wanted: %v", len(got), len(want))
+	}
+	for i, w := range want {
+		a := got[i]
+		if a.Kind != w.kind || a.SourceID != w.source || a.ObjectID != w.objectID || a.Own() != w.own {
+			t.Fatalf("got: %+v, wanted: %+v", a, w)
+		}
+		if a.RequestID != "req-1" || a.ForUserID != "4337869213" {
+			t.Fatalf("got: %+v, wanted request req-1 for 4337869213", a)
+		}
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	log := ActivityHandlerFunc(func(ctx context.Context, a Activity) error { return nil })
+	handlers := map[string]ActivityHandler{"log": log}
+
+	tt := []struct {
+		name   string
+		routes string
+		kinds  int
+		err    bool
+	}{
+		{name: "empty", routes: "", kinds: 0},
+		{name: "routes", routes: "follow=log, typing = log,", kinds: 2},
+		{name: "unknownKind", routes: "poke=log", err: true},
+		{name: "unknownHandler", routes: "follow=welcome", err: true},
+		{name: "malformed", routes: "follow", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			routes, err := ParseRoutes(tc.routes, handlers)
+			if (err != nil) != tc.err {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.err)
+			}
+			if err == nil && len(routes) != tc.kinds {
+				t.Fatalf("got: %v routes, wanted: %v", len(routes), tc.kinds)
+			}
+		})
+	}
+}
+
+func TestRouteActivities(t *testing.T) {
+	tt := []struct {
+		name       string
+		handlerErr error
+		status     int
+		handled    int
+		dropped    int
+	}{
+		{name: "routed", status: 200, handled: 2, dropped: 8},
+		{name: "handlerFailure", handlerErr: fmt.Errorf("boom"), status: 500, handled: 1, dropped: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handled := 0
+			dropped := 0
+			h := NewHandler("s", &recordingSink{})
+			h.Route(KindTyping, ActivityHandlerFunc(func(ctx context.Context, a Activity) error {
+				handled++
+				return tc.handlerErr
+			}))
+			h.Route(KindFollow, ActivityHandlerFunc(func(ctx context.Context, a Activity) error {
+				handled++
+				return tc.handlerErr
+			}))
+			h.OnDrop(func(a Activity) { dropped++ })
+
+			req := httptest.NewRequest(http.MethodPost, "/twitter", strings.NewReader(activityPayload))
+			req.Header.Set(SignatureHeader, sign("s", activityPayload))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status: %v, wanted: %v", rec.Code, tc.status)
+			}
+			if handled != tc.handled || dropped != tc.dropped {
+				t.Fatalf("got: %v handled %v dropped, wanted: %v handled %v dropped", handled, dropped, tc.handled, tc.dropped)
+			}
+		})
+	}
+}
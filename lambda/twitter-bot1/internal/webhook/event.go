@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+type (
+	// DirectMessageEvent normalized direct message handed to the pipeline
+	DirectMessageEvent struct {
+		ID              string `json:"id"`
+		CreateTimestamp int64  `json:"create_timestamp"`
+		MediaID         string `json:"mediaID"`
+		MediaURL        string `json:"media_url"`
+		URL             string `json:"url"`
+		MessageText     string `json:"message_text"`
+		SenderID        string `json:"sender_id"`
+		Text            string `json:"text"`
+		// QuickReplyMetadata metadata of the quick reply option the sender
+		// chose, empty for ordinary messages
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
+	}
+	// Event to send between step functions
+	Event struct {
+		RequestID           string               `json:"request-id"`
+		ForUserID           string               `json:"for-user-id"`
+		DirectMessageEvents []DirectMessageEvent `json:"direct-message-events"`
+		PictureExists       bool                 `json:"picture-exists"`
+		// Trace traceparent of the webhook delivery, continued by each state
+		Trace string `json:"trace,omitempty"`
+	}
+)
+
+// NewEvent normalizes a webhook payload into an Event. Direct messages sent by
+// the subscribed account itself are dropped, twitter echoes the bot's own
+// replies back to the webhook and they must not be processed again.
+func NewEvent(requestID string, payload twitter.WebhookPayload) (Event, error) {
+	directMessageEvents := make([]DirectMessageEvent, 0)
+	pictureExists := false
+	for _, v := range payload.DirectMessageEvents {
+		if v.MessageCreate.SenderID == payload.ForUserID {
+			continue
+		}
+		if v.MessageCreate.MessageData.Attachment.Media.MediaURL != "" {
+			pictureExists = true
+		}
+
+		createTime, err := strconv.ParseInt(v.CreateTimestamp, 10, 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("direct message %s has invalid created_timestamp %q", v.ID, v.CreateTimestamp)
+		}
+
+		d := DirectMessageEvent{
+			ID:              v.ID,
+			CreateTimestamp: createTime,
+			MediaID:         strconv.FormatInt(v.MessageCreate.MessageData.Attachment.Media.ID, 10),
+			URL:             v.MessageCreate.MessageData.Attachment.Media.URL,
+			MediaURL:        v.MessageCreate.MessageData.Attachment.Media.MediaURL,
+			Text:            v.MessageCreate.MessageData.Text,
+			SenderID:        v.MessageCreate.SenderID,
+		}
+		if qr := v.MessageCreate.MessageData.QuickReplyResponse; qr != nil {
+			d.QuickReplyMetadata = qr.Metadata
+		}
+		directMessageEvents = append(directMessageEvents, d)
+	}
+
+	return Event{
+		RequestID:           requestID,
+		ForUserID:           payload.ForUserID,
+		DirectMessageEvents: directMessageEvents,
+		PictureExists:       pictureExists,
+	}, nil
+}
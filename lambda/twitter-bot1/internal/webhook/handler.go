@@ -0,0 +1,276 @@
+// Package webhook implements the twitter Account Activity API webhook. The same
+// Handler answers API Gateway proxy requests when running as a lambda and plain
+// net/http requests when the bot is self-hosted.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// SignatureHeader header twitter signs webhook deliveries with
+const SignatureHeader = "X-Twitter-Webhooks-Signature"
+
+// maxBodySize upper bound for a webhook delivery read by ServeHTTP
+const maxBodySize = 1 << 20
+
+// EventSink receives normalized events from verified webhook deliveries
+type EventSink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Handler serves the webhook. GET requests answer the CRC challenge, POST
+// requests are verified, normalized and published to the EventSink. Other
+// account activities go to the ActivityHandler routed for their kind, or are
+// dropped.
+type Handler struct {
+	consumerSecret string
+	sink           EventSink
+	routes         map[string]ActivityHandler
+	dropped        func(Activity)
+	metrics        metrics.Recorder
+}
+
+type (
+	request struct {
+		method    string
+		crcToken  string
+		signature string
+		body      []byte
+		requestID string
+	}
+	response struct {
+		statusCode  int
+		contentType string
+		body        string
+	}
+	crcResponse struct {
+		ResponseToken string `json:"response_token"`
+	}
+)
+
+// NewHandler returns a Handler verifying deliveries with consumerSecret and
+// publishing them to sink.
+func NewHandler(consumerSecret string, sink EventSink) *Handler {
+	return &Handler{
+		consumerSecret: consumerSecret,
+		sink:           sink,
+		routes:         make(map[string]ActivityHandler),
+		dropped:        func(Activity) {},
+		metrics:        metrics.Nop{},
+	}
+}
+
+// Route sends activities of kind to ah.
+func (h *Handler) Route(kind string, ah ActivityHandler) {
+	h.routes[kind] = ah
+}
+
+// OnDrop sets f to be called with every activity that is dropped, either
+// because nothing is routed for its kind or because the subscribed account
+// did it itself.
+func (h *Handler) OnDrop(f func(Activity)) {
+	h.dropped = f
+}
+
+// Metrics sets r to record EventsReceived, EventsRejected per Reason and
+// DroppedActivity per Kind.
+func (h *Handler) Metrics(r metrics.Recorder) {
+	h.metrics = r
+}
+
+// ServeLambda handles an API Gateway proxy request.
+func (h *Handler) ServeLambda(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				Body:       "bad body encoding\n",
+				StatusCode: http.StatusBadRequest,
+			}, nil
+		}
+		body = decoded
+	}
+
+	resp := h.handle(ctx, request{
+		method:    req.HTTPMethod,
+		crcToken:  req.QueryStringParameters["crc_token"],
+		signature: headerValue(req.Headers, SignatureHeader),
+		body:      body,
+		requestID: req.RequestContext.RequestID,
+	})
+
+	r := events.APIGatewayProxyResponse{
+		Body:       resp.body,
+		StatusCode: resp.statusCode,
+	}
+	if resp.contentType != "" {
+		r.Headers = map[string]string{"Content-Type": resp.contentType}
+	}
+	return r, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	resp := h.handle(r.Context(), request{
+		method:    r.Method,
+		crcToken:  r.URL.Query().Get("crc_token"),
+		signature: r.Header.Get(SignatureHeader),
+		body:      body,
+		requestID: requestID,
+	})
+
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	w.WriteHeader(resp.statusCode)
+	fmt.Fprint(w, resp.body)
+}
+
+func (h *Handler) handle(ctx context.Context, req request) response {
+	ctx = logging.NewContext(ctx, logging.FromContext(ctx).WithRequest(req.requestID))
+	switch req.method {
+	case http.MethodGet:
+		return h.crcCheck(req)
+	case http.MethodPost:
+		return h.deliver(ctx, req)
+	}
+	return response{
+		statusCode: http.StatusMethodNotAllowed,
+	}
+}
+
+func (h *Handler) crcCheck(req request) response {
+	if req.crcToken == "" {
+		return response{
+			statusCode: http.StatusBadRequest,
+			body:       "missing crc_token\n",
+		}
+	}
+	respCrcToken, err := json.Marshal(crcResponse{
+		ResponseToken: twitter.CRCResponseToken(h.consumerSecret, req.crcToken),
+	})
+	if err != nil {
+		return response{statusCode: http.StatusInternalServerError}
+	}
+	return response{
+		statusCode:  http.StatusOK,
+		contentType: "application/json",
+		body:        string(respCrcToken),
+	}
+}
+
+func (h *Handler) deliver(ctx context.Context, req request) response {
+	metrics.Count(h.metrics, metrics.EventsReceived, 1)
+	if err := twitter.VerifySignature(h.consumerSecret, req.signature, req.body); err != nil {
+		logging.FromContext(ctx).Warn("rejected webhook delivery", "error", err)
+		metrics.Count(h.metrics, metrics.EventsRejected, 1, "Reason", "signature")
+		return response{
+			statusCode: http.StatusBadRequest,
+			body:       "bad crc\n",
+		}
+	}
+
+	var payload twitter.WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		logging.FromContext(ctx).Warn("failed to unmarshal webhook payload", "error", err)
+		metrics.Count(h.metrics, metrics.EventsRejected, 1, "Reason", "payload")
+		return response{
+			statusCode: http.StatusBadRequest,
+			body:       "bad payload\n",
+		}
+	}
+
+	event, err := NewEvent(req.requestID, payload)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to normalize webhook payload", "error", err)
+		metrics.Count(h.metrics, metrics.EventsRejected, 1, "Reason", "payload")
+		return response{
+			statusCode: http.StatusBadRequest,
+			body:       "bad payload\n",
+		}
+	}
+
+	// activities are routed first, their handlers tolerate a redelivery; a
+	// failure after the direct messages are published would have twitter
+	// redeliver them and the sender answered twice
+	if err := h.route(ctx, NewActivities(req.requestID, payload)); err != nil {
+		logging.FromContext(ctx).Error("failed to handle activity", "error", err)
+		return response{statusCode: http.StatusInternalServerError}
+	}
+
+	if len(event.DirectMessageEvents) > 0 {
+		event.Trace = trace.Traceparent(ctx)
+		if err := h.sink.Publish(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("failed to publish event", "error", err)
+			return response{statusCode: http.StatusInternalServerError}
+		}
+	}
+	return response{statusCode: http.StatusOK}
+}
+
+// route hands every activity to the handler routed for its kind. It stops at
+// the first error so twitter redelivers, handlers must tolerate seeing an
+// activity again. Revocations are always made by the subscribed account
+// itself and are the only own activities routed.
+func (h *Handler) route(ctx context.Context, activities []Activity) error {
+	for _, a := range activities {
+		ah, ok := h.routes[a.Kind]
+		if !ok || (a.Own() && a.Kind != KindRevoke) {
+			metrics.Count(h.metrics, metrics.DroppedActivity, 1, "Kind", a.Kind)
+			h.dropped(a)
+			continue
+		}
+		if err := ah.HandleActivity(ctx, a); err != nil {
+			return fmt.Errorf("%s activity: %v", a.Kind, err)
+		}
+	}
+	return nil
+}
+
+// headerValue looks up name in headers ignoring case, API Gateway passes
+// headers through with whatever casing the client used.
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
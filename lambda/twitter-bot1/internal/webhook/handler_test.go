@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+type recordingSink struct {
+	events []Event
+	err    error
+}
+
+func (s *recordingSink) Publish(ctx context.Context, event Event) error {
+	s.events = append(s.events, event)
+	return s.err
+}
+
+const testPayload = `{
+  "for_user_id": "4337869213",
+  "direct_message_events": [
+    {
+      "type": "message_create",
+      "id": "954491830116155396",
+      "created_timestamp": "1516403560557",
+      "message_create": {
+        "sender_id": "3805104374",
+        "message_data": {
+          "text": "look",
+          "attachment": {
+            "type": "media",
+            "media": {"id": 954491820305735680, "media_url": "https://ton.twitter.com/1.1/ton/data/dm/1/2/abc.jpg"}
+          }
+        }
+      }
+    },
+    {
+      "type": "message_create",
+      "id": "954491830116155398",
+      "created_timestamp": "1516403560580",
+      "message_create": {
+        "sender_id": "3805104374",
+        "message_data": {
+          "text": "Blur faces",
+          "quick_reply_response": {"type": "options", "metadata": "blur-faces"}
+        }
+      }
+    },
+    {
+      "type": "message_create",
+      "id": "954491830116155397",
+      "created_timestamp": "1516403560600",
+      "message_create": {
+        "sender_id": "4337869213",
+        "message_data": {"text": "face:0"}
+      }
+    }
+  ]
+}`
+
+// sign returns the X-Twitter-Webhooks-Signature for body, it is the same
+// HMAC as the CRC response token.
+func sign(secret string, body string) string {
+	return twitter.CRCResponseToken(secret, body)
+}
+
+func TestServeHTTP(t *testing.T) {
+	secret := "bbbbbb"
+	tt := []struct {
+		name      string
+		method    string
+		target    string
+		signature string
+		body      string
+		sinkErr   error
+		status    int
+		published int
+		rejected  float64
+	}{
+		{
+			name:   "crcCheck",
+			method: "GET",
+			target: "/twitter?crc_token=helloWorld",
+			status: 200,
+		},
+		{
+			name:   "crcCheckMissingToken",
+			method: "GET",
+			target: "/twitter",
+			status: 400,
+		},
+		{
+			name:      "validDelivery",
+			method:    "POST",
+			target:    "/twitter",
+			signature: sign(secret, testPayload),
+			body:      testPayload,
+			status:    200,
+			published: 1,
+		},
+		{
+			name:      "badSignature",
+			method:    "POST",
+			target:    "/twitter",
+			signature: "sha256=P/M6xYi2AxkjB8C36xD3AfjT5XuOx3dWgw9EVXCYA2U=",
+			body:      testPayload,
+			status:    400,
+			rejected:  1,
+		},
+		{
+			name:      "noDirectMessages",
+			method:    "POST",
+			target:    "/twitter",
+			signature: sign(secret, `{"for_user_id":"1"}`),
+			body:      `{"for_user_id":"1"}`,
+			status:    200,
+		},
+		{
+			name:      "sinkFailure",
+			method:    "POST",
+			target:    "/twitter",
+			signature: sign(secret, testPayload),
+			body:      testPayload,
+			sinkErr:   fmt.Errorf("boom"),
+			status:    500,
+			published: 1,
+		},
+		{
+			name:   "unsupportedMethod",
+			method: "PUT",
+			target: "/twitter",
+			status: 405,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &recordingSink{err: tc.sinkErr}
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.signature != "" {
+				req.Header.Set(SignatureHeader, tc.signature)
+			}
+			rec := httptest.NewRecorder()
+			recorder := metrics.NewMemory()
+
+			h := NewHandler(secret, sink)
+			h.Metrics(recorder)
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status: %v, wanted: %v", rec.Code, tc.status)
+			}
+			if len(sink.events) != tc.published {
+				t.Fatalf("got: %v published events, wanted: %v", len(sink.events), tc.published)
+			}
+			if got := recorder.Sum(metrics.EventsRejected, "Reason", "signature"); got != tc.rejected {
+				t.Fatalf("got: %v rejected events, wanted: %v", got, tc.rejected)
+			}
+		})
+	}
+}
+
+func TestNewEventSkipsOwnMessages(t *testing.T) {
+	sink := &recordingSink{}
+	req := httptest.NewRequest(http.MethodPost, "/twitter", strings.NewReader(testPayload))
+	req.Header.Set(SignatureHeader, sign("s", testPayload))
+	req.Header.Set("X-Request-Id", "req-1")
+
+	NewHandler("s", sink).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("got: %v published events, wanted: 1", len(sink.events))
+	}
+	e := sink.events[0]
+	if e.RequestID != "req-1" {
+		t.Fatalf("got request id: %v, wanted: req-1", e.RequestID)
+	}
+	if !e.PictureExists {
+		t.Fatalf("got picture-exists false, wanted true")
+	}
+	if len(e.DirectMessageEvents) != 2 || e.DirectMessageEvents[0].SenderID != "3805104374" || e.DirectMessageEvents[1].SenderID != "3805104374" {
+		t.Fatalf("got: %+v, wanted only the messages from 3805104374", e.DirectMessageEvents)
+	}
+	if e.DirectMessageEvents[1].QuickReplyMetadata != "blur-faces" {
+		t.Fatalf("got quick reply metadata: %v, wanted: blur-faces", e.DirectMessageEvents[1].QuickReplyMetadata)
+	}
+	if e.DirectMessageEvents[0].MediaID != "954491820305735680" {
+		t.Fatalf("got media id: %v, wanted: 954491820305735680", e.DirectMessageEvents[0].MediaID)
+	}
+}
+
+func TestDeliverRoutesBeforePublishing(t *testing.T) {
+	payload := `{
+  "for_user_id": "4337869213",
+  "follow_events": [
+    {"type": "follow", "created_timestamp": "1517588749178", "target": {"id": "4337869213"}, "source": {"id": "3805104374"}}
+  ],
+  "direct_message_events": [
+    {
+      "type": "message_create",
+      "id": "954491830116155396",
+      "created_timestamp": "1516403560557",
+      "message_create": {"sender_id": "3805104374", "message_data": {"text": "hi"}}
+    }
+  ]
+}`
+
+	tt := []struct {
+		name      string
+		routeErr  error
+		status    int
+		published int
+	}{
+		{name: "delivered", status: 200, published: 1},
+		// twitter redelivers, the messages must not be published yet
+		{name: "routeFailure", routeErr: fmt.Errorf("boom"), status: 500, published: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			h := NewHandler("s", sink)
+			h.Route(KindFollow, ActivityHandlerFunc(func(ctx context.Context, a Activity) error {
+				return tc.routeErr
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/twitter", strings.NewReader(payload))
+			req.Header.Set(SignatureHeader, sign("s", payload))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status || len(sink.events) != tc.published {
+				t.Fatalf("got: %v status %v published, wanted: %v %v", rec.Code, len(sink.events), tc.status, tc.published)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package welcome
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBStore keeps one item per welcomed user in a table with the string
+// partition key account_id and the string sort key user_id. The conditional
+// put makes Claim safe against
+// concurrent deliveries of the same follow event.
+type DynamoDBStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDBStore returns a store using table.
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client: client,
+		table:  table,
+	}
+}
+
+// Claim implements Store.
+func (d *DynamoDBStore) Claim(ctx context.Context, accountID string, userID string) (bool, error) {
+	_, err := d.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"account_id":  {S: aws.String(accountID)},
+			"user_id":     {S: aws.String(userID)},
+			"welcomed_at": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(user_id)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim welcome: %v", err)
+	}
+	return true, nil
+}
+
+// Release implements Store.
+func (d *DynamoDBStore) Release(ctx context.Context, accountID string, userID string) error {
+	_, err := d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"account_id": {S: aws.String(accountID)},
+			"user_id":    {S: aws.String(userID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("release welcome: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package welcome
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps welcomed users in memory. It is used for tests and when
+// the bot is self-hosted without DynamoDB.
+type MemoryStore struct {
+	mu       sync.Mutex
+	welcomed map[string]time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		welcomed: make(map[string]time.Time),
+	}
+}
+
+// Claim implements Store.
+func (m *MemoryStore) Claim(ctx context.Context, accountID string, userID string) (bool, error) {
+	key := accountID + "/" + userID
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.welcomed[key]; ok {
+		return false, nil
+	}
+	m.welcomed[key] = time.Now()
+	return true, nil
+}
+
+// Release implements Store.
+func (m *MemoryStore) Release(ctx context.Context, accountID string, userID string) error {
+	m.mu.Lock()
+	delete(m.welcomed, accountID+"/"+userID)
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,102 @@
+// Package welcome sends new followers of a bot account a direct message
+// explaining what it does. Every user is welcomed at most once per account,
+// the users already welcomed are kept in a Store.
+package welcome
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+// Store records the users that have been welcomed by each account
+type Store interface {
+	// Claim records userID as welcomed by accountID. It returns false when
+	// userID was already recorded, i.e. the user has been or is being
+	// welcomed.
+	Claim(ctx context.Context, accountID string, userID string) (bool, error)
+	// Release forgets userID so the user can be welcomed again, used when
+	// sending the welcome failed after the claim.
+	Release(ctx context.Context, accountID string, userID string) error
+}
+
+// SendFunc sends text as a direct message from accountID to recipientID
+type SendFunc func(ctx context.Context, accountID string, recipientID string, text string) error
+
+// Welcomer welcomes new followers. It implements webhook.ActivityHandler for
+// follow activities.
+type Welcomer struct {
+	store    Store
+	accounts account.Registry
+	renderer *reply.Renderer
+	send     SendFunc
+}
+
+// New returns a Welcomer rendering reply.TemplateWelcome with renderer, or
+// the account's own template, and sending it with send.
+func New(store Store, accounts account.Registry, renderer *reply.Renderer, send SendFunc) *Welcomer {
+	return &Welcomer{
+		store:    store,
+		accounts: accounts,
+		renderer: renderer,
+		send:     send,
+	}
+}
+
+// HandleActivity implements webhook.ActivityHandler. Only users following the
+// subscribed account are welcomed, follows by the account itself are ignored.
+func (w *Welcomer) HandleActivity(ctx context.Context, activity webhook.Activity) error {
+	if activity.Kind != webhook.KindFollow || activity.TargetID != activity.ForUserID || activity.Own() {
+		return nil
+	}
+	return w.Welcome(ctx, activity.ForUserID, activity.SourceID, activity.SourceScreenName)
+}
+
+// Welcome sends the welcome message of accountID to userID unless it has been
+// sent before. The claim is released when sending fails so a redelivered
+// follow event tries again, unless twitter refused the message for good, e.g.
+// the user does not accept direct messages.
+func (w *Welcomer) Welcome(ctx context.Context, accountID string, userID string, screenName string) error {
+	acct, err := w.accounts.Get(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	renderer, err := w.renderer.With(acct.Templates)
+	if err != nil {
+		return err
+	}
+
+	claimed, err := w.store.Claim(ctx, accountID, userID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	text, err := renderer.Render(conversation.DefaultLanguage, reply.TemplateWelcome, reply.WelcomeData{ScreenName: screenName})
+	if err == nil {
+		for _, part := range renderer.Fit(text) {
+			if err = w.send(ctx, accountID, userID, part); err != nil {
+				break
+			}
+		}
+	}
+	if apiErr, ok := err.(*twitter.APIError); ok && !apiErr.Retryable() {
+		logging.FromContext(ctx).Warn("welcome not sent", logging.FieldSenderHash, logging.SenderHash(userID), "error", err)
+		return nil
+	}
+	if err != nil {
+		if rerr := w.store.Release(ctx, accountID, userID); rerr != nil {
+			logging.FromContext(ctx).Error("failed to release welcome", logging.FieldSenderHash, logging.SenderHash(userID), "error", rerr)
+		}
+		return fmt.Errorf("welcome %s: %v", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package welcome
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+)
+
+func TestHandleActivity(t *testing.T) {
+	follow := webhook.Activity{Kind: webhook.KindFollow, ForUserID: "bot", SourceID: "u1", SourceScreenName: "alice", TargetID: "bot"}
+
+	tt := []struct {
+		name       string
+		activities []webhook.Activity
+		sendErr    error
+		err        bool
+		sent       int
+	}{
+		{name: "follow", activities: []webhook.Activity{follow}, sent: 1},
+		{name: "onlyOnce", activities: []webhook.Activity{follow, follow}, sent: 1},
+		{
+			name: "botFollowsSomeone",
+			activities: []webhook.Activity{
+				{Kind: webhook.KindFollow, ForUserID: "bot", SourceID: "bot", TargetID: "u1"},
+			},
+		},
+		{
+			name: "otherKind",
+			activities: []webhook.Activity{
+				{Kind: webhook.KindUnfollow, ForUserID: "bot", SourceID: "u1", TargetID: "bot"},
+			},
+		},
+		{name: "sendFailure", activities: []webhook.Activity{follow}, sendErr: fmt.Errorf("boom"), err: true, sent: 1},
+		{
+			name:       "sendForbidden",
+			activities: []webhook.Activity{follow, follow},
+			sendErr:    &twitter.APIError{Kind: twitter.ErrorForbidden, StatusCode: 403},
+			sent:       1,
+		},
+	}
+
+	renderer, err := reply.New("")
+	if err != nil {
+		t.Fatalf("new renderer: %v", err)
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			var sent []string
+			w := New(store, account.NewMemoryRegistry(account.Account{UserID: "bot"}), renderer, func(ctx context.Context, accountID string, recipientID string, text string) error {
+				sent = append(sent, text)
+				return tc.sendErr
+			})
+
+			for _, a := range tc.activities {
+				err = w.HandleActivity(context.Background(), a)
+			}
+			if (err != nil) != tc.err {
+				t.Fatalf("got error: %v, wanted error: %v", err, tc.err)
+			}
+			if len(sent) != tc.sent {
+				t.Fatalf("got: %v sent, wanted: %v", len(sent), tc.sent)
+			}
+			if tc.sent > 0 && !strings.Contains(sent[0], "@alice") {
+				t.Fatalf("got: %q, wanted the welcome to @alice", sent[0])
+			}
+			if tc.err {
+				if claimed, _ := store.Claim(context.Background(), "bot", "u1"); !claimed {
+					t.Fatalf("got claim kept after failure, wanted it released")
+				}
+			}
+		})
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	renderer, err := reply.New("")
+	if err != nil {
+		t.Fatalf("new renderer: %v", err)
+	}
+	if err := renderer.Define(reply.TemplateWelcome, "Hej {{.ScreenName}}"); err != nil {
+		t.Fatalf("define: %v", err)
+	}
+	accounts := account.NewMemoryRegistry(
+		account.Account{UserID: "bot1"},
+		account.Account{UserID: "bot2", Templates: map[string]string{reply.TemplateWelcome: "Hallo {{.ScreenName}}"}},
+	)
+
+	tt := []struct {
+		name      string
+		accountID string
+		out       string
+	}{
+		{name: "deployment", accountID: "bot1", out: "Hej alice"},
+		{name: "account", accountID: "bot2", out: "Hallo alice"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			w := New(NewMemoryStore(), accounts, renderer, func(ctx context.Context, accountID string, recipientID string, text string) error {
+				got = text
+				return nil
+			})
+			if err := w.Welcome(context.Background(), tc.accountID, "u1", "alice"); err != nil {
+				t.Fatalf("welcome: %v", err)
+			}
+			if got != tc.out {
+				t.Fatalf("got: %q, wanted: %q", got, tc.out)
+			}
+		})
+	}
+}
@@ -1,135 +1,269 @@
 package main
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/eventsink"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/revoke"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/welcome"
 )
 
-type (
-	twitterPayload struct {
-		ForUserID           string `json:"for_user_id"`
-		DirectMessageEvents []struct {
-			Type            string `json:"type"`
-			ID              string `json:"id"`
-			CreateTimestamp string `json:"created_timestamp"`
-			MessageCreate   struct {
-				SenderID    string `json:"sender_id"`
-				MessageData struct {
-					Text       string   `json:"text"`
-					Entities   struct{} `json:"entities"`
-					Attachment struct {
-						Type  string `json:"type"`
-						Media struct {
-							ID         int64  `json:"id"`
-							MediaURL   string `json:"media_url"`
-							URL        string `json:"url"`
-							DisplayURL string `json:"display_url"`
-						} `json:"media"`
-					} `json:"attachment"`
-				} `json:"message_data"`
-			} `json:"message_create"`
-		} `json:"direct_message_events"`
+// server answers the webhook deliveries API Gateway proxies to the lambda
+type server struct {
+	webhook *webhook.Handler
+	logger  *logging.Logger
+	tracer  *trace.Tracer
+}
+
+// newServer returns a server of h. Logs and spans are discarded until set.
+func newServer(h *webhook.Handler) *server {
+	return &server{
+		webhook: h,
+		logger:  logging.New(ioutil.Discard, "twitter-bot1", logging.LevelError),
+		tracer:  trace.New("twitter-bot1", trace.Nop{}),
 	}
-)
+}
 
-var (
-	consumerSecret string
-)
+// fromConfig returns the server of the lambda, with the AWS services of cfg.
+// Activities are routed by ACTIVITY_ROUTES to the handlers named log, welcome
+// and revoke.
+func fromConfig(cfg config.Config) (*server, error) {
+	logger := logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	logger.Redact(cfg.Twitter.ConsumerSecret, cfg.Twitter.OAuthSecret, cfg.Twitter.BearerToken)
+	recorder := metrics.New(cfg.Features.Metrics)
 
-type (
-	crsToken struct {
-		ResponseToken string `json:"response_token"`
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
 	}
-)
 
-func init() {
-	consumerSecret = os.Getenv("CONSUMER_SECRET_KEY")
-}
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
+	}))
 
-// Handler main lambda function
-func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	if request.HTTPMethod == "GET" {
-		crcToken := newCrsToken(request.QueryStringParameters["crc_token"])
-		respCrcToken, err := json.Marshal(crcToken)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
+	localEvents := make(chan webhook.Event, 100)
+	go consumeEvents(logger, localEvents)
 
-		return events.APIGatewayProxyResponse{
-			Body:       fmt.Sprintf("%s", respCrcToken),
-			StatusCode: 200,
-		}, nil
-	} else if request.HTTPMethod == "POST" {
-		if verifyRequest(request) {
-			err := postMethod(request)
-			if err != nil {
-				return events.APIGatewayProxyResponse{
-					StatusCode: 500,
-				}, nil
-			}
-			return events.APIGatewayProxyResponse{
-				StatusCode: 200,
-			}, nil
-		}
-		return events.APIGatewayProxyResponse{
-			Body:       fmt.Sprintf("bad crc\n"),
-			StatusCode: 400,
-		}, nil
+	sink, err := eventsink.New(cfg.EventSink, sess, eventsink.NewChannel(localEvents))
+	if err != nil {
+		return nil, err
+	}
+
+	welcomer, err := newWelcomer(cfg, sess, recorder)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := webhook.ParseRoutes(cfg.Features.ActivityRoutes, map[string]webhook.ActivityHandler{
+		"log":     webhook.ActivityHandlerFunc(logActivity),
+		"welcome": welcomer,
+		"revoke":  newRevoker(cfg, sess),
+	})
+	if err != nil {
+		return nil, err
+	}
 
+	h := webhook.NewHandler(cfg.Twitter.ConsumerSecret, sink)
+	for kind, ah := range routes {
+		h.Route(kind, ah)
 	}
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-	}, nil
+	h.Metrics(recorder)
+
+	s := newServer(h)
+	s.logger = logger
+	s.tracer = trace.New("twitter-bot1", exporter)
+	return s, nil
 }
 
-func postMethod(request events.APIGatewayProxyRequest) error {
-	var payLoad twitterPayload
+// Handle is the lambda handler function
+func (s *server) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx, span := s.tracer.Start(logging.NewContext(ctx, s.logger), "webhook")
+	defer span.End()
+	span.SetAttribute("request_id", request.RequestContext.RequestID)
 
-	err := json.Unmarshal([]byte(request.Body), &payLoad)
-	if err != nil {
-		return err
-	}
+	resp, err := s.webhook.ServeLambda(ctx, request)
+	span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	return resp, err
+}
 
-	fmt.Printf("payLoad: %v\n", payLoad)
+// ServeHTTP implements http.Handler for self-hosting with LISTEN_ADDR, the
+// logger and span are put in the context like Handle does.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(logging.NewContext(r.Context(), s.logger), "webhook")
+	defer span.End()
 
-	return nil
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	s.webhook.ServeHTTP(sw, r.WithContext(ctx))
+	span.SetAttribute("http.status_code", strconv.Itoa(sw.status))
 }
 
-func newCrsToken(token string) crsToken {
-	h := hmac.New(sha256.New, []byte(consumerSecret))
-	h.Write([]byte(token))
-	encoded := base64.StdEncoding.EncodeToString(h.Sum(nil))
-	return crsToken{
-		ResponseToken: fmt.Sprintf("sha256=%s", encoded),
-	}
+// statusWriter records the status code written
+type statusWriter struct {
+	http.ResponseWriter
+	status int
 }
 
-func verifyRequest(event events.APIGatewayProxyRequest) bool {
+// WriteHeader implements http.ResponseWriter.
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
 
-	crc := event.Headers["X-Twitter-Webhooks-Signature"]
-	h := hmac.New(sha256.New, []byte(consumerSecret))
-	h.Write([]byte(event.Body))
+// newWelcomer returns the welcome handler. WELCOME_TABLE records the users
+// already welcomed and WELCOME_TEMPLATE replaces the default welcome text.
+func newWelcomer(cfg config.Config, sess *session.Session, recorder metrics.Recorder) (*welcome.Welcomer, error) {
+	dynamodbSvc := dynamodb.New(sess)
 
-	crcBase64, err := base64.StdEncoding.DecodeString(crc[7:])
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
+	}
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	clients := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits)
+	clients.Observe = ratelimit.Budget(recorder)
+
+	renderer, err := reply.New(cfg.Features.ReplyOverflow)
 	if err != nil {
-		fmt.Printf("verifyRequest failed base64 decodeString with error: %v\n", err)
-		return false
+		return nil, err
+	}
+	if text := cfg.Features.WelcomeTemplate; text != "" {
+		if err := renderer.Define(reply.TemplateWelcome, text); err != nil {
+			return nil, err
+		}
+	}
+
+	var store welcome.Store
+	if cfg.Tables.Welcome != "" {
+		store = welcome.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Welcome)
+	} else {
+		store = welcome.NewMemoryStore()
+	}
+
+	return welcome.New(store, registry, renderer, func(ctx context.Context, accountID string, recipientID string, text string) error {
+		client, _, err := clients.Get(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		_, err = twitter.SendDirectMessage(ctx, client, twitter.NewDirectMessageRequest(recipientID, text))
+		if err != nil {
+			metrics.Count(recorder, metrics.DirectMessagesFailed, 1, "Source", "welcome")
+			return err
+		}
+		metrics.Count(recorder, metrics.DirectMessagesSent, 1, "Source", "welcome")
+		return nil
+	}), nil
+}
+
+// newRevoker returns the revocation cleanup. ACCOUNT_ACTIVITY_ENV and
+// BEARER_TOKEN are needed to unsubscribe, the user's own tokens no longer
+// work once access is revoked. AUDIT_TABLE keeps the audit log and the
+// account is removed from ACCOUNTS_TABLE.
+func newRevoker(cfg config.Config, sess *session.Session) *revoke.Revoker {
+	envName := cfg.Twitter.AccountActivityEnv
+	appClient := twitter.NewAppClient(cfg.Twitter.BearerToken)
+	dynamodbSvc := dynamodb.New(sess)
+
+	var store conversation.Store
+	if cfg.Tables.Conversation != "" {
+		store = conversation.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Conversation)
+	} else {
+		store = conversation.NewMemoryStore()
+	}
+	var index pictureindex.Index
+	if cfg.Tables.PictureIndex != "" {
+		index = pictureindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PictureIndex)
+	} else {
+		index = pictureindex.NewMemoryIndex()
+	}
+
+	var hashes phashindex.Index
+	if cfg.Tables.PerceptualHash != "" {
+		hashes = phashindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PerceptualHash)
+	} else {
+		hashes = phashindex.NewMemoryIndex()
+	}
+	var audit revoke.AuditLog
+	if cfg.Tables.Audit != "" {
+		audit = revoke.NewDynamoDBAuditLog(dynamodbSvc, cfg.Tables.Audit)
+	} else {
+		audit = revoke.NewMemoryAuditLog()
 	}
-	return hmac.Equal(crcBase64, h.Sum(nil))
+
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+
+	return revoke.New(func(ctx context.Context, userID string) error {
+		return twitter.Unsubscribe(ctx, appClient, envName, userID)
+	}, forget.New(s3.New(sess), index, hashes, store), registry, audit)
+}
+
+// logActivity logs the activity, for kinds worth seeing but not acting on.
+func logActivity(ctx context.Context, activity webhook.Activity) error {
+	logging.FromContext(ctx).Info("activity",
+		"kind", activity.Kind,
+		logging.FieldSenderHash, logging.SenderHash(activity.SourceID),
+		logging.FieldForUserID, activity.ForUserID,
+	)
+	return nil
 }
 
-// String Stringers interface
-func (c crsToken) String() string {
-	return c.ResponseToken
+// consumeEvents is the in-process consumer used with the local event sink.
+func consumeEvents(logger *logging.Logger, localEvents <-chan webhook.Event) {
+	for event := range localEvents {
+		logger.WithRequest(event.RequestID).Info("event",
+			logging.FieldForUserID, event.ForUserID,
+			"direct_messages", len(event.DirectMessageEvents),
+		)
+	}
 }
 
 func main() {
-	lambda.Start(Handler)
+	cfg, err := config.FromEnv("twitter-bot1")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret); err != nil {
+		log.Fatal(err)
+	}
+	s, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Features.ListenAddr != "" {
+		log.Fatal(http.ListenAndServe(cfg.Features.ListenAddr, s))
+	}
+	lambda.Start(s.Handle)
 }
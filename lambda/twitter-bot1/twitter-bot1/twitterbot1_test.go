@@ -1,10 +1,15 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/eventsink"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/webhook"
 )
 
 func TestTwitterCrcCheck(t *testing.T) {
@@ -18,32 +23,86 @@ func TestTwitterCrcCheck(t *testing.T) {
 			name:            "simpleUnitTestforTwitterCrcToken",
 			twitterCrcToken: "helloWorld",
 			consumerSecret:  "ss",
-			out:             "sha256=YFpPr1o5UmzuIUDQn+BqYQ14kFOjWiWYc7oNiVymMgg=",
+			out:             `{"response_token":"sha256=YFpPr1o5UmzuIUDQn+BqYQ14kFOjWiWYc7oNiVymMgg="}`,
 		},
 	}
 
 	for _, tc := range tt {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			consumerSecret = tc.consumerSecret
-			result := newCrsToken(tc.twitterCrcToken)
-			if tc.out != fmt.Sprintf("%v", result) {
-				t.Fatalf("got: %v, wanted: %v", result, tc.out)
+			t.Parallel()
+			s := newServer(webhook.NewHandler(tc.consumerSecret, eventsink.Func(func(ctx context.Context, event webhook.Event) error {
+				return nil
+			})))
+			result, err := s.Handle(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod:            "GET",
+				QueryStringParameters: map[string]string{"crc_token": tc.twitterCrcToken},
+			})
+			if err != nil {
+				t.Fatalf("Handler failed with error: %v", err)
+			}
+			if tc.out != result.Body {
+				t.Fatalf("got: %v, wanted: %v", result.Body, tc.out)
 			}
 		})
 	}
 }
 
 func TestTwitterVerifyRequest(t *testing.T) {
-	consumerSecret = "bbbbbb"
+	t.Parallel()
+	var published []webhook.Event
+	s := newServer(webhook.NewHandler("bbbbbb", eventsink.Func(func(ctx context.Context, event webhook.Event) error {
+		published = append(published, event)
+		return nil
+	})))
+
 	e := events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
 		Headers: map[string]string{
-			"X-Twitter-Webhooks-Signature": "sha256=P/M6xYi2AxkjB8C36xD3AfjT5XuOx3dWgw9EVXCYA2U=",
+			"X-Twitter-Webhooks-Signature": "sha256=ZBAm8n6B1Y8B57hNqLsB62Lhca7G0giZWzM8pbUcSCg=",
 		},
-		Body: "html body",
+		Body: `{"for_user_id":"4337869213","direct_message_events":[{"type":"message_create","id":"954491830116155396","created_timestamp":"1516403560557","message_create":{"sender_id":"3805104374","message_data":{"text":"hello"}}}]}`,
+	}
+
+	result, err := s.Handle(context.Background(), e)
+	if err != nil {
+		t.Fatalf("Handler failed with error: %v", err)
+	}
+	if result.StatusCode != 200 {
+		t.Fatalf("verifyRequest failed. got status: %v", result.StatusCode)
+	}
+	if len(published) != 1 {
+		t.Fatalf("got: %v published events, wanted: 1", len(published))
 	}
 
-	if !verifyRequest(e) {
-		t.Fatalf("verifyRequest failed.")
+	e.Body = "html body"
+	result, err = s.Handle(context.Background(), e)
+	if err != nil {
+		t.Fatalf("Handler failed with error: %v", err)
 	}
+	if result.StatusCode != 400 {
+		t.Fatalf("got status: %v for tampered body, wanted: 400", result.StatusCode)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	t.Parallel()
+	var published []webhook.Event
+	s := newServer(webhook.NewHandler("bbbbbb", eventsink.Func(func(ctx context.Context, event webhook.Event) error {
+		published = append(published, event)
+		return nil
+	})))
 
+	body := `{"for_user_id":"4337869213","direct_message_events":[{"type":"message_create","id":"954491830116155396","created_timestamp":"1516403560557","message_create":{"sender_id":"3805104374","message_data":{"text":"hello"}}}]}`
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	req.Header.Set("X-Twitter-Webhooks-Signature", "sha256=ZBAm8n6B1Y8B57hNqLsB62Lhca7G0giZWzM8pbUcSCg=")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || len(published) != 1 {
+		t.Fatalf("got: status %v and %v published events, wanted: 200 and 1", w.Code, len(published))
+	}
+	if published[0].Trace == "" {
+		t.Fatalf("got no trace, wanted the span of the request")
+	}
 }
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,163 +12,481 @@ import (
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/dbgeek/oauth"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/media"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
 )
 
 type (
 	// DirectMessageEvent payload from twitter
 	DirectMessageEvent struct {
-		CreateTimestamp int64  `json:"create_timestamp"`
-		MediaID         string `json:"mediaID"`
-		MediaURL        string `json:"media_url"`
-		URL             string `json:"url"`
-		MessageText     string `json:"message_text"`
-		SenderID        string `json:"sender_id"`
-		Text            string `json:"text"`
+		ID                 string `json:"id"`
+		CreateTimestamp    int64  `json:"create_timestamp"`
+		MediaID            string `json:"mediaID"`
+		MediaURL           string `json:"media_url"`
+		URL                string `json:"url"`
+		MessageText        string `json:"message_text"`
+		SenderID           string `json:"sender_id"`
+		Text               string `json:"text"`
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
 	}
 	// Event to send between step functions
 	Event struct {
+		RequestID           string               `json:"request-id"`
+		ForUserID           string               `json:"for-user-id"`
 		DirectMessageEvents []DirectMessageEvent `json:"direct-message-events"`
 		PictureExists       bool                 `json:"picture-exists"`
+		Trace               string               `json:"trace,omitempty"`
 	}
 	// OutDirectMessageEvent ..
 	OutDirectMessageEvent struct {
-		CreateTimestamp int64  `json:"create_timestamp"`
-		MediaID         string `json:"mediaID"`
-		MediaURL        string `json:"media_url"`
-		URL             string `json:"url"`
-		MessageText     string `json:"message_text"`
-		SenderID        string `json:"sender_id"`
-		Text            string `json:"text"`
-		S3bucket        string `json:"s3_bucket"`
-		S3path          string `json:"s3_path"`
+		ID                 string `json:"id"`
+		CreateTimestamp    int64  `json:"create_timestamp"`
+		MediaID            string `json:"mediaID"`
+		MediaURL           string `json:"media_url"`
+		URL                string `json:"url"`
+		MessageText        string `json:"message_text"`
+		SenderID           string `json:"sender_id"`
+		Text               string `json:"text"`
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
+		S3bucket           string `json:"s3_bucket"`
+		S3path             string `json:"s3_path"`
+		Transient          bool   `json:"transient"`
+		// Checksum hex SHA-256 of the picture
+		Checksum string `json:"sha256,omitempty"`
+		// PHash perceptual hash of the picture, empty when it could not be
+		// decoded
+		PHash string `json:"phash,omitempty"`
+		// SimilarTo checksum of a stored picture that looks the same, e.g.
+		// a resized copy, whose analyses can be reused
+		SimilarTo string `json:"similar_to,omitempty"`
+		// Flagged the picture is on the blocklist, it was not stored
+		Flagged bool `json:"flagged,omitempty"`
 	}
 	// OutEvent event out from this function to next step
 	OutEvent struct {
+		RequestID           string                  `json:"request-id"`
+		ForUserID           string                  `json:"for-user-id"`
 		DirectMessageEvents []OutDirectMessageEvent `json:"direct-message-events"`
+		Trace               string                  `json:"trace,omitempty"`
 	}
 )
 
-var (
-	consumerSecret string
-	consumerKey    string
-	oauthSecret    string
-	oauthToken     string
-	destBucket     string
-	client         *http.Client
-	s3srvc         *s3.S3
-)
+// handler downloads the pictures of direct messages to the picture store
+type handler struct {
+	clients    account.ClientSource
+	pictures   *picturestore.Store
+	store      conversation.Store
+	index      pictureindex.Index
+	hashes     phashindex.Index
+	bucket     string
+	thresholds config.Thresholds
+	// blocklist pictures refused, nil refuses none
+	blocklist phash.Blocklist
+	logger    *logging.Logger
+	recorder  metrics.Recorder
+	tracer    *trace.Tracer
+}
 
-func init() {
+// storedPicture a picture stored by storePicture
+type storedPicture struct {
+	key      string
+	checksum string
+	// hash perceptual hash, when hashed
+	hash   phash.Hash
+	hashed bool
+	// similarTo checksum of a near-duplicate stored before
+	similarTo string
+	// flagged the picture is on the blocklist and was not stored
+	flagged bool
+}
+
+// newHandler returns a handler storing pictures of up to
+// thresholds.MaxPictureBytes in bucket, by the checksum of their content, and
+// their perceptual hashes in hashes. Logs, metrics and spans are discarded
+// until set.
+func newHandler(clients account.ClientSource, pictures *picturestore.Store, store conversation.Store, index pictureindex.Index, hashes phashindex.Index, bucket string, thresholds config.Thresholds) *handler {
+	return &handler{
+		clients:    clients,
+		pictures:   pictures,
+		store:      store,
+		index:      index,
+		hashes:     hashes,
+		bucket:     bucket,
+		thresholds: thresholds,
+		logger:     logging.New(ioutil.Discard, "twitter-get-picture", logging.LevelError),
+		recorder:   metrics.Nop{},
+		tracer:     trace.New("twitter-get-picture", trace.Nop{}),
+	}
+}
 
-	var err error
+// fromConfig returns the handler of the lambda, with the AWS services of cfg.
+func fromConfig(cfg config.Config) (*handler, error) {
+	logger := logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	logger.Redact(cfg.Twitter.ConsumerSecret, cfg.Twitter.OAuthSecret)
+	recorder := metrics.New(cfg.Features.Metrics)
 
-	consumerKey = os.Getenv("CONSUMER_KEY")
-	consumerSecret = os.Getenv("CONSUMER_SECRET_KEY")
-	oauthToken = os.Getenv("OAUTH_TOKEN")
-	oauthSecret = os.Getenv("OAUTH_SECRET")
-	destBucket = os.Getenv("PICTURE_BUCKET")
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
+	}
 
-	c := oauth.NewConsumer(
-		consumerKey,
-		consumerSecret,
-		oauth.ServiceProvider{
-			RequestTokenUrl:   "https://api.twitter.com/oauth/request_token",
-			AuthorizeTokenUrl: "https://api.twitter.com/oauth/authorize",
-			AccessTokenUrl:    "https://api.twitter.com/oauth/access_token",
-		})
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
+	}))
+	dynamodbSvc := dynamodb.New(sess)
 
-	accessToken := oauth.AccessToken{
-		Token:  oauthToken,
-		Secret: oauthSecret,
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
 	}
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	clients := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits)
+	clients.Observe = ratelimit.Budget(recorder)
 
-	client, err = c.MakeHttpClient(&accessToken)
+	var keys picturestore.KeyProvider
+	if cfg.Pictures.KMSKeyID != "" {
+		keys = picturestore.NewKMSKeyProvider(kms.New(sess), cfg.Pictures.KMSKeyID)
+	}
+	pictures, err := picturestore.New(cfg.Pictures.Config, s3.New(sess), keys)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	var store conversation.Store
+	if cfg.Tables.Conversation != "" {
+		store = conversation.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Conversation)
+	} else {
+		store = conversation.NewMemoryStore()
+	}
+
+	var index pictureindex.Index
+	if cfg.Tables.PictureIndex != "" {
+		index = pictureindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PictureIndex)
+	} else {
+		index = pictureindex.NewMemoryIndex()
 	}
 
-	s3srvc = s3.New(
-		session.New(
-			&aws.Config{
-				Region: aws.String(endpoints.EuNorth1RegionID),
-			},
-		),
-	)
+	var hashes phashindex.Index
+	if cfg.Tables.PerceptualHash != "" {
+		hashes = phashindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PerceptualHash)
+	} else {
+		hashes = phashindex.NewMemoryIndex()
+	}
 
+	h := newHandler(clients, pictures, store, index, hashes, cfg.Pictures.Bucket, cfg.Thresholds)
+	h.blocklist = cfg.Pictures.Blocklist
+	h.logger = logger
+	h.recorder = recorder
+	h.tracer = trace.New("twitter-get-picture", exporter)
+	return h, nil
 }
 
-// Handler function for the lambda
-func Handler(event Event) (OutEvent, error) {
+// Handle is the lambda handler function
+func (h *handler) Handle(ctx context.Context, event Event) (OutEvent, error) {
+	ctx, span := h.tracer.Continue(ctx, "twitter-get-picture", event.Trace)
+	defer span.End()
+
+	log := h.logger.WithRequest(event.RequestID).With(logging.FieldForUserID, event.ForUserID)
+	client, _, err := h.clients.Get(ctx, event.ForUserID)
+	if err != nil {
+		log.Error("failed to get account", "error", err)
+		return OutEvent{}, fmt.Errorf("GET_ACCOUNT_FAILED")
+	}
 
 	outDirectMessageEvent := make([]OutDirectMessageEvent, 0)
 	for _, v := range event.DirectMessageEvents {
+		if v.MediaURL == "" {
+			outDirectMessageEvent = append(outDirectMessageEvent, OutDirectMessageEvent{
+				ID:                 v.ID,
+				CreateTimestamp:    v.CreateTimestamp,
+				MessageText:        v.MessageText,
+				SenderID:           v.SenderID,
+				Text:               v.Text,
+				QuickReplyMetadata: v.QuickReplyMetadata,
+			})
+			continue
+		}
 
-		image, err := getImage(v.MediaURL)
+		ctx := logging.NewContext(ctx, log.WithDM(v.ID, v.SenderID))
+
+		// the picture is accepted, show the sender that the bot is on it
+		twitter.Working(ctx, client, v.ID, v.SenderID)
+
+		state, err := h.store.Get(ctx, event.ForUserID, v.SenderID)
 		if err != nil {
-			return OutEvent{}, err
+			logging.FromContext(ctx).Error("failed to get conversation", "error", err)
+			return OutEvent{}, fmt.Errorf("GET_CONVERSATION_FAILED")
 		}
 
-		createTime := time.Unix(v.CreateTimestamp/1000, 0)
-		s3Prefix := createTime.Format("2006/01/02")
-		imageName := fmt.Sprintf("%s.jpg", v.MediaID)
-		err = putImageS3(destBucket, s3Prefix, imageName, image)
+		retentionClass := retention.ClassRawImage
+		if !state.Preferences.RetainPictures() {
+			retentionClass = retention.ClassTransient
+		}
+		p, err := h.storePicture(ctx, client, v.MediaURL, v.MediaID, retention.Tags{
+			Sender:         v.SenderID,
+			ForUserID:      event.ForUserID,
+			RetentionClass: retentionClass,
+		})
 		if err != nil {
 			return OutEvent{}, err
 		}
+		twitter.Working(ctx, client, "", v.SenderID)
+
+		if p.flagged {
+			outDirectMessageEvent = append(outDirectMessageEvent, OutDirectMessageEvent{
+				ID:                 v.ID,
+				CreateTimestamp:    v.CreateTimestamp,
+				MediaID:            v.MediaID,
+				MediaURL:           v.MediaURL,
+				URL:                v.URL,
+				MessageText:        v.MessageText,
+				SenderID:           v.SenderID,
+				Text:               v.Text,
+				QuickReplyMetadata: v.QuickReplyMetadata,
+				Checksum:           p.checksum,
+				PHash:              p.hash.String(),
+				Flagged:            true,
+			})
+			continue
+		}
+
+		owner := pictureindex.Owner{ForUserID: event.ForUserID, SenderID: v.SenderID}
+		err = h.index.Add(ctx, owner, pictureindex.Object{
+			Bucket: h.bucket,
+			Key:    p.key,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to index picture", "error", err)
+			return OutEvent{}, fmt.Errorf("INDEX_PICTURE_FAILED")
+		}
 
 		o := OutDirectMessageEvent{
-			CreateTimestamp: v.CreateTimestamp,
-			MediaID:         v.MediaID,
-			MediaURL:        v.MediaURL,
-			URL:             v.URL,
-			MessageText:     v.MessageText,
-			SenderID:        v.SenderID,
-			Text:            v.Text,
-			S3bucket:        destBucket,
-			S3path:          fmt.Sprintf("%s/%s", s3Prefix, imageName),
+			ID:                 v.ID,
+			CreateTimestamp:    v.CreateTimestamp,
+			MediaID:            v.MediaID,
+			MediaURL:           v.MediaURL,
+			URL:                v.URL,
+			MessageText:        v.MessageText,
+			SenderID:           v.SenderID,
+			Text:               v.Text,
+			QuickReplyMetadata: v.QuickReplyMetadata,
+			S3bucket:           h.bucket,
+			S3path:             p.key,
+			Checksum:           p.checksum,
+			SimilarTo:          p.similarTo,
+			Transient:          !state.Preferences.RetainPictures(),
+		}
+		if p.hashed {
+			o.PHash = p.hash.String()
 		}
 		outDirectMessageEvent = append(outDirectMessageEvent, o)
 	}
 
 	return OutEvent{
+		RequestID:           event.RequestID,
+		ForUserID:           event.ForUserID,
 		DirectMessageEvents: outDirectMessageEvent,
+		Trace:               trace.Traceparent(ctx),
 	}, nil
 }
-func putImageS3(bucket string, prefix string, fileName string, image *[]byte) error {
-
-	_, err := s3srvc.PutObject(
-		&s3.PutObjectInput{
-			Bucket:      aws.String(bucket),
-			Body:        bytes.NewReader(*image),
-			Key:         aws.String(fmt.Sprintf("%s/%s", prefix, fileName)),
-			ContentType: aws.String("image/jpeg"),
-		},
-	)
+
+// storePicture downloads the picture at url and streams it to a staging key
+// named after mediaID, the checksum and the perceptual hash are only known
+// once the whole picture is read. A picture on the blocklist is deleted and
+// flagged. Otherwise it is moved to the key of its content, unless it is
+// already stored for this or another sender, and a near-duplicate stored
+// before is looked up. Downloads that are not a picture, or are too large,
+// are refused before anything is stored.
+func (h *handler) storePicture(ctx context.Context, client *http.Client, url string, mediaID string, tags retention.Tags) (storedPicture, error) {
+	start := time.Now()
+	d, err := media.Get(ctx, client, url, int64(h.thresholds.MaxPictureBytes))
 	if err != nil {
-		fmt.Printf("Failed to put object got error: %v\n", err)
-		return fmt.Errorf("PUT_IMAGE_S3_FAILED")
+		return storedPicture{}, h.downloadError(ctx, err)
+	}
+	defer d.Close()
+	hasher := phash.NewWriter()
+	defer hasher.Close()
+
+	ext := media.Extension(d.Type)
+	staging := "incoming/" + mediaID + ext
+	tags.MediaType = d.Type
+	// a staging object left behind by a failed move is deleted with the
+	// transient objects
+	stagingTags := tags
+	stagingTags.RetentionClass = retention.ClassTransient
+	err = h.pictures.PutStream(ctx, picturestore.StreamInput{
+		Bucket:      h.bucket,
+		Key:         staging,
+		Body:        io.TeeReader(d, hasher),
+		ContentType: d.Type,
+		Tagging:     stagingTags.Encode(),
+	})
+	if err != nil {
+		if derr := d.Err(); derr != nil {
+			return storedPicture{}, h.downloadError(ctx, derr)
+		}
+		logging.FromContext(ctx).Error("failed to put picture", "bucket", h.bucket, "error", err)
+		return storedPicture{}, fmt.Errorf("PUT_IMAGE_S3_FAILED")
+	}
+
+	p := storedPicture{checksum: d.Checksum()}
+	if p.hash, err = hasher.Sum(); err != nil {
+		// the picture is still analysed, only near-duplicates are missed
+		logging.FromContext(ctx).Warn("failed to hash picture", "sha256", p.checksum, "error", err)
+	} else {
+		p.hashed = true
 	}
 
-	return nil
+	if blocked, ok := h.blocklist.Match(p.hash, h.thresholds.PHashMaxDistance); p.hashed && ok {
+		metrics.Count(h.recorder, metrics.PicturesFlagged, 1)
+		logging.FromContext(ctx).Warn("picture is on the blocklist", "phash", p.hash.String(), "blocked", blocked.String(), "sha256", p.checksum)
+		if err := h.pictures.Delete(ctx, h.bucket, staging); err != nil {
+			// tagged transient, it is deleted with the transient objects
+			logging.FromContext(ctx).Error("failed to delete flagged picture", "key", staging, "error", err)
+		}
+		p.flagged = true
+		return p, nil
+	}
+
+	p.key = picturestore.ContentKey(p.checksum, ext)
+	if err := h.placePicture(ctx, staging, p.key, tags); err != nil {
+		logging.FromContext(ctx).Error("failed to move picture", "bucket", h.bucket, "key", p.key, "error", err)
+		return storedPicture{}, fmt.Errorf("PUT_IMAGE_S3_FAILED")
+	}
+	if p.hashed {
+		p.similarTo = h.nearDuplicate(ctx, p, tags.RetentionClass == retention.ClassTransient)
+	}
+
+	metrics.Since(h.recorder, metrics.PictureLatency, start)
+	metrics.Bytes(h.recorder, metrics.PictureBytes, d.BytesRead())
+	logging.FromContext(ctx).Debug("stored picture", "key", p.key, "type", d.Type, "bytes", d.BytesRead(), "sha256", p.checksum, "phash", p.hash.String())
+	return p, nil
+}
+
+// nearDuplicate returns the checksum of the nearest other picture that looks
+// like p, if any, and indexes the hash of p unless the sender keeps nothing.
+// Near-duplicates only save analyses, failures are logged and ignored.
+func (h *handler) nearDuplicate(ctx context.Context, p storedPicture, transient bool) string {
+	similarTo := ""
+	matches, err := h.hashes.Nearest(ctx, p.hash, h.thresholds.PHashMaxDistance)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to look up perceptual hash", "error", err)
+	}
+	for _, m := range matches {
+		if m.Checksum != p.checksum {
+			similarTo = m.Checksum
+			metrics.Count(h.recorder, metrics.NearDuplicates, 1)
+			logging.FromContext(ctx).Debug("found near-duplicate", "sha256", p.checksum, "similar_to", m.Checksum, "distance", m.Distance)
+			break
+		}
+	}
+
+	if !transient {
+		if err := h.hashes.Add(ctx, phashindex.Entry{Hash: p.hash, Checksum: p.checksum}); err != nil {
+			logging.FromContext(ctx).Error("failed to index perceptual hash", "error", err)
+		}
+	}
+	return similarTo
+}
+
+// placePicture moves the staged picture to key. When key is already stored
+// the staged copy is deleted and the stored tags are kept, they name the
+// first sender. Only a picture stored as transient for another sender is
+// escalated to the class of tags, this sender keeps it; a sender keeping
+// nothing never shortens how long another keeps a picture.
+func (h *handler) placePicture(ctx context.Context, staging string, key string, tags retention.Tags) error {
+	exists, err := h.pictures.Exists(ctx, h.bucket, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return h.pictures.Move(ctx, picturestore.MoveInput{
+			Bucket:  h.bucket,
+			From:    staging,
+			To:      key,
+			Tagging: tags.Encode(),
+		})
+	}
+
+	metrics.Count(h.recorder, metrics.PicturesDeduplicated, 1)
+	if tags.RetentionClass != retention.ClassTransient {
+		if err := h.escalate(ctx, key, tags.RetentionClass); err != nil {
+			return err
+		}
+	}
+	return h.pictures.Delete(ctx, h.bucket, staging)
 }
-func getImage(URL string) (*[]byte, error) {
-	resp, err := client.Get(URL)
+
+// escalate sets the retention class of the stored picture key to class when
+// it is transient, its other tags are kept.
+func (h *handler) escalate(ctx context.Context, key string, class string) error {
+	tagging, err := h.pictures.Tags(ctx, h.bucket, key)
 	if err != nil {
-		fmt.Printf("Failed to get picture fron twitter api. Got error: %v\n", err)
-		return nil, fmt.Errorf("FAILED_GET_IMAGE")
+		return err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	stored, err := retention.DecodeTags(tagging)
 	if err != nil {
-		return nil, fmt.Errorf("FAILED_READALL_BODY")
+		return fmt.Errorf("decode tags of %s: %v", key, err)
+	}
+	if retention.ClassOf(key, stored) != retention.ClassTransient {
+		return nil
 	}
-	return &body, nil
+	stored.RetentionClass = class
+	return h.pictures.Tag(ctx, h.bucket, key, stored.Encode())
+}
+
+// downloadError logs and counts a failed download and returns its lambda
+// error.
+func (h *handler) downloadError(ctx context.Context, err error) error {
+	kind := media.ErrorTransport
+	if merr, ok := err.(*media.Error); ok {
+		kind = merr.Kind
+	}
+	metrics.Count(h.recorder, metrics.PicturesRejected, 1, "Reason", kind)
+	logging.FromContext(ctx).Error("failed to get picture from twitter", "reason", kind, "error", err)
+	switch kind {
+	case media.ErrorTooLarge:
+		return fmt.Errorf("PICTURE_TOO_LARGE")
+	case media.ErrorType:
+		return fmt.Errorf("NOT_A_PICTURE")
+	}
+	return fmt.Errorf("FAILED_GET_IMAGE")
 }
 
 func main() {
-	lambda.Start(Handler)
+	cfg, err := config.FromEnv("twitter-get-picture")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret, config.KeyPictureBucket); err != nil {
+		log.Fatal(err)
+	}
+	h, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(h.Handle)
 }
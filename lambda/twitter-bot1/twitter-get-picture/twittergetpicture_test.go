@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phash"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+)
+
+// fakeTwitter answers the picture download with status and body and every
+// other request with no content
+type fakeTwitter struct {
+	status int
+	body   string
+}
+
+func (f fakeTwitter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	return &http.Response{StatusCode: f.status, ContentLength: -1, Body: ioutil.NopCloser(strings.NewReader(f.body))}, nil
+}
+
+type fakeClients struct {
+	client *http.Client
+}
+
+func (f fakeClients) Get(ctx context.Context, userID string) (*http.Client, account.Account, error) {
+	return f.client, account.Account{UserID: userID}, nil
+}
+
+// fakeS3 keeps the tags of the stored objects
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]string
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	f.objects[aws.StringValue(input.Key)] = aws.StringValue(input.Tagging)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if _, ok := f.objects[aws.StringValue(input.Key)]; !ok {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeS3) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	f.objects[aws.StringValue(input.Key)] = aws.StringValue(input.Tagging)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) PutObjectTaggingWithContext(ctx aws.Context, input *s3.PutObjectTaggingInput, opts ...request.Option) (*s3.PutObjectTaggingOutput, error) {
+	f.objects[aws.StringValue(input.Key)] = retention.TagsFromS3(input.Tagging.TagSet).Encode()
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (f *fakeS3) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	values, _ := url.ParseQuery(f.objects[aws.StringValue(input.Key)])
+	out := &s3.GetObjectTaggingOutput{}
+	for k := range values {
+		out.TagSet = append(out.TagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(values.Get(k))})
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// testJPEG returns a picture the perceptual hash can be computed of
+func testJPEG() string {
+	img := image.NewGray(image.Rect(0, 0, 36, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 36; x++ {
+			img.Set(x, y, color.Gray{Y: uint8((x*7 + y*3) % 256)})
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	return buf.String()
+}
+
+func TestHandle(t *testing.T) {
+	picture := testJPEG()
+	hash, err := phash.Decode(strings.NewReader(picture))
+	if err != nil {
+		t.Fatalf("phash.Decode failed with error: %v", err)
+	}
+	// the checksum of a resized copy of picture stored before
+	const copyChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tt := []struct {
+		name      string
+		dm        DirectMessageEvent
+		retention string
+		status    int
+		body      string
+		ext       string
+		// stored the tags of the picture stored before for another sender
+		stored    string
+		transient bool
+		class     string
+		// similar a resized copy of the picture was stored before
+		similar bool
+		// blocked the picture is on the blocklist
+		blocked bool
+		err     string
+	}{
+		{
+			name: "textOnly",
+			dm:   DirectMessageEvent{ID: "1", SenderID: "3805104374", Text: "hello"},
+		},
+		{
+			name: "picture",
+			dm: DirectMessageEvent{ID: "2", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155396", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/2/picture.jpg"},
+			status: 200,
+			body:   "\xff\xd8\xff\xe0 jpeg",
+			ext:    ".jpg",
+			class:  retention.ClassRawImage,
+		},
+		{
+			name: "png",
+			dm: DirectMessageEvent{ID: "4", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155398", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/4/picture.png"},
+			status: 200,
+			body:   "\x89PNG\r\n\x1a\n png",
+			ext:    ".png",
+			class:  retention.ClassRawImage,
+		},
+		{
+			name: "retentionOff",
+			dm: DirectMessageEvent{ID: "3", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155397", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/3/picture.jpg"},
+			retention: conversation.RetentionOff,
+			status:    200,
+			body:      "\xff\xd8\xff\xe0 jpeg",
+			ext:       ".jpg",
+			transient: true,
+			class:     retention.ClassTransient,
+		},
+		{
+			name: "alreadyStored",
+			dm: DirectMessageEvent{ID: "7", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155401", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/7/picture.jpg"},
+			status: 200,
+			body:   "\xff\xd8\xff\xe0 jpeg",
+			ext:    ".jpg",
+			stored: retention.Tags{Sender: "4337869213", RetentionClass: retention.ClassTransient}.Encode(),
+			class:  retention.ClassRawImage,
+		},
+		{
+			name: "alreadyStoredKept",
+			dm: DirectMessageEvent{ID: "11", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155405", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/11/picture.jpg"},
+			status: 200,
+			body:   "\xff\xd8\xff\xe0 jpeg",
+			ext:    ".jpg",
+			stored: retention.Tags{Sender: "4337869213", MediaType: "image/jpeg", RetentionClass: retention.ClassRawImage}.Encode(),
+			class:  retention.ClassRawImage,
+		},
+		{
+			name: "alreadyStoredKeptTransient",
+			dm: DirectMessageEvent{ID: "8", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155402", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/8/picture.jpg"},
+			retention: conversation.RetentionOff,
+			status:    200,
+			body:      "\xff\xd8\xff\xe0 jpeg",
+			ext:       ".jpg",
+			stored:    retention.Tags{Sender: "4337869213", RetentionClass: retention.ClassRawImage}.Encode(),
+			transient: true,
+			class:     retention.ClassRawImage,
+		},
+		{
+			name: "nearDuplicate",
+			dm: DirectMessageEvent{ID: "9", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155403", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/9/picture.jpg"},
+			status:  200,
+			body:    picture,
+			ext:     ".jpg",
+			class:   retention.ClassRawImage,
+			similar: true,
+		},
+		{
+			name: "blocked",
+			dm: DirectMessageEvent{ID: "10", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155404", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/10/picture.jpg"},
+			status:  200,
+			body:    picture,
+			blocked: true,
+		},
+		{
+			name: "errorPage",
+			dm: DirectMessageEvent{ID: "5", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155399", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/5/picture.jpg"},
+			status: 403,
+			body:   "<html>Forbidden</html>",
+			err:    "FAILED_GET_IMAGE",
+		},
+		{
+			name: "tooLarge",
+			dm: DirectMessageEvent{ID: "6", SenderID: "3805104374", CreateTimestamp: 1516363200000,
+				MediaID: "954491830116155400", MediaURL: "https://ton.twitter.com/1.1/ton/data/dm/1/6/picture.jpg"},
+			status: 200,
+			body:   "\xff\xd8\xff\xe0" + strings.Repeat("jpeg", 512),
+			err:    "PICTURE_TOO_LARGE",
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			sum := sha256.Sum256([]byte(tc.body))
+			checksum := hex.EncodeToString(sum[:])
+			key := ""
+			if tc.ext != "" {
+				key = picturestore.ContentKey(checksum, tc.ext)
+			}
+			s3Svc := &fakeS3{objects: make(map[string]string)}
+			if tc.stored != "" {
+				s3Svc.objects[key] = tc.stored
+			}
+			pictures, err := picturestore.New(picturestore.Config{}, s3Svc, nil)
+			if err != nil {
+				t.Fatalf("picturestore.New failed with error: %v", err)
+			}
+			store := conversation.NewMemoryStore()
+			store.Put(ctx, conversation.State{
+				ForUserID:   "4337869213",
+				SenderID:    tc.dm.SenderID,
+				Preferences: conversation.Preferences{Retention: tc.retention},
+			})
+			index := pictureindex.NewMemoryIndex()
+			hashes := phashindex.NewMemoryIndex()
+			if tc.similar {
+				hashes.Add(ctx, phashindex.Entry{Hash: hash ^ 1, Checksum: copyChecksum})
+			}
+			client := &http.Client{Transport: fakeTwitter{status: tc.status, body: tc.body}}
+
+			h := newHandler(fakeClients{client: client}, pictures, store, index, hashes, "pictures", config.Thresholds{MaxPictureBytes: 1024, PHashMaxDistance: 3})
+			if tc.blocked {
+				h.blocklist = phash.Blocklist{hash ^ 3}
+			}
+			out, err := h.Handle(ctx, Event{RequestID: "r1", ForUserID: "4337869213", DirectMessageEvents: []DirectMessageEvent{tc.dm}})
+			objects, _ := index.List(ctx, pictureindex.Owner{ForUserID: "4337869213", SenderID: tc.dm.SenderID})
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err || len(s3Svc.objects) != 0 || len(objects) != 0 {
+					t.Fatalf("got: %v %v stored %v indexed, wanted: %v and nothing stored", err, len(s3Svc.objects), len(objects), tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handle failed with error: %v", err)
+			}
+
+			got := out.DirectMessageEvents[0]
+			if tc.blocked {
+				if !got.Flagged || got.S3path != "" || len(s3Svc.objects) != 0 || len(objects) != 0 {
+					t.Fatalf("got: %+v %v stored %v indexed, wanted: flagged and nothing stored", got, len(s3Svc.objects), len(objects))
+				}
+				return
+			}
+			if similar := got.SimilarTo == copyChecksum; similar != tc.similar {
+				t.Fatalf("got: similar to %q, wanted: %v", got.SimilarTo, tc.similar)
+			}
+			if got.S3path != key || got.Transient != tc.transient {
+				t.Fatalf("got: %v %v, wanted: %v %v", got.S3path, got.Transient, key, tc.transient)
+			}
+			if key == "" {
+				if len(s3Svc.objects) != 0 || len(objects) != 0 {
+					t.Fatalf("got: %v stored %v indexed, wanted: none", len(s3Svc.objects), len(objects))
+				}
+				return
+			}
+			// the staged copy is gone, the picture is stored once
+			if _, ok := s3Svc.objects[key]; !ok || len(s3Svc.objects) != 1 || len(objects) != 1 {
+				t.Fatalf("got: %v indexed %v, wanted: %v stored and indexed", s3Svc.objects, objects, key)
+			}
+			tags, _ := retention.DecodeTags(s3Svc.objects[key])
+			if class := retention.ClassOf(key, tags); class != tc.class {
+				t.Fatalf("got: %v, wanted: %v", class, tc.class)
+			}
+			// a picture stored before still names the first sender
+			if first, _ := retention.DecodeTags(tc.stored); tc.stored != "" && tags.Sender != first.Sender {
+				t.Fatalf("got: sender %v, wanted: %v", tags.Sender, first.Sender)
+			}
+			if got.Checksum != checksum {
+				t.Fatalf("got: %v, wanted: the checksum of the picture", got.Checksum)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/outbox"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// handler sends the deferred replies
+type handler struct {
+	clients   account.ClientSource
+	deferred  *outbox.Outbox
+	store     conversation.Store
+	batchSize int
+	logger    *logging.Logger
+	recorder  metrics.Recorder
+	tracer    *trace.Tracer
+}
+
+// newHandler returns a handler sending up to batchSize replies of deferred a
+// run. Logs, metrics and spans are discarded until set.
+func newHandler(clients account.ClientSource, deferred *outbox.Outbox, store conversation.Store, batchSize int) *handler {
+	return &handler{
+		clients:   clients,
+		deferred:  deferred,
+		store:     store,
+		batchSize: batchSize,
+		logger:    logging.New(ioutil.Discard, "twitter-outbox", logging.LevelError),
+		recorder:  metrics.Nop{},
+		tracer:    trace.New("twitter-outbox", trace.Nop{}),
+	}
+}
+
+// fromConfig returns the handler of the lambda, with the AWS services of cfg.
+func fromConfig(cfg config.Config) (*handler, error) {
+	logger := logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	logger.Redact(cfg.Twitter.ConsumerSecret, cfg.Twitter.OAuthSecret)
+	recorder := metrics.New(cfg.Features.Metrics)
+
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
+	}))
+	dynamodbSvc := dynamodb.New(sess)
+
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
+	}
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	clients := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits)
+	clients.Observe = ratelimit.Budget(recorder)
+
+	var deferred *outbox.Outbox
+	if cfg.Tables.Outbox != "" {
+		deferred = outbox.New(outbox.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Outbox), outbox.DefaultPolicy)
+	} else {
+		deferred = outbox.New(outbox.NewMemoryStore(), outbox.DefaultPolicy)
+	}
+
+	var store conversation.Store
+	if cfg.Tables.Conversation != "" {
+		store = conversation.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Conversation)
+	} else {
+		store = conversation.NewMemoryStore()
+	}
+
+	h := newHandler(clients, deferred, store, cfg.Thresholds.OutboxBatchSize)
+	h.logger = logger
+	h.recorder = recorder
+	h.tracer = trace.New("twitter-outbox", exporter)
+	return h, nil
+}
+
+// Handle runs on a schedule and sends the due deferred replies. The counts
+// are logged and the report returned.
+func (h *handler) Handle(ctx context.Context, event events.CloudWatchEvent) (outbox.Report, error) {
+	ctx, span := h.tracer.Start(ctx, "twitter-outbox")
+	defer span.End()
+	log := h.logger.WithRequest(event.ID)
+	ctx = logging.NewContext(ctx, log)
+
+	report, err := h.deferred.Drain(ctx, h.send, h.batchSize)
+	if err != nil {
+		span.SetError(err)
+		log.Error("outbox run failed", "error", err)
+	}
+	log.Info("outbox run",
+		"sent", len(report.Sent),
+		"retried", report.Retried,
+		"dead", len(report.Dead),
+	)
+
+	return report, err
+}
+
+// send sends part of m as its bot account and remembers it in the sender's
+// conversation, so the reply is known as answered when the state machine
+// retries.
+func (h *handler) send(ctx context.Context, m outbox.Message, part twitter.DirectMessageRequest) (string, error) {
+	client, _, err := h.clients.Get(ctx, m.ForUserID)
+	if err != nil {
+		return "", err
+	}
+	sent, err := twitter.SendDirectMessage(ctx, client, part)
+	if err != nil {
+		metrics.Count(h.recorder, metrics.DirectMessagesFailed, 1, "Source", "outbox")
+		return "", err
+	}
+	metrics.Count(h.recorder, metrics.DirectMessagesSent, 1, "Source", "outbox")
+
+	log := logging.FromContext(ctx).WithDM(m.InReplyTo, m.SenderID).With(logging.FieldForUserID, m.ForUserID)
+	if m.ForUserID == "" {
+		// deferred before accounts were recorded, the conversation it
+		// belongs to is unknown
+		log.Warn("sent message without account not remembered")
+		return sent.ID, nil
+	}
+	state, err := h.store.Get(ctx, m.ForUserID, m.SenderID)
+	if err != nil {
+		log.Error("failed to get conversation", "error", err)
+		return sent.ID, nil
+	}
+	base := state.Copy()
+	state.AddMessage(conversation.Message{
+		ID:              sent.ID,
+		CreateTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Text:            part.Event.MessageCreate.MessageData.Text,
+		FromBot:         true,
+		InReplyTo:       m.InReplyTo,
+	})
+	if err := conversation.Save(ctx, h.store, base, state); err != nil {
+		log.Error("failed to put conversation", "error", err)
+	}
+	return sent.ID, nil
+}
+
+func main() {
+	cfg, err := config.FromEnv("twitter-outbox")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret); err != nil {
+		log.Fatal(err)
+	}
+	h, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(h.Handle)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+)
+
+// RetryableError a failure the state machine retries. Step Functions matches
+// the error type name, RetryableError, in the FaceRekognition Retry rule.
+type RetryableError struct {
+	Code string
+}
+
+// Error implements error.
+func (e *RetryableError) Error() string {
+	return e.Code
+}
+
+// detectError returns the lambda error for a failed face detection. A
+// detection that failed is not described as no faces, the sender would be
+// told there are none.
+func detectError(err error) error {
+	if request.IsErrorThrottle(err) {
+		return &RetryableError{Code: "REKOGNITION_THROTTLED"}
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case rekognition.ErrCodeThrottlingException, rekognition.ErrCodeProvisionedThroughputExceededException:
+			return &RetryableError{Code: "REKOGNITION_THROTTLED"}
+		case rekognition.ErrCodeInternalServerError:
+			return &RetryableError{Code: "REKOGNITION_SERVER_ERROR"}
+		}
+	}
+	if request.IsErrorRetryable(err) {
+		return &RetryableError{Code: "REKOGNITION_UNAVAILABLE"}
+	}
+	return fmt.Errorf("DETECT_FACES_FAILED")
+}
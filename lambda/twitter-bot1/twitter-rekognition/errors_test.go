@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+)
+
+func TestDetectError(t *testing.T) {
+	tt := []struct {
+		name      string
+		err       error
+		out       string
+		retryable bool
+	}{
+		{name: "throttled", err: awserr.New(rekognition.ErrCodeThrottlingException, "slow down", nil), out: "REKOGNITION_THROTTLED", retryable: true},
+		{name: "throughput", err: awserr.New(rekognition.ErrCodeProvisionedThroughputExceededException, "slow down", nil), out: "REKOGNITION_THROTTLED", retryable: true},
+		{name: "serverError", err: awserr.New(rekognition.ErrCodeInternalServerError, "oops", nil), out: "REKOGNITION_SERVER_ERROR", retryable: true},
+		{name: "network", err: awserr.New("RequestError", "send request failed", fmt.Errorf("connection reset")), out: "REKOGNITION_UNAVAILABLE", retryable: true},
+		{name: "invalidImage", err: awserr.New(rekognition.ErrCodeInvalidImageFormatException, "bad image", nil), out: "DETECT_FACES_FAILED"},
+		{name: "other", err: fmt.Errorf("boom"), out: "DETECT_FACES_FAILED"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := detectError(tc.err)
+			_, retryable := err.(*RetryableError)
+			if err.Error() != tc.out || retryable != tc.retryable {
+				t.Fatalf("got: %v %v, wanted: %v %v", err, retryable, tc.out, tc.retryable)
+			}
+		})
+	}
+}
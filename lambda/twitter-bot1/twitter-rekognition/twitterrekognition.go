@@ -1,146 +1,396 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/rekognition"
+	"github.com/aws/aws-sdk-go/service/rekognition/rekognitioniface"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/analysiscache"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
 )
 
 type (
 	// Event data struct in
 	Event struct {
+		RequestID           string                 `json:"request-id"`
+		ForUserID           string                 `json:"for-user-id"`
 		DirectMessageEvents []InDirectMessageEvent `json:"direct-message-events"`
 		PictureExists       bool                   `json:"picture-exists"`
+		Trace               string                 `json:"trace,omitempty"`
 	}
 	// InDirectMessageEvent ..
 	InDirectMessageEvent struct {
-		CreateTimestamp int64  `json:"create_timestamp"`
-		MediaID         string `json:"mediaID"`
-		MediaURL        string `json:"media_url"`
-		URL             string `json:"url"`
-		MessageText     string `json:"message_text"`
-		SenderID        string `json:"sender_id"`
-		Text            string `json:"text"`
-		S3bucket        string `json:"s3_bucket"`
-		S3path          string `json:"s3_path"`
+		ID                 string `json:"id"`
+		CreateTimestamp    int64  `json:"create_timestamp"`
+		MediaID            string `json:"mediaID"`
+		MediaURL           string `json:"media_url"`
+		URL                string `json:"url"`
+		MessageText        string `json:"message_text"`
+		SenderID           string `json:"sender_id"`
+		Text               string `json:"text"`
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
+		S3bucket           string `json:"s3_bucket"`
+		S3path             string `json:"s3_path"`
+		Transient          bool   `json:"transient"`
+		Checksum           string `json:"sha256,omitempty"`
+		SimilarTo          string `json:"similar_to,omitempty"`
+		Flagged            bool   `json:"flagged,omitempty"`
 	}
 	// OutDirectMessageEvent ..
 	OutDirectMessageEvent struct {
-		CreateTimestamp int64  `json:"create_timestamp"`
-		MediaID         string `json:"mediaID"`
-		MediaURL        string `json:"media_url"`
-		URL             string `json:"url"`
-		MessageText     string `json:"message_text"`
-		SenderID        string `json:"sender_id"`
-		Text            string `json:"text"`
-		S3bucket        string `json:"s3_bucket"`
-		S3path          string `json:"s3_path"`
-		Faces           []*rekognition.FaceDetail
+		ID                 string `json:"id"`
+		CreateTimestamp    int64  `json:"create_timestamp"`
+		MediaID            string `json:"mediaID"`
+		MediaURL           string `json:"media_url"`
+		URL                string `json:"url"`
+		MessageText        string `json:"message_text"`
+		SenderID           string `json:"sender_id"`
+		Text               string `json:"text"`
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
+		S3bucket           string `json:"s3_bucket"`
+		S3path             string `json:"s3_path"`
+		Transient          bool   `json:"transient"`
+		Checksum           string `json:"sha256,omitempty"`
+		SimilarTo          string `json:"similar_to,omitempty"`
+		Flagged            bool   `json:"flagged,omitempty"`
+		Faces              []*rekognition.FaceDetail
 	}
 	// OutEvent event out from this function to next step
 	OutEvent struct {
+		RequestID           string                  `json:"request-id"`
+		ForUserID           string                  `json:"for-user-id"`
 		DirectMessageEvents []OutDirectMessageEvent `json:"direct-message-events"`
+		Trace               string                  `json:"trace,omitempty"`
 	}
 )
 
-var (
-	s3Svc   *s3.S3
-	rekoSvc *rekognition.Rekognition
-)
+// handler describes the faces in the stored pictures
+type handler struct {
+	clients   account.ClientSource
+	pictures  *picturestore.Store
+	rekoSvc   rekognitioniface.RekognitionAPI
+	index     pictureindex.Index
+	cache     analysiscache.Cache
+	forgetter *forget.Forgetter
+	logger    *logging.Logger
+	recorder  metrics.Recorder
+	tracer    *trace.Tracer
+}
+
+// newHandler returns a handler reading the pictures from pictures, reusing the
+// analyses in cache and deleting transient pictures with forgetter. Logs,
+// metrics and spans are discarded until set.
+func newHandler(clients account.ClientSource, pictures *picturestore.Store, rekoSvc rekognitioniface.RekognitionAPI, index pictureindex.Index, cache analysiscache.Cache, forgetter *forget.Forgetter) *handler {
+	return &handler{
+		clients:   clients,
+		pictures:  pictures,
+		rekoSvc:   rekoSvc,
+		index:     index,
+		cache:     cache,
+		forgetter: forgetter,
+		logger:    logging.New(ioutil.Discard, "twitter-rekognition", logging.LevelError),
+		recorder:  metrics.Nop{},
+		tracer:    trace.New("twitter-rekognition", trace.Nop{}),
+	}
+}
+
+// fromConfig returns the handler of the lambda, with the AWS services of cfg.
+func fromConfig(cfg config.Config) (*handler, error) {
+	logger := logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	logger.Redact(cfg.Twitter.ConsumerSecret, cfg.Twitter.OAuthSecret)
+	recorder := metrics.New(cfg.Features.Metrics)
+
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
+	}
 
-func init() {
-	s3Svc = s3.New(session.New(&aws.Config{
-		Region: aws.String(endpoints.EuNorth1RegionID),
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
 	}))
+	s3Svc := s3.New(sess)
+	dynamodbSvc := dynamodb.New(sess)
+
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
+	}
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	clients := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits)
+	clients.Observe = ratelimit.Budget(recorder)
+
+	var keys picturestore.KeyProvider
+	if cfg.Pictures.KMSKeyID != "" {
+		keys = picturestore.NewKMSKeyProvider(kms.New(sess), cfg.Pictures.KMSKeyID)
+	}
+	pictures, err := picturestore.New(cfg.Pictures.Config, s3Svc, keys)
+	if err != nil {
+		return nil, err
+	}
 
-	rekoSvc = rekognition.New(session.New(
+	rekoSvc := rekognition.New(trace.Session(session.New(
 		&aws.Config{
-			Region: aws.String(endpoints.EuWest1RegionID),
+			Region: aws.String(cfg.RekognitionRegion),
 		},
-	))
+	)))
+
+	var index pictureindex.Index
+	if cfg.Tables.PictureIndex != "" {
+		index = pictureindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PictureIndex)
+	} else {
+		index = pictureindex.NewMemoryIndex()
+	}
+
+	var hashes phashindex.Index
+	if cfg.Tables.PerceptualHash != "" {
+		hashes = phashindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PerceptualHash)
+	} else {
+		hashes = phashindex.NewMemoryIndex()
+	}
+
+	cache := analysiscache.NewS3Cache(pictures, cfg.Pictures.Bucket)
+	// the forgetter only deletes objects, there are no conversations to forget
+	h := newHandler(clients, pictures, rekoSvc, index, cache, forget.New(s3Svc, index, hashes, nil))
+	h.logger = logger
+	h.recorder = recorder
+	h.tracer = trace.New("twitter-rekognition", exporter)
+	return h, nil
 }
 
-// Handler lambda handler function
-func Handler(events Event) (OutEvent, error) {
+// Handle is the lambda handler function
+func (h *handler) Handle(ctx context.Context, events Event) (OutEvent, error) {
+	ctx, span := h.tracer.Continue(ctx, "twitter-rekognition", events.Trace)
+	defer span.End()
+
+	log := h.logger.WithRequest(events.RequestID).With(logging.FieldForUserID, events.ForUserID)
+	client, acct, err := h.clients.Get(ctx, events.ForUserID)
+	if err != nil {
+		log.Error("failed to get account", "error", err)
+		return OutEvent{}, fmt.Errorf("GET_ACCOUNT_FAILED")
+	}
+
 	outDirectMessageEvent := make([]OutDirectMessageEvent, 0)
 
 	for _, event := range events.DirectMessageEvents {
-		fmt.Println("*****START PROCESSING EVENT*****")
-		picture, err := getImageS3(event.S3bucket, event.S3path)
-		if err != nil {
-			fmt.Printf("Failed to get picture from s3. Got error: %v\n", err)
+		if event.S3path == "" {
+			outDirectMessageEvent = append(outDirectMessageEvent, OutDirectMessageEvent{
+				ID:                 event.ID,
+				CreateTimestamp:    event.CreateTimestamp,
+				MediaID:            event.MediaID,
+				MediaURL:           event.MediaURL,
+				MessageText:        event.MessageText,
+				SenderID:           event.SenderID,
+				Text:               event.Text,
+				QuickReplyMetadata: event.QuickReplyMetadata,
+				Checksum:           event.Checksum,
+				Flagged:            event.Flagged,
+			})
+			continue
+		}
+
+		ctx := logging.NewContext(ctx, log.WithDM(event.ID, event.SenderID))
+		if !acct.Enabled(account.AnalysisFaces) {
+			// the account does not describe faces, the picture is only kept
+			// for the quick reply actions
+			outDirectMessageEvent = append(outDirectMessageEvent, OutDirectMessageEvent{
+				ID:                 event.ID,
+				CreateTimestamp:    event.CreateTimestamp,
+				MediaID:            event.MediaID,
+				MediaURL:           event.MediaURL,
+				URL:                event.URL,
+				MessageText:        event.MessageText,
+				SenderID:           event.SenderID,
+				Text:               event.Text,
+				QuickReplyMetadata: event.QuickReplyMetadata,
+				S3bucket:           event.S3bucket,
+				S3path:             event.S3path,
+				Transient:          event.Transient,
+				Checksum:           event.Checksum,
+				SimilarTo:          event.SimilarTo,
+			})
+			continue
 		}
 
-		faceDetails, err := detectFaces(picture)
+		// detection takes a while, keep the typing indicator up
+		twitter.Working(ctx, client, "", event.SenderID)
+		faceDetails, cached, err := h.faces(ctx, event)
+		if err != nil {
+			return OutEvent{}, err
+		}
 
 		o := OutDirectMessageEvent{
-			CreateTimestamp: event.CreateTimestamp,
-			MediaID:         event.MediaID,
-			MediaURL:        event.MediaURL,
-			URL:             event.URL,
-			MessageText:     event.MessageText,
-			SenderID:        event.SenderID,
-			Text:            event.Text,
-			S3bucket:        event.S3bucket,
-			S3path:          event.S3path,
-			Faces:           faceDetails,
+			ID:                 event.ID,
+			CreateTimestamp:    event.CreateTimestamp,
+			MediaID:            event.MediaID,
+			MediaURL:           event.MediaURL,
+			URL:                event.URL,
+			MessageText:        event.MessageText,
+			SenderID:           event.SenderID,
+			Text:               event.Text,
+			QuickReplyMetadata: event.QuickReplyMetadata,
+			S3bucket:           event.S3bucket,
+			S3path:             event.S3path,
+			Transient:          event.Transient,
+			Checksum:           event.Checksum,
+			SimilarTo:          event.SimilarTo,
+			Faces:              faceDetails,
 		}
 
-		buffOfFaceDetails, err := json.Marshal(faceDetails)
-		if err != nil {
-			fmt.Printf("Marshal facedetails failed with error: %v \n", err)
+		if event.Transient {
+			// the sender has turned retention off, neither the picture nor
+			// the analysis is kept once the faces are detected. The picture
+			// is kept when another sender sent it too.
+			picture := pictureindex.Object{Bucket: event.S3bucket, Key: event.S3path}
+			if err := h.forgetter.ForgetObjects(ctx, events.ForUserID, event.SenderID, []pictureindex.Object{picture}); err != nil {
+				logging.FromContext(ctx).Error("failed to delete picture from s3", "error", err)
+			}
+			outDirectMessageEvent = append(outDirectMessageEvent, o)
+			continue
 		}
 
-		_, err = s3Svc.PutObject(
-			&s3.PutObjectInput{
-				Bucket:      aws.String(event.S3bucket),
-				Body:        bytes.NewReader(buffOfFaceDetails),
-				Key:         aws.String(fmt.Sprintf("%s.json", event.S3path)),
-				ContentType: aws.String("text/plain"),
-			},
-		)
-		if err != nil {
-			fmt.Printf("Failed to put object got error: %v\n", err)
+		if cached {
+			// the analysis is shared by everyone who sent the picture, the
+			// sender's entry keeps it from being deleted with another's
+			owner := pictureindex.Owner{ForUserID: events.ForUserID, SenderID: event.SenderID}
+			err = h.index.Add(ctx, owner, pictureindex.Object{
+				Bucket: event.S3bucket,
+				Key:    analysiscache.Key(event.Checksum, retention.AnalysisFaces),
+			})
+			if err != nil {
+				logging.FromContext(ctx).Error("failed to index face details", "error", err)
+				return OutEvent{}, fmt.Errorf("INDEX_FACEDETAILS_FAILED")
+			}
 		}
 
 		outDirectMessageEvent = append(outDirectMessageEvent, o)
 
 	}
 	return OutEvent{
+		RequestID:           events.RequestID,
+		ForUserID:           events.ForUserID,
 		DirectMessageEvents: outDirectMessageEvent,
+		Trace:               trace.Traceparent(ctx),
 	}, nil
 
 }
 
-func getImageS3(bucket string, key string) (*[]byte, error) {
-	data, err := s3Svc.GetObject(
-		&s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		},
-	)
+// getImageS3 reads the picture back, decrypting it when it was stored with
+// envelope encryption.
+func (h *handler) getImageS3(ctx context.Context, bucket string, key string) (*[]byte, error) {
+	picture, err := h.pictures.Get(ctx, bucket, key)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to get picture from s3", "error", err)
+		return nil, fmt.Errorf("GET_IMAGE_S3_FAILED")
+	}
+	logging.FromContext(ctx).Debug("got picture", "bytes", len(picture))
+	return &picture, nil
+}
+
+// faces returns the faces in the picture of event and whether they are in
+// the cache. A picture analysed before, or a near-duplicate of one, is not
+// sent to Rekognition again, its faces are read from the cache. The boxes of
+// faces are relative to the picture's size, they fit a resized copy too. New
+// results are cached unless the sender keeps nothing. A failed detection is
+// returned, as RetryableError when Rekognition may recover.
+func (h *handler) faces(ctx context.Context, event InDirectMessageEvent) ([]*rekognition.FaceDetail, bool, error) {
+	if event.Checksum != "" {
+		if faces, ok := h.cachedFaces(ctx, event.Checksum); ok {
+			return faces, true, nil
+		}
+	}
+	if event.SimilarTo != "" {
+		if faces, ok := h.cachedFaces(ctx, event.SimilarTo); ok {
+			// cached for this picture too, so the analysis is deleted with
+			// it and not with the near-duplicate
+			return faces, h.cacheFaces(ctx, event, faces), nil
+		}
+	}
+
+	picture, err := h.getImageS3(ctx, event.S3bucket, event.S3path)
 	if err != nil {
-		fmt.Printf("Failed to get picture from s3. Got error: %v\n", err)
+		return nil, false, err
 	}
-	defer data.Body.Close()
-	fmt.Printf("Contentlength: %v etag: %v\n", *data.ContentLength, *data.ETag)
-	picture, err := ioutil.ReadAll(data.Body)
+	faces, err := h.detectFaces(ctx, picture)
 	if err != nil {
-		fmt.Printf("Failed to read data.Body. Got error: %v\n", err)
+		return nil, false, detectError(err)
 	}
-	return &picture, nil
+	return faces, h.cacheFaces(ctx, event, faces), nil
+}
+
+// cacheFaces caches the faces of the picture of event, unless the sender
+// keeps nothing, and reports whether they are cached.
+func (h *handler) cacheFaces(ctx context.Context, event InDirectMessageEvent, faces []*rekognition.FaceDetail) bool {
+	if event.Checksum == "" || event.Transient {
+		return false
+	}
+	result, err := json.Marshal(faces)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to marshal face details", "error", err)
+		return false
+	}
+	if err := h.cache.Put(ctx, event.Checksum, retention.AnalysisFaces, result); err != nil {
+		logging.FromContext(ctx).Error("failed to put face details", "error", err)
+		return false
+	}
+	return true
+}
+
+// cachedFaces returns the faces cached for checksum. A cache that fails is
+// treated as a miss, the picture is analysed again.
+func (h *handler) cachedFaces(ctx context.Context, checksum string) ([]*rekognition.FaceDetail, bool) {
+	result, ok, err := h.cache.Get(ctx, checksum, retention.AnalysisFaces)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to get cached face details", "error", err)
+		return nil, false
+	}
+	var faces []*rekognition.FaceDetail
+	if ok {
+		if err := json.Unmarshal(result, &faces); err != nil {
+			logging.FromContext(ctx).Error("failed to unmarshal cached face details", "error", err)
+			ok = false
+		}
+	}
+	if !ok {
+		metrics.Count(h.recorder, metrics.AnalysisCacheMisses, 1, "Analysis", retention.AnalysisFaces)
+		return nil, false
+	}
+	metrics.Count(h.recorder, metrics.AnalysisCacheHits, 1, "Analysis", retention.AnalysisFaces)
+	logging.FromContext(ctx).Debug("reused face details", "sha256", checksum, "faces", len(faces))
+	return faces, true
 }
 
-func detectFaces(picture *[]byte) ([]*rekognition.FaceDetail, error) {
+func (h *handler) detectFaces(ctx context.Context, picture *[]byte) ([]*rekognition.FaceDetail, error) {
 	input := &rekognition.DetectFacesInput{
 		Attributes: []*string{aws.String("ALL")},
 		Image: &rekognition.Image{
@@ -148,38 +398,33 @@ func detectFaces(picture *[]byte) ([]*rekognition.FaceDetail, error) {
 		},
 	}
 
-	result, err := rekoSvc.DetectFaces(input)
+	start := time.Now()
+	result, err := h.rekoSvc.DetectFacesWithContext(ctx, input)
+	metrics.Since(h.recorder, metrics.RekognitionLatency, start, "Operation", "DetectFaces")
 	if err != nil {
+		code := "Unknown"
 		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case rekognition.ErrCodeInvalidS3ObjectException:
-				fmt.Println(rekognition.ErrCodeInvalidS3ObjectException, aerr.Error())
-			case rekognition.ErrCodeInvalidParameterException:
-				fmt.Println(rekognition.ErrCodeInvalidParameterException, aerr.Error())
-			case rekognition.ErrCodeImageTooLargeException:
-				fmt.Println(rekognition.ErrCodeImageTooLargeException, aerr.Error())
-			case rekognition.ErrCodeAccessDeniedException:
-				fmt.Println(rekognition.ErrCodeAccessDeniedException, aerr.Error())
-			case rekognition.ErrCodeInternalServerError:
-				fmt.Println(rekognition.ErrCodeInternalServerError, aerr.Error())
-			case rekognition.ErrCodeThrottlingException:
-				fmt.Println(rekognition.ErrCodeThrottlingException, aerr.Error())
-			case rekognition.ErrCodeProvisionedThroughputExceededException:
-				fmt.Println(rekognition.ErrCodeProvisionedThroughputExceededException, aerr.Error())
-			case rekognition.ErrCodeInvalidImageFormatException:
-				fmt.Println(rekognition.ErrCodeInvalidImageFormatException, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+			code = aerr.Code()
 		}
+		metrics.Count(h.recorder, metrics.RekognitionErrors, 1, "Operation", "DetectFaces", "Code", code)
+		logging.FromContext(ctx).Error("failed to detect faces", "code", code, "error", err)
+		return nil, err
 	}
+	metrics.Count(h.recorder, metrics.FacesDetected, len(result.FaceDetails))
 	return result.FaceDetails, nil
 }
 
 func main() {
-	lambda.Start(Handler)
+	cfg, err := config.FromEnv("twitter-rekognition")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret, config.KeyPictureBucket); err != nil {
+		log.Fatal(err)
+	}
+	h, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(h.Handle)
 }
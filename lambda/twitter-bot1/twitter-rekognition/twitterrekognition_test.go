@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+	"github.com/aws/aws-sdk-go/service/rekognition/rekognitioniface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/analysiscache"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+)
+
+// fakeTwitter answers every request with no content
+type fakeTwitter struct{}
+
+func (fakeTwitter) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+}
+
+type fakeClients struct {
+	account account.Account
+}
+
+func (f fakeClients) Get(ctx context.Context, userID string) (*http.Client, account.Account, error) {
+	return &http.Client{Transport: fakeTwitter{}}, f.account, nil
+}
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func (f *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	body, _ := ioutil.ReadAll(input.Body)
+	f.objects[aws.StringValue(input.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	for _, id := range input.Delete.Objects {
+		delete(f.objects, aws.StringValue(id.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+type fakeRekognition struct {
+	rekognitioniface.RekognitionAPI
+	faces int
+	calls int
+}
+
+func (f *fakeRekognition) DetectFacesWithContext(ctx aws.Context, input *rekognition.DetectFacesInput, opts ...request.Option) (*rekognition.DetectFacesOutput, error) {
+	f.calls++
+	out := &rekognition.DetectFacesOutput{}
+	for i := 0; i < f.faces; i++ {
+		out.FaceDetails = append(out.FaceDetails, &rekognition.FaceDetail{Confidence: aws.Float64(99)})
+	}
+	return out, nil
+}
+
+func TestHandle(t *testing.T) {
+	const checksum = "5b0cd2c9b4be4ba9e9eab6e1ba4d4da5d0c4fbd2b5ad9e5c1b32fba54a89c6b1"
+	key := picturestore.ContentKey(checksum, ".jpg")
+	analysis := analysiscache.Key(checksum, retention.AnalysisFaces)
+	// similarTo a near-duplicate of the picture analysed before
+	const similarTo = "9f2a6c1e0b7d4e3f8a5c2b1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f"
+	similarAnalysis := analysiscache.Key(similarTo, retention.AnalysisFaces)
+
+	tt := []struct {
+		name      string
+		analyses  []string
+		transient bool
+		// cached faces found in the cache
+		cached int
+		// similar when the cached faces are those of a near-duplicate
+		similar bool
+		// sharedWith another sender who sent the same picture
+		sharedWith string
+		detected   int
+		calls      int
+		faces      int
+		objects    []string
+		indexed    int
+	}{
+		{name: "faces", detected: 2, calls: 1, faces: 2, objects: []string{key, analysis}, indexed: 2},
+		{name: "cached", cached: 3, detected: 2, calls: 0, faces: 3, objects: []string{key, analysis}, indexed: 2},
+		{name: "nearDuplicate", cached: 3, similar: true, detected: 2, calls: 0, faces: 3, objects: []string{key, analysis, similarAnalysis}, indexed: 2},
+		{name: "transient", transient: true, detected: 1, calls: 1, faces: 1, objects: []string{}, indexed: 0},
+		{name: "transientShared", transient: true, sharedWith: "4337869213", detected: 1, calls: 1, faces: 1, objects: []string{key}, indexed: 0},
+		{name: "facesDisabled", analyses: []string{account.AnalysisLabels}, detected: 1, objects: []string{key}, indexed: 1},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			s3Svc := &fakeS3{objects: map[string][]byte{key: []byte("\xff\xd8\xff\xe0")}}
+			pictures, err := picturestore.New(picturestore.Config{}, s3Svc, nil)
+			if err != nil {
+				t.Fatalf("picturestore.New failed with error: %v", err)
+			}
+			cache := analysiscache.NewS3Cache(pictures, "pictures")
+			if tc.cached > 0 {
+				faces := make([]*rekognition.FaceDetail, 0, tc.cached)
+				for i := 0; i < tc.cached; i++ {
+					faces = append(faces, &rekognition.FaceDetail{Confidence: aws.Float64(99)})
+				}
+				result, _ := json.Marshal(faces)
+				if tc.similar {
+					cache.Put(ctx, similarTo, retention.AnalysisFaces, result)
+				} else {
+					cache.Put(ctx, checksum, retention.AnalysisFaces, result)
+				}
+			}
+			event := InDirectMessageEvent{
+				ID:        "954491830116155396",
+				SenderID:  "3805104374",
+				MediaID:   "954491830116155396",
+				S3bucket:  "pictures",
+				S3path:    key,
+				Transient: tc.transient,
+				Checksum:  checksum,
+			}
+			if tc.similar {
+				event.SimilarTo = similarTo
+			}
+			rekoSvc := &fakeRekognition{faces: tc.detected}
+			index := pictureindex.NewMemoryIndex()
+			sender := pictureindex.Owner{ForUserID: "4337869213", SenderID: "3805104374"}
+			index.Add(ctx, sender, pictureindex.Object{Bucket: "pictures", Key: key})
+			if tc.sharedWith != "" {
+				index.Add(ctx, pictureindex.Owner{ForUserID: "4337869213", SenderID: tc.sharedWith}, pictureindex.Object{Bucket: "pictures", Key: key})
+			}
+
+			h := newHandler(fakeClients{account: account.Account{Analyses: tc.analyses}}, pictures, rekoSvc, index, cache, forget.New(s3Svc, index, phashindex.NewMemoryIndex(), nil))
+			out, err := h.Handle(ctx, Event{RequestID: "r1", ForUserID: "4337869213", DirectMessageEvents: []InDirectMessageEvent{event}})
+			if err != nil {
+				t.Fatalf("Handle failed with error: %v", err)
+			}
+
+			if got := len(out.DirectMessageEvents[0].Faces); got != tc.faces || rekoSvc.calls != tc.calls {
+				t.Fatalf("got: %v faces %v calls, wanted: %v %v", got, rekoSvc.calls, tc.faces, tc.calls)
+			}
+			for _, k := range tc.objects {
+				if _, ok := s3Svc.objects[k]; !ok {
+					t.Fatalf("got: %v, wanted: %v stored", s3Svc.objects, k)
+				}
+			}
+			if len(s3Svc.objects) != len(tc.objects) {
+				t.Fatalf("got: %v objects, wanted: %v", len(s3Svc.objects), len(tc.objects))
+			}
+			objects, _ := index.List(ctx, sender)
+			if len(objects) != tc.indexed {
+				t.Fatalf("got: %v indexed, wanted: %v", len(objects), tc.indexed)
+			}
+		})
+	}
+}
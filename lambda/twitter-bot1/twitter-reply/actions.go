@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/analysiscache"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/blur"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/command"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// optionTemplates label template of each action offered as a quick reply
+var optionTemplates = map[string]string{
+	command.ShowLabels:  reply.TemplateOptionShowLabels,
+	command.BlurFaces:   reply.TemplateOptionBlurFaces,
+	command.DeletePhoto: reply.TemplateOptionDeletePhoto,
+}
+
+// actionAnalyses analysis an account must enable for an action
+var actionAnalyses = map[string]string{
+	command.ShowLabels: account.AnalysisLabels,
+	command.BlurFaces:  account.AnalysisBlur,
+}
+
+// quickReplies returns the actions offered with the analysis of the last
+// picture, leaving out actions the account has not enabled. Nothing is
+// offered when the picture was not kept.
+func (r *replier) quickReplies(state conversation.State) []twitter.QuickReplyOption {
+	a := state.LastAnalysis
+	if a == nil || a.S3path == "" {
+		return nil
+	}
+
+	names := []string{command.ShowLabels}
+	if len(a.Faces) > 0 {
+		names = append(names, command.BlurFaces)
+	}
+	names = append(names, command.DeletePhoto)
+
+	options := make([]twitter.QuickReplyOption, 0, len(names))
+	for _, name := range names {
+		if !r.enabled(name) {
+			continue
+		}
+		options = append(options, twitter.QuickReplyOption{
+			Label:    r.render(state.Preferences, optionTemplates[name], nil),
+			Metadata: name,
+		})
+	}
+	return options
+}
+
+func isAction(cmd command.Command) bool {
+	_, ok := optionTemplates[cmd.Name]
+	return ok
+}
+
+// enabled is true when the account has enabled the analysis action needs.
+func (r *replier) enabled(action string) bool {
+	analysis, ok := actionAnalyses[action]
+	return !ok || r.account.Enabled(analysis)
+}
+
+// actionMessage runs an action on the sender's last picture and returns the
+// answer.
+func (r *replier) actionMessage(ctx context.Context, state *conversation.State, cmd command.Command) (message, error) {
+	prefs := state.Preferences
+	a := state.LastAnalysis
+	if a == nil {
+		return message{text: r.render(prefs, reply.TemplateSendPicture, nil)}, nil
+	}
+	if a.S3path == "" {
+		return message{text: r.render(prefs, reply.TemplatePictureGone, nil)}, nil
+	}
+
+	if !r.enabled(cmd.Name) {
+		return message{text: r.render(prefs, reply.TemplateHelp, nil)}, nil
+	}
+
+	switch cmd.Name {
+	case command.ShowLabels:
+		return r.showLabels(ctx, state.SenderID, a, prefs)
+	case command.BlurFaces:
+		return r.blurFaces(ctx, a, prefs)
+	case command.DeletePhoto:
+		return r.deletePhoto(ctx, state)
+	}
+	return message{text: r.render(prefs, reply.TemplateHelp, nil)}, nil
+}
+
+func (r *replier) showLabels(ctx context.Context, senderID string, a *conversation.Analysis, prefs conversation.Preferences) (message, error) {
+	labels, err := r.labels(ctx, senderID, a)
+	if err != nil {
+		return message{}, err
+	}
+
+	data := reply.LabelsData{Labels: make([]reply.LabelData, 0, len(labels))}
+	for _, l := range labels {
+		data.Labels = append(data.Labels, reply.LabelData{
+			Name:       aws.StringValue(l.Name),
+			Confidence: int(math.Round(aws.Float64Value(l.Confidence))),
+		})
+	}
+	return message{text: r.render(prefs, reply.TemplateLabels, data)}, nil
+}
+
+// labels returns the labels of the picture of a. Labels detected before for
+// the same picture or a near-duplicate of it, by any sender, are read from
+// the cache; new ones are cached and indexed for senderID. A failing cache
+// only costs a detection.
+func (r *replier) labels(ctx context.Context, senderID string, a *conversation.Analysis) ([]*rekognition.Label, error) {
+	if a.Checksum != "" {
+		if labels, ok := r.cachedLabels(ctx, a.Checksum); ok {
+			return labels, r.indexAnalysis(ctx, senderID, a, retention.AnalysisLabels)
+		}
+		if a.SimilarTo != "" {
+			if labels, ok := r.cachedLabels(ctx, a.SimilarTo); ok {
+				// cached for this picture too, so the labels are deleted
+				// with it and not with the near-duplicate
+				return labels, r.cacheLabels(ctx, senderID, a, labels)
+			}
+		}
+	}
+
+	picture, err := r.pictures.Get(ctx, a.S3bucket, a.S3path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.rekoSvc.DetectLabelsWithContext(ctx, &rekognition.DetectLabelsInput{
+		Image:         &rekognition.Image{Bytes: picture},
+		MaxLabels:     aws.Int64(int64(r.thresholds.MaxLabels)),
+		MinConfidence: aws.Float64(float64(r.thresholds.MinConfidence)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("detect labels: %v", err)
+	}
+	if a.Checksum == "" {
+		return out.Labels, nil
+	}
+	return out.Labels, r.cacheLabels(ctx, senderID, a, out.Labels)
+}
+
+// cachedLabels returns the cached labels of the picture with checksum.
+func (r *replier) cachedLabels(ctx context.Context, checksum string) ([]*rekognition.Label, bool) {
+	result, ok, err := r.cache.Get(ctx, checksum, retention.AnalysisLabels)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to get cached labels", "error", err)
+	}
+	var labels []*rekognition.Label
+	if ok && json.Unmarshal(result, &labels) == nil {
+		metrics.Count(r.recorder, metrics.AnalysisCacheHits, 1, "Analysis", retention.AnalysisLabels)
+		return labels, true
+	}
+	metrics.Count(r.recorder, metrics.AnalysisCacheMisses, 1, "Analysis", retention.AnalysisLabels)
+	return nil, false
+}
+
+// cacheLabels caches the labels of the picture of a and indexes them for
+// senderID, a failing cache is only logged.
+func (r *replier) cacheLabels(ctx context.Context, senderID string, a *conversation.Analysis, labels []*rekognition.Label) error {
+	result, err := json.Marshal(labels)
+	if err == nil {
+		err = r.cache.Put(ctx, a.Checksum, retention.AnalysisLabels, result)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to put labels", "error", err)
+		return nil
+	}
+	return r.indexAnalysis(ctx, senderID, a, retention.AnalysisLabels)
+}
+
+// indexAnalysis records that senderID uses the cached analysis of the picture
+// of a, it is kept until every sender of the picture has deleted it.
+func (r *replier) indexAnalysis(ctx context.Context, senderID string, a *conversation.Analysis, analysis string) error {
+	owner := pictureindex.Owner{ForUserID: r.account.UserID, SenderID: senderID}
+	return r.index.Add(ctx, owner, pictureindex.Object{
+		Bucket: a.S3bucket,
+		Key:    analysiscache.Key(a.Checksum, analysis),
+	})
+}
+
+func (r *replier) blurFaces(ctx context.Context, a *conversation.Analysis, prefs conversation.Preferences) (message, error) {
+	boxes := make([]blur.Box, 0, len(a.Faces))
+	for _, f := range a.Faces {
+		if f.Box != nil {
+			boxes = append(boxes, blur.Box{Left: f.Box.Left, Top: f.Box.Top, Width: f.Box.Width, Height: f.Box.Height})
+		}
+	}
+	if len(boxes) == 0 {
+		return message{text: r.render(prefs, reply.TemplateNoFaces, nil)}, nil
+	}
+
+	picture, err := r.pictures.Get(ctx, a.S3bucket, a.S3path)
+	if err != nil {
+		return message{}, err
+	}
+	blurred, err := blur.Regions(picture, boxes)
+	if err != nil {
+		return message{}, err
+	}
+	mediaID, err := twitter.UploadMedia(ctx, r.client, blurred)
+	if err != nil {
+		return message{}, err
+	}
+	return message{
+		text:    r.render(prefs, reply.TemplateBlurred, nil),
+		mediaID: mediaID,
+	}, nil
+}
+
+// deletePhoto deletes the last picture and its analyses, unless another
+// sender sent the same picture. The faces are kept in the conversation so
+// follow-up questions still work.
+func (r *replier) deletePhoto(ctx context.Context, state *conversation.State) (message, error) {
+	a := state.LastAnalysis
+	objects := []pictureindex.Object{
+		{Bucket: a.S3bucket, Key: a.S3path},
+	}
+	if a.Checksum != "" {
+		for _, analysis := range []string{retention.AnalysisFaces, retention.AnalysisLabels} {
+			objects = append(objects, pictureindex.Object{Bucket: a.S3bucket, Key: analysiscache.Key(a.Checksum, analysis)})
+		}
+	} else {
+		// stored before pictures were stored by content
+		objects = append(objects, pictureindex.Object{Bucket: a.S3bucket, Key: fmt.Sprintf("%s.json", a.S3path)})
+	}
+	if err := r.forgetter.ForgetObjects(ctx, state.ForUserID, state.SenderID, objects); err != nil {
+		return message{}, err
+	}
+	a.S3bucket = ""
+	a.S3path = ""
+	a.Checksum = ""
+	a.SimilarTo = ""
+	return message{text: r.render(state.Preferences, reply.TemplatePhotoDeleted, nil)}, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+// RetryableError a failure the state machine retries. Step Functions matches
+// the error type name, RetryableError, in the TwitterDmReply Retry rule.
+type RetryableError struct {
+	Code string
+}
+
+// Error implements error.
+func (e *RetryableError) Error() string {
+	return e.Code
+}
+
+// sendError returns the lambda error for a direct message that could not be
+// sent.
+func sendError(err error) error {
+	apiErr, ok := err.(*twitter.APIError)
+	if !ok {
+		return fmt.Errorf("SEND_DM_FAILED")
+	}
+	switch apiErr.Kind {
+	case twitter.ErrorRateLimited:
+		return &RetryableError{Code: "TWITTER_RATE_LIMITED"}
+	case twitter.ErrorServer:
+		return &RetryableError{Code: "TWITTER_SERVER_ERROR"}
+	case twitter.ErrorTransport:
+		return &RetryableError{Code: "TWITTER_UNAVAILABLE"}
+	case twitter.ErrorForbidden:
+		return fmt.Errorf("SEND_DM_FORBIDDEN")
+	}
+	return fmt.Errorf("SEND_DM_FAILED")
+}
+
+// isForbidden is true when the recipient does not accept direct messages
+// from the bot.
+func isForbidden(err error) bool {
+	apiErr, ok := err.(*twitter.APIError)
+	return ok && apiErr.Kind == twitter.ErrorForbidden
+}
+
+// isRetryable is true when sending again later may succeed.
+func isRetryable(err error) bool {
+	apiErr, ok := err.(*twitter.APIError)
+	return ok && apiErr.Retryable()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
+)
+
+func TestSendError(t *testing.T) {
+	tt := []struct {
+		name      string
+		err       error
+		out       string
+		retryable bool
+	}{
+		{name: "rateLimited", err: &twitter.APIError{Kind: twitter.ErrorRateLimited}, out: "TWITTER_RATE_LIMITED", retryable: true},
+		{name: "serverError", err: &twitter.APIError{Kind: twitter.ErrorServer}, out: "TWITTER_SERVER_ERROR", retryable: true},
+		{name: "transport", err: &twitter.APIError{Kind: twitter.ErrorTransport}, out: "TWITTER_UNAVAILABLE", retryable: true},
+		{name: "forbidden", err: &twitter.APIError{Kind: twitter.ErrorForbidden}, out: "SEND_DM_FORBIDDEN"},
+		{name: "badRequest", err: &twitter.APIError{Kind: twitter.ErrorRequest}, out: "SEND_DM_FAILED"},
+		{name: "other", err: fmt.Errorf("marshal direct message"), out: "SEND_DM_FAILED"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := sendError(tc.err)
+			_, retryable := err.(*RetryableError)
+			if err.Error() != tc.out || retryable != tc.retryable {
+				t.Fatalf("got: %v %v, wanted: %v %v", err, retryable, tc.out, tc.retryable)
+			}
+		})
+	}
+}
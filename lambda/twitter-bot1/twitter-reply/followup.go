@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+)
+
+var (
+	ordinals = map[string]int{
+		"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+		"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	}
+	ordinalFaceRe = regexp.MustCompile(`\b(first|second|third|fourth|fifth|sixth|seventh|eighth|ninth|tenth|last|\d+(?:st|nd|rd|th)) (?:face|one|person)\b`)
+	numberFaceRe  = regexp.MustCompile(`\bface:? ?#?(\d+)\b`)
+	howManyRe     = regexp.MustCompile(`\bhow many\b`)
+)
+
+// faceReference finds which face of the last analysis text asks about, e.g.
+// "what about the second face?" or "face 2". The returned index is zero
+// based, like the face numbers in the reply. last is true for "the last face".
+func faceReference(text string) (index int, last bool, ok bool) {
+	text = strings.ToLower(text)
+
+	if m := ordinalFaceRe.FindStringSubmatch(text); m != nil {
+		if m[1] == "last" {
+			return 0, true, true
+		}
+		if n, found := ordinals[m[1]]; found {
+			return n - 1, false, true
+		}
+		n, err := strconv.Atoi(strings.TrimRight(m[1], "stndrh"))
+		if err == nil && n > 0 {
+			return n - 1, false, true
+		}
+	}
+	if m := numberFaceRe.FindStringSubmatch(text); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err == nil {
+			return n, false, true
+		}
+	}
+	return 0, false, false
+}
+
+// followUpMessage answers a text message using what is remembered about the
+// sender's last picture.
+func (r *replier) followUpMessage(state conversation.State, text string) string {
+	prefs := state.Preferences
+	if state.LastAnalysis == nil {
+		return r.render(prefs, reply.TemplateSendPicture, nil)
+	}
+	fs := state.LastAnalysis.Faces
+
+	if howManyRe.MatchString(strings.ToLower(text)) {
+		return r.render(prefs, reply.TemplateHowMany, reply.CountData{Count: len(fs)})
+	}
+
+	index, last, ok := faceReference(text)
+	if !ok {
+		return r.render(prefs, reply.TemplateAskAboutFace, nil)
+	}
+	if len(fs) == 0 {
+		return r.render(prefs, reply.TemplateNoFaces, nil)
+	}
+	if last {
+		index = len(fs) - 1
+	}
+	if index < 0 || index >= len(fs) {
+		return r.render(prefs, reply.TemplateOnlyFound, reply.CountData{Count: len(fs)})
+	}
+	return r.faceMessage(index, fs[index], prefs)
+}
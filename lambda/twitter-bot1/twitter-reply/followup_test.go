@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFaceReference(t *testing.T) {
+	tt := []struct {
+		name  string
+		text  string
+		index int
+		last  bool
+		ok    bool
+	}{
+		{name: "ordinalWord", text: "what about the second face?", index: 1, ok: true},
+		{name: "ordinalNumber", text: "And the 3rd one?", index: 2, ok: true},
+		{name: "faceNumber", text: "tell me about face:0", index: 0, ok: true},
+		{name: "faceHashNumber", text: "face #2 please", index: 2, ok: true},
+		{name: "lastFace", text: "the last person", last: true, ok: true},
+		{name: "noReference", text: "hello there", ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			index, last, ok := faceReference(tc.text)
+			if ok != tc.ok || last != tc.last || (ok && !last && index != tc.index) {
+				t.Fatalf("got: %v %v %v, wanted: %v %v %v", index, last, ok, tc.index, tc.last, tc.ok)
+			}
+		})
+	}
+}
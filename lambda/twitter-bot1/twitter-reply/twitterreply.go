@@ -1,156 +1,545 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/rekognition"
-	"github.com/dbgeek/oauth"
+	"github.com/aws/aws-sdk-go/service/rekognition/rekognitioniface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/analysiscache"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/command"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/forget"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/metrics"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/outbox"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/picturestore"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/ratelimit"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/twitter"
 )
 
 type (
 	// DirectMessageEvent ..
 	DirectMessageEvent struct {
-		CreateTimestamp int64  `json:"create_timestamp"`
-		MediaID         string `json:"mediaID"`
-		MediaURL        string `json:"media_url"`
-		URL             string `json:"url"`
-		MessageText     string `json:"message_text"`
-		SenderID        string `json:"sender_id"`
-		Text            string `json:"text"`
-		S3bucket        string `json:"s3_bucket"`
-		S3path          string `json:"s3_path"`
-		Faces           []*rekognition.FaceDetail
+		ID                 string `json:"id"`
+		CreateTimestamp    int64  `json:"create_timestamp"`
+		MediaID            string `json:"mediaID"`
+		MediaURL           string `json:"media_url"`
+		URL                string `json:"url"`
+		MessageText        string `json:"message_text"`
+		SenderID           string `json:"sender_id"`
+		Text               string `json:"text"`
+		QuickReplyMetadata string `json:"quick_reply_metadata,omitempty"`
+		S3bucket           string `json:"s3_bucket"`
+		S3path             string `json:"s3_path"`
+		Transient          bool   `json:"transient"`
+		Checksum           string `json:"sha256,omitempty"`
+		SimilarTo          string `json:"similar_to,omitempty"`
+		Flagged            bool   `json:"flagged,omitempty"`
+		Faces              []*rekognition.FaceDetail
+		// ReplyMessageIDs ids of the sent replies, set in the output
+		ReplyMessageIDs []string `json:"reply_message_ids,omitempty"`
+		// ReplyStatus outcome of the reply, set in the output
+		ReplyStatus string `json:"reply_status,omitempty"`
 	}
 	// Event event out from this function to next step
 	Event struct {
+		RequestID           string               `json:"request-id"`
+		ForUserID           string               `json:"for-user-id"`
 		DirectMessageEvents []DirectMessageEvent `json:"direct-message-events"`
+		Trace               string               `json:"trace,omitempty"`
 	}
-	// DMReplyEvent Payload
-	DMReplyEvent struct {
-		Event ReplyEvent `json:"event"`
+	// message a reply, optionally with quick reply options and an uploaded
+	// picture
+	message struct {
+		text    string
+		options []twitter.QuickReplyOption
+		mediaID string
 	}
-	// ReplyEvent ..
-	ReplyEvent struct {
-		Type          string        `json:"type"`
-		MessageCreate MessageCreate `json:"message_create"`
+	// replier answers direct messages sent to one bot account
+	replier struct {
+		*handler
+		account  account.Account
+		client   *http.Client
+		renderer *reply.Renderer
+		log      *logging.Logger
 	}
-	// MessageCreate ..
-	MessageCreate struct {
-		Target      Target      `json:"target"`
-		MessageData MessageData `json:"message_data"`
+)
+
+// Reply statuses
+const (
+	replySent        = "sent"
+	replyAlreadySent = "already-sent"
+	replyForbidden   = "forbidden"
+	replyDeferred    = "deferred"
+)
+
+// handler answers the direct messages of every bot account
+type handler struct {
+	clients      account.ClientSource
+	store        conversation.Store
+	forgetter    *forget.Forgetter
+	baseRenderer *reply.Renderer
+	pictures     *picturestore.Store
+	index        pictureindex.Index
+	cache        analysiscache.Cache
+	rekoSvc      rekognitioniface.RekognitionAPI
+	thresholds   config.Thresholds
+	// deferred replies, nil when OUTBOX_TABLE is not set and failures are
+	// retried by the state machine instead
+	deferred *outbox.Outbox
+	logger   *logging.Logger
+	recorder metrics.Recorder
+	tracer   *trace.Tracer
+}
+
+// newHandler returns a handler rendering replies with renderer, which accounts
+// may override templates of, and reusing the analyses in cache. Logs, metrics
+// and spans are discarded until set.
+func newHandler(clients account.ClientSource, store conversation.Store, forgetter *forget.Forgetter, renderer *reply.Renderer, pictures *picturestore.Store, index pictureindex.Index, cache analysiscache.Cache, rekoSvc rekognitioniface.RekognitionAPI, thresholds config.Thresholds) *handler {
+	return &handler{
+		clients:      clients,
+		store:        store,
+		forgetter:    forgetter,
+		baseRenderer: renderer,
+		pictures:     pictures,
+		index:        index,
+		cache:        cache,
+		rekoSvc:      rekoSvc,
+		thresholds:   thresholds,
+		logger:       logging.New(ioutil.Discard, "twitter-reply", logging.LevelError),
+		recorder:     metrics.Nop{},
+		tracer:       trace.New("twitter-reply", trace.Nop{}),
+	}
+}
+
+// fromConfig returns the handler of the lambda, with the AWS services of cfg.
+func fromConfig(cfg config.Config) (*handler, error) {
+	logger := logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	logger.Redact(cfg.Twitter.ConsumerSecret, cfg.Twitter.OAuthSecret)
+	recorder := metrics.New(cfg.Features.Metrics)
+
+	renderer, err := reply.New(cfg.Features.ReplyOverflow)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
 	}
-	// Target ..
-	Target struct {
-		RecipientID string `json:"recipient_id"`
+
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
+	}))
+	dynamodbSvc := dynamodb.New(sess)
+
+	var limits ratelimit.Store
+	if cfg.Tables.RateLimit != "" {
+		limits = ratelimit.NewDynamoDBStore(dynamodbSvc, cfg.Tables.RateLimit)
+	} else {
+		limits = ratelimit.NewMemoryStore()
 	}
-	// MessageData ..
-	MessageData struct {
-		Text string `json:"text"`
+	registry := account.NewRegistry(dynamodbSvc, cfg.Tables.Accounts, account.Account{
+		UserID:      cfg.Twitter.DefaultAccountID,
+		OAuthToken:  cfg.Twitter.OAuthToken,
+		OAuthSecret: cfg.Twitter.OAuthSecret,
+	})
+	clients := account.NewClients(registry, cfg.Twitter.ConsumerKey, cfg.Twitter.ConsumerSecret, limits)
+	clients.Observe = ratelimit.Budget(recorder)
+
+	var store conversation.Store
+	if cfg.Tables.Conversation != "" {
+		store = conversation.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Conversation)
+	} else {
+		store = conversation.NewMemoryStore()
 	}
 
-	face struct {
-		emotions string
-		gender   string
-		ageLow   int64
-		ageHigh  int64
+	var index pictureindex.Index
+	if cfg.Tables.PictureIndex != "" {
+		index = pictureindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PictureIndex)
+	} else {
+		index = pictureindex.NewMemoryIndex()
 	}
 
-	faces []face
-)
+	var hashes phashindex.Index
+	if cfg.Tables.PerceptualHash != "" {
+		hashes = phashindex.NewDynamoDBIndex(dynamodbSvc, cfg.Tables.PerceptualHash)
+	} else {
+		hashes = phashindex.NewMemoryIndex()
+	}
 
-var (
-	consumerSecret string
-	consumerKey    string
-	oauthSecret    string
-	oauthToken     string
-	destBucket     string
-	client         *http.Client
-)
+	s3Svc := s3.New(sess)
+	var keys picturestore.KeyProvider
+	if cfg.Pictures.KMSKeyID != "" {
+		keys = picturestore.NewKMSKeyProvider(kms.New(sess), cfg.Pictures.KMSKeyID)
+	}
+	pictures, err := picturestore.New(cfg.Pictures.Config, s3Svc, keys)
+	if err != nil {
+		return nil, err
+	}
 
-func init() {
-	var err error
-
-	consumerKey = os.Getenv("CONSUMER_KEY")
-	consumerSecret = os.Getenv("CONSUMER_SECRET_KEY")
-	oauthToken = os.Getenv("OAUTH_TOKEN")
-	oauthSecret = os.Getenv("OAUTH_SECRET")
-
-	c := oauth.NewConsumer(
-		consumerKey,
-		consumerSecret,
-		oauth.ServiceProvider{
-			RequestTokenUrl:   "https://api.twitter.com/oauth/request_token",
-			AuthorizeTokenUrl: "https://api.twitter.com/oauth/authorize",
-			AccessTokenUrl:    "https://api.twitter.com/oauth/access_token",
-		})
+	rekoSvc := rekognition.New(trace.Session(session.New(
+		&aws.Config{
+			Region: aws.String(cfg.RekognitionRegion),
+		},
+	)))
 
-	accessToken := oauth.AccessToken{
-		Token:  oauthToken,
-		Secret: oauthSecret,
+	cache := analysiscache.NewS3Cache(pictures, cfg.Pictures.Bucket)
+	h := newHandler(clients, store, forget.New(s3Svc, index, hashes, store), renderer, pictures, index, cache, rekoSvc, cfg.Thresholds)
+	if cfg.Tables.Outbox != "" {
+		h.deferred = outbox.New(outbox.NewDynamoDBStore(dynamodbSvc, cfg.Tables.Outbox), outbox.DefaultPolicy)
 	}
+	h.logger = logger
+	h.recorder = recorder
+	h.tracer = trace.New("twitter-reply", exporter)
+	return h, nil
+}
 
-	client, err = c.MakeHttpClient(&accessToken)
+// Handle is the lambda handler function. The output has the ids of the sent
+// replies. Failures twitter may recover from are returned as RetryableError.
+func (h *handler) Handle(ctx context.Context, events Event) (Event, error) {
+	ctx, span := h.tracer.Continue(ctx, "twitter-reply", events.Trace)
+	defer span.End()
+
+	log := h.logger.WithRequest(events.RequestID).With(logging.FieldForUserID, events.ForUserID)
+	r, err := h.newReplier(ctx, events.ForUserID, log)
 	if err != nil {
-		log.Fatal(err)
+		log.Error("failed to get account", "error", err)
+		return Event{}, fmt.Errorf("GET_ACCOUNT_FAILED")
+	}
+
+	out := Event{
+		RequestID:           events.RequestID,
+		ForUserID:           events.ForUserID,
+		DirectMessageEvents: make([]DirectMessageEvent, 0, len(events.DirectMessageEvents)),
+		Trace:               trace.Traceparent(ctx),
+	}
+	for _, v := range events.DirectMessageEvents {
+		replied, err := r.replyTo(ctx, v)
+		if err != nil {
+			span.SetError(err)
+			return Event{}, err
+		}
+		out.DirectMessageEvents = append(out.DirectMessageEvents, replied)
+	}
+	return out, nil
+}
+
+// newReplier returns the replier of the bot account forUserID, with the
+// account's own templates.
+func (h *handler) newReplier(ctx context.Context, forUserID string, log *logging.Logger) (*replier, error) {
+	client, acct, err := h.clients.Get(ctx, forUserID)
+	if err != nil {
+		return nil, err
+	}
+	accountRenderer, err := h.baseRenderer.With(acct.Templates)
+	if err != nil {
+		return nil, err
+	}
+	return &replier{
+		handler:  h,
+		account:  acct,
+		client:   client,
+		renderer: accountRenderer,
+		log:      log,
+	}, nil
+}
+
+// replyTo answers one direct message. A picture is answered with its analysis,
+// which is remembered so that a later text message can ask about it. Messages
+// already answered, by an earlier attempt of a retried execution, are not
+// answered again.
+func (r *replier) replyTo(ctx context.Context, dm DirectMessageEvent) (DirectMessageEvent, error) {
+	log := r.log.WithDM(dm.ID, dm.SenderID)
+	state, err := r.store.Get(ctx, r.account.UserID, dm.SenderID)
+	if err != nil {
+		log.Error("failed to get conversation", "error", err)
+		return dm, fmt.Errorf("GET_CONVERSATION_FAILED")
+	}
+	if ids := state.RepliesTo(dm.ID); len(ids) > 0 {
+		dm.ReplyMessageIDs = ids
+		dm.ReplyStatus = replyAlreadySent
+		return dm, nil
+	}
+	base := state.Copy()
+	state.AddMessage(conversation.Message{
+		ID:              dm.ID,
+		CreateTimestamp: dm.CreateTimestamp,
+		Text:            dm.Text,
+		MediaID:         dm.MediaID,
+	})
+
+	// a quick reply answer carries the chosen option's metadata, its text is
+	// only the option's label
+	cmd, isCommand := command.FromQuickReply(dm.QuickReplyMetadata)
+	if !isCommand && dm.MediaURL == "" {
+		cmd, isCommand = command.Parse(dm.Text)
+	}
+	if isCommand && cmd.Name == command.Forget {
+		return r.forgetSender(ctx, dm, state.Preferences)
+	}
+
+	var m message
+	switch {
+	case dm.Flagged:
+		// a blocklisted picture is neither stored nor analysed, the last
+		// analysis stays the one of the previous picture
+		m.text = r.render(state.Preferences, reply.TemplatePictureRefused, nil)
+	case dm.MediaURL != "":
+		fs := newFaces(dm.Faces)
+		state.LastAnalysis = &conversation.Analysis{
+			MediaID:         dm.MediaID,
+			CreateTimestamp: dm.CreateTimestamp,
+			Faces:           fs,
+		}
+		if !dm.Transient {
+			state.LastAnalysis.S3bucket = dm.S3bucket
+			state.LastAnalysis.S3path = dm.S3path
+			state.LastAnalysis.Checksum = dm.Checksum
+			state.LastAnalysis.SimilarTo = dm.SimilarTo
+		}
+		m = message{
+			text:    r.facesMessage(fs, state.Preferences),
+			options: r.quickReplies(state),
+		}
+	case isCommand && isAction(cmd):
+		m, err = r.actionMessage(ctx, &state, cmd)
+		if err != nil {
+			log.Error("failed to run action", "action", cmd.Name, "error", err)
+			return dm, fmt.Errorf("QUICK_REPLY_ACTION_FAILED")
+		}
+	case isCommand:
+		m.text = r.commandMessage(&state, cmd)
+	default:
+		m.text = r.followUpMessage(state, dm.Text)
+	}
+
+	sent, isDeferred, err := r.sendDM(ctx, dm.ID, dm.SenderID, m)
+	for _, e := range sent {
+		dm.ReplyMessageIDs = append(dm.ReplyMessageIDs, e.ID)
+		state.AddMessage(conversation.Message{
+			ID:              e.ID,
+			CreateTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			Text:            e.MessageCreate.MessageData.Text,
+			FromBot:         true,
+			InReplyTo:       dm.ID,
+		})
+	}
+	switch {
+	case isForbidden(err):
+		// the sender can not be answered, the message and analysis are
+		// still remembered
+		log.Warn("sender does not accept direct messages", "error", err)
+		dm.ReplyStatus = replyForbidden
+	case err != nil:
+		log.Error("failed to send direct message", "sent", len(sent), "error", err)
+		if len(sent) > 0 {
+			// the parts sent are remembered, a retried execution finds the
+			// message answered and does not send them again
+			if putErr := conversation.Save(ctx, r.store, base, state); putErr != nil {
+				log.Error("failed to put conversation", "error", putErr)
+			}
+		}
+		return dm, sendError(err)
+	case isDeferred:
+		dm.ReplyStatus = replyDeferred
+	default:
+		dm.ReplyStatus = replySent
 	}
+	log.Info("replied", "status", dm.ReplyStatus, "messages", len(sent))
+
+	if err := conversation.Save(ctx, r.store, base, state); err != nil {
+		log.Error("failed to put conversation", "error", err)
+		return dm, fmt.Errorf("PUT_CONVERSATION_FAILED")
+	}
+	return dm, nil
 }
 
-// Handler lambda handler function
-func Handler(events Event) error {
-	fs := make(faces, 0)
-	for _, v := range events.DirectMessageEvents[0].Faces {
-		f := face{
-			ageLow:  *v.AgeRange.Low,
-			ageHigh: *v.AgeRange.High,
-			gender:  *v.Gender.Value,
+func newFaces(faceDetails []*rekognition.FaceDetail) []conversation.Face {
+	fs := make([]conversation.Face, 0)
+	for _, v := range faceDetails {
+		f := conversation.Face{}
+		if v.AgeRange != nil {
+			f.AgeLow = aws.Int64Value(v.AgeRange.Low)
+			f.AgeHigh = aws.Int64Value(v.AgeRange.High)
+		}
+		if v.Gender != nil {
+			f.Gender = aws.StringValue(v.Gender.Value)
+		}
+		if b := v.BoundingBox; b != nil {
+			f.Box = &conversation.Box{
+				Left:   aws.Float64Value(b.Left),
+				Top:    aws.Float64Value(b.Top),
+				Width:  aws.Float64Value(b.Width),
+				Height: aws.Float64Value(b.Height),
+			}
 		}
 		var c float64
 		for _, vv := range v.Emotions {
-			if *vv.Confidence > c {
-				c = *vv.Confidence
-				f.emotions = *vv.Type
+			if aws.Float64Value(vv.Confidence) > c {
+				c = aws.Float64Value(vv.Confidence)
+				f.Emotion = aws.StringValue(vv.Type)
 			}
 		}
 		fs = append(fs, f)
 	}
-	var replyMessage string
-	for i, v := range fs {
-		replyMessage += fmt.Sprintf(`face:%d, 
-age between %d and %d
-gender: %s
-emotion: %s
-`, i, v.ageLow, v.ageHigh, v.gender, v.emotions)
-	}
-	replyEvent := DMReplyEvent{
-		Event: ReplyEvent{
-			Type: "message_create",
-			MessageCreate: MessageCreate{
-				Target: Target{
-					RecipientID: events.DirectMessageEvents[0].SenderID,
-				},
-				MessageData: MessageData{
-					Text: string(replyMessage),
-				},
-			},
-		},
+	return fs
+}
+
+// render renders template name in the sender's language. A template that
+// fails to render is a bug, the sender gets the help text instead.
+func (r *replier) render(prefs conversation.Preferences, name string, data interface{}) string {
+	lang := prefs.WithDefaults().Language
+	text, err := r.renderer.Render(lang, name, data)
+	if err != nil {
+		r.log.Error("failed to render reply", "template", name, "error", err)
+		text, _ = r.renderer.Render(lang, reply.TemplateHelp, nil)
 	}
-	payLoad, _ := json.Marshal(replyEvent)
-	fmt.Printf("payload: %v\n", string(payLoad))
-	client.Post(
-		"https://api.twitter.com/1.1/direct_messages/events/new.json",
-		"application/json",
-		bytes.NewReader(payLoad),
-	)
+	return text
+}
+
+func (r *replier) faceMessage(i int, f conversation.Face, prefs conversation.Preferences) string {
+	return r.render(prefs, reply.TemplateFace, reply.NewFaceData(i, f, prefs))
+}
+
+func (r *replier) facesMessage(fs []conversation.Face, prefs conversation.Preferences) string {
+	return r.render(prefs, reply.TemplateFaces, reply.NewFacesData(fs, prefs))
+}
+
+// commandMessage runs cmd against the sender's state and returns the answer.
+func (r *replier) commandMessage(state *conversation.State, cmd command.Command) string {
+	switch cmd.Name {
+	case command.Set:
+		if len(cmd.Args) != 2 {
+			return r.render(state.Preferences, reply.TemplateHelp, nil)
+		}
+		if err := state.Preferences.Set(cmd.Args[0], cmd.Args[1]); err != nil {
+			return r.render(state.Preferences, reply.TemplateSettingInvalid, reply.SettingData{Err: err.Error()})
+		}
+		return r.render(state.Preferences, reply.TemplateSettingChanged, reply.SettingData{Name: cmd.Args[0], Value: cmd.Args[1]})
+	case command.Settings:
+		p := state.Preferences.WithDefaults()
+		return r.render(p, reply.TemplateSettings, p)
+	}
+	return r.render(state.Preferences, reply.TemplateHelp, nil)
+}
 
+// forgetSender deletes everything stored about the sender and confirms it.
+// Nothing about the conversation is saved afterwards.
+func (r *replier) forgetSender(ctx context.Context, dm DirectMessageEvent, prefs conversation.Preferences) (DirectMessageEvent, error) {
+	log := r.log.WithDM(dm.ID, dm.SenderID)
+	result, err := r.forgetter.Forget(ctx, r.account.UserID, dm.SenderID)
+	if err != nil {
+		log.Error("failed to forget sender", "error", err)
+		return dm, fmt.Errorf("FORGET_SENDER_FAILED")
+	}
+	sent, isDeferred, err := r.sendDM(ctx, dm.ID, dm.SenderID, message{
+		text: r.render(prefs, reply.TemplateForgotten, reply.CountData{Count: len(result.Objects)}),
+	})
+	switch {
+	case isForbidden(err):
+		dm.ReplyStatus = replyForbidden
+	case err != nil:
+		log.Error("failed to send direct message", "error", err)
+		return dm, sendError(err)
+	case isDeferred:
+		dm.ReplyStatus = replyDeferred
+	default:
+		dm.ReplyStatus = replySent
+	}
+	for _, e := range sent {
+		dm.ReplyMessageIDs = append(dm.ReplyMessageIDs, e.ID)
+	}
+	return dm, nil
+}
+
+// sendDM sends m, the answer to message inReplyTo, as several messages when
+// it is longer than twitter allows and REPLY_OVERFLOW is split. Quick replies
+// and media go with the last part. It returns the messages sent before any
+// error. When a part fails with an error twitter may recover from, and the
+// outbox is configured, that part and the rest are deferred to the outbox.
+func (r *replier) sendDM(ctx context.Context, inReplyTo string, recipientID string, m message) (sent []twitter.DirectMessageEvent, isDeferred bool, err error) {
+	parts := r.renderer.Fit(m.text)
+	requests := make([]twitter.DirectMessageRequest, 0, len(parts))
+	for i, part := range parts {
+		replyEvent := twitter.NewDirectMessageRequest(recipientID, part)
+		if i == len(parts)-1 {
+			replyEvent.SetQuickReplies(m.options)
+			replyEvent.SetMedia(m.mediaID)
+		}
+		requests = append(requests, replyEvent)
+	}
+
+	log := r.log.WithDM(inReplyTo, recipientID)
+	sent = make([]twitter.DirectMessageEvent, 0, len(requests))
+	for i, replyEvent := range requests {
+		log.Debug("sending direct message", "part", i, "parts", len(requests),
+			"quick_replies", len(m.options), "media", m.mediaID != "")
+		e, err := twitter.SendDirectMessage(ctx, r.client, replyEvent)
+		if err != nil {
+			metrics.Count(r.recorder, metrics.DirectMessagesFailed, 1, "Source", "reply")
+			if r.deferred == nil || !isRetryable(err) {
+				return sent, false, err
+			}
+			if deferErr := r.deferDMs(ctx, inReplyTo, recipientID, i, requests[i:], err); deferErr != nil {
+				log.Error("failed to defer direct message", "error", deferErr)
+				return sent, false, err
+			}
+			return sent, true, nil
+		}
+		metrics.Count(r.recorder, metrics.DirectMessagesSent, 1, "Source", "reply")
+		sent = append(sent, e)
+	}
+	return sent, false, nil
+}
+
+// deferDMs puts requests, starting with part first of the answer to
+// inReplyTo, in the outbox as one message so the parts are sent in order.
+func (r *replier) deferDMs(ctx context.Context, inReplyTo string, recipientID string, first int, requests []twitter.DirectMessageRequest, cause error) error {
+	err := r.deferred.Enqueue(ctx, outbox.Message{
+		ID:        fmt.Sprintf("%s-%d", inReplyTo, first),
+		ForUserID: r.account.UserID,
+		SenderID:  recipientID,
+		InReplyTo: inReplyTo,
+		Requests:  requests,
+	}, cause)
+	if err != nil {
+		return err
+	}
+	r.log.WithDM(inReplyTo, recipientID).Warn("deferred direct messages", "messages", len(requests), "error", cause)
 	return nil
 }
 
 func main() {
-	lambda.Start(Handler)
+	cfg, err := config.FromEnv("twitter-reply")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyConsumerKey, config.KeyConsumerSecret, config.KeyPictureBucket); err != nil {
+		log.Fatal(err)
+	}
+	h, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(h.Handle)
 }
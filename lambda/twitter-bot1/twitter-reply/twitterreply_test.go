@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/account"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/conversation"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/reply"
+)
+
+// fakeTwitter answers direct messages as sent, those after the first
+// failAfter with a bad request when failAfter is set
+type fakeTwitter struct {
+	mu        sync.Mutex
+	sent      int
+	failAfter int
+}
+
+func (f *fakeTwitter) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failAfter > 0 && f.sent >= f.failAfter {
+		body := `{"errors":[{"code":214,"message":"bad request"}]}`
+		return &http.Response{StatusCode: http.StatusBadRequest, Body: ioutil.NopCloser(bytes.NewReader([]byte(body)))}, nil
+	}
+	f.sent++
+	body := fmt.Sprintf(`{"event":{"type":"message_create","id":"11464713023562547%02d","created_timestamp":"1562101442452"}}`, f.sent)
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader([]byte(body)))}, nil
+}
+
+type fakeClients struct {
+	twitter   *fakeTwitter
+	templates map[string]string
+}
+
+func (f fakeClients) Get(ctx context.Context, userID string) (*http.Client, account.Account, error) {
+	transport := f.twitter
+	if transport == nil {
+		transport = &fakeTwitter{}
+	}
+	return &http.Client{Transport: transport}, account.Account{UserID: userID, Templates: f.templates}, nil
+}
+
+func TestHandle(t *testing.T) {
+	tt := []struct {
+		name   string
+		sent   []string
+		status string
+	}{
+		{name: "firstAttempt", status: replySent},
+		{name: "retriedExecution", sent: []string{"1146471302356254700"}, status: replyAlreadySent},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			renderer, err := reply.New(reply.OverflowSplit)
+			if err != nil {
+				t.Fatalf("reply.New failed with error: %v", err)
+			}
+			store := conversation.NewMemoryStore()
+			state := conversation.State{ForUserID: "4337869213", SenderID: "3805104374"}
+			state.AddMessage(conversation.Message{ID: "954491830116155396", Text: "hello"})
+			for _, id := range tc.sent {
+				state.AddMessage(conversation.Message{ID: id, FromBot: true, InReplyTo: "954491830116155396"})
+			}
+			store.Put(ctx, state)
+
+			h := newHandler(fakeClients{}, store, nil, renderer, nil, nil, nil, nil, config.Thresholds{})
+			out, err := h.Handle(ctx, Event{RequestID: "r1", ForUserID: "4337869213", DirectMessageEvents: []DirectMessageEvent{
+				{ID: "954491830116155396", SenderID: "3805104374", Text: "hello"},
+			}})
+			if err != nil {
+				t.Fatalf("Handle failed with error: %v", err)
+			}
+
+			got := out.DirectMessageEvents[0]
+			if got.ReplyStatus != tc.status || len(got.ReplyMessageIDs) != 1 {
+				t.Fatalf("got: %v %v, wanted: %v and one reply", got.ReplyStatus, got.ReplyMessageIDs, tc.status)
+			}
+			state, _ = store.Get(ctx, "4337869213", "3805104374")
+			if ids := state.RepliesTo("954491830116155396"); len(ids) != 1 {
+				t.Fatalf("got: %v replies remembered, wanted: 1", ids)
+			}
+		})
+	}
+}
+
+func TestHandlePartiallySent(t *testing.T) {
+	ctx := context.Background()
+	renderer, err := reply.New(reply.OverflowSplit)
+	if err != nil {
+		t.Fatalf("reply.New failed with error: %v", err)
+	}
+	store := conversation.NewMemoryStore()
+	// an answer of two parts, the second fails
+	twitter := &fakeTwitter{failAfter: 1}
+	clients := fakeClients{twitter: twitter, templates: map[string]string{
+		reply.TemplateSendPicture: strings.Repeat("word ", 3000),
+	}}
+	h := newHandler(clients, store, nil, renderer, nil, nil, nil, nil, config.Thresholds{})
+	event := Event{RequestID: "r1", ForUserID: "4337869213", DirectMessageEvents: []DirectMessageEvent{
+		{ID: "954491830116155396", SenderID: "3805104374", Text: "hello"},
+	}}
+
+	if _, err := h.Handle(ctx, event); err == nil {
+		t.Fatalf("got: no error, wanted the failed part's")
+	}
+	state, _ := store.Get(ctx, "4337869213", "3805104374")
+	if ids := state.RepliesTo("954491830116155396"); len(ids) != 1 {
+		t.Fatalf("got: %v replies remembered, wanted: the part sent", ids)
+	}
+
+	// the retried execution does not send the first part again
+	out, err := h.Handle(ctx, event)
+	if err != nil {
+		t.Fatalf("Handle failed with error: %v", err)
+	}
+	if got := out.DirectMessageEvents[0]; got.ReplyStatus != replyAlreadySent || twitter.sent != 1 {
+		t.Fatalf("got: %v %v sent, wanted: %v and 1 sent", got.ReplyStatus, twitter.sent, replyAlreadySent)
+	}
+}
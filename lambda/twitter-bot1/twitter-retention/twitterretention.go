@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/config"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/logging"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/phashindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/pictureindex"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/retention"
+	"github.com/dbgeek/twitter-bot1/lambda/twitter-bot1/internal/trace"
+)
+
+// handler deletes the objects past their retention
+type handler struct {
+	enforcer *retention.Enforcer
+	logger   *logging.Logger
+	tracer   *trace.Tracer
+}
+
+// newHandler returns a handler running enforcer. Logs and spans are discarded
+// until set.
+func newHandler(enforcer *retention.Enforcer) *handler {
+	return &handler{
+		enforcer: enforcer,
+		logger:   logging.New(ioutil.Discard, "twitter-retention", logging.LevelError),
+		tracer:   trace.New("twitter-retention", trace.Nop{}),
+	}
+}
+
+// fromConfig returns the handler of the lambda, with the AWS services of cfg.
+func fromConfig(cfg config.Config) (*handler, error) {
+	policy, err := retention.ParsePolicy(cfg.Features.RetentionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := trace.NewExporter(cfg.Features.TraceExporter, cfg.Features.XRayDaemonAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := trace.Session(session.New(&aws.Config{
+		Region: aws.String(cfg.Region),
+	}))
+
+	var index pictureindex.Index
+	if cfg.Tables.PictureIndex != "" {
+		index = pictureindex.NewDynamoDBIndex(dynamodb.New(sess), cfg.Tables.PictureIndex)
+	} else {
+		index = pictureindex.NewMemoryIndex()
+	}
+
+	var hashes phashindex.Index
+	if cfg.Tables.PerceptualHash != "" {
+		hashes = phashindex.NewDynamoDBIndex(dynamodb.New(sess), cfg.Tables.PerceptualHash)
+	} else {
+		hashes = phashindex.NewMemoryIndex()
+	}
+
+	enforcer := retention.NewEnforcer(s3.New(sess), index, hashes, cfg.Pictures.Bucket, policy)
+	enforcer.DryRun = cfg.Features.RetentionDryRun
+
+	h := newHandler(enforcer)
+	h.logger = logging.New(os.Stdout, cfg.Lambda, cfg.Features.LogLevel)
+	logging.SetHashSalt(cfg.Features.LogHashSalt)
+	h.tracer = trace.New("twitter-retention", exporter)
+	return h, nil
+}
+
+// maxReportedExpired expired objects listed in the returned report, a lambda
+// response is at most 6 MB
+const maxReportedExpired = 1000
+
+// Handle runs on a schedule and deletes expired objects. The counts are
+// logged and the report returned, in dry-run mode it lists what would be
+// deleted.
+func (h *handler) Handle(ctx context.Context, event events.CloudWatchEvent) (retention.Report, error) {
+	ctx, span := h.tracer.Start(ctx, "twitter-retention")
+	defer span.End()
+	log := h.logger.WithRequest(event.ID)
+
+	report, err := h.enforcer.Run(ctx)
+	if err != nil {
+		span.SetError(err)
+		log.Error("retention run failed", "error", err)
+	}
+	log.Info("retention run",
+		"dry_run", report.DryRun,
+		"scanned", report.Scanned,
+		"expired", len(report.Expired),
+		"deleted", report.Deleted,
+	)
+
+	return report.Capped(maxReportedExpired), err
+}
+
+func main() {
+	cfg, err := config.FromEnv("twitter-retention")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Require(config.KeyPictureBucket); err != nil {
+		log.Fatal(err)
+	}
+	h, err := fromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lambda.Start(h.Handle)
+}